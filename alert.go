@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var alertTypes = []string{"NOTE", "TIP", "IMPORTANT", "WARNING", "CAUTION"}
+
+var kindAlert = ast.NewNodeKind("Alert")
+
+// alertBlock is a blockquote starting with [!NOTE], [!TIP], [!IMPORTANT],
+// [!WARNING] or [!CAUTION], rendered as an alert like on GitHub.
+type alertBlock struct {
+	ast.BaseBlock
+	AlertType string
+}
+
+func (n *alertBlock) Kind() ast.NodeKind {
+	return kindAlert
+}
+
+func (n *alertBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"AlertType": n.AlertType}, nil)
+}
+
+type alerts struct{}
+
+func (a *alerts) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(a, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(a, 100)))
+}
+
+func (a *alerts) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var quotes []*ast.Blockquote
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if quote, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, quote := range quotes {
+		paragraph, ok := quote.FirstChild().(*ast.Paragraph)
+		if !ok || paragraph.Lines().Len() == 0 {
+			continue
+		}
+		firstLine := paragraph.Lines().At(0)
+		alertType := alertType(firstLine.Value(source))
+		if alertType == "" {
+			continue
+		}
+
+		// Drop the marker line from the paragraph.
+		for child := paragraph.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			textNode, ok := child.(*ast.Text)
+			if !ok || textNode.Segment.Start >= firstLine.Stop {
+				break
+			}
+			paragraph.RemoveChild(paragraph, child)
+			child = next
+		}
+
+		alert := &alertBlock{AlertType: alertType}
+		for child := quote.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			if child != paragraph || paragraph.HasChildren() {
+				alert.AppendChild(alert, child)
+			}
+			child = next
+		}
+		quote.Parent().ReplaceChild(quote.Parent(), quote, alert)
+	}
+}
+
+func alertType(line []byte) string {
+	line = bytes.TrimSpace(line)
+	for _, t := range alertTypes {
+		if strings.EqualFold(string(line), "[!"+t+"]") {
+			return t
+		}
+	}
+	return ""
+}
+
+func (a *alerts) RegisterFuncs(r renderer.NodeRendererFuncRegisterer) {
+	r.Register(kindAlert, a.render)
+}
+
+func (a *alerts) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	alert := n.(*alertBlock)
+	if !entering {
+		w.WriteString("</div>\n")
+		return ast.WalkContinue, nil
+	}
+
+	name := strings.ToLower(alert.AlertType)
+	w.WriteString(`<div class="markdown-alert markdown-alert-` + name + `">` + "\n")
+	w.WriteString(`<p class="markdown-alert-title">` + alert.AlertType[:1] + name[1:] + "</p>\n")
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// headingIDs generates GitHub-compatible heading anchors, so the same links
+// work on GitHub, in the injected table of contents and in rendered pages.
+type headingIDs struct {
+	used map[string]int
+}
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{used: make(map[string]int)}
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	slug := headingSlug(string(value))
+	if slug == "" {
+		slug = "heading"
+	}
+	return []byte(uniqueSlug(slug, ids.used))
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.used[string(value)]++
+}
+
+// anchors rewrites links to a heading of the same document (#Installation-Guide,
+// #installation%20guide) to the heading's normalized anchor.
+type anchors struct{}
+
+func (a *anchors) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(a, 100)))
+}
+
+func (a *anchors) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ids := make(map[string]bool)
+	var links []*ast.Link
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			if id, ok := n.AttributeString("id"); ok {
+				if id, ok := id.([]byte); ok {
+					ids[string(id)] = true
+				}
+			}
+		case *ast.Link:
+			if strings.HasPrefix(string(n.Destination), "#") {
+				links = append(links, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, link := range links {
+		fragment := string(link.Destination[1:])
+		if ids[fragment] {
+			continue
+		}
+		if decoded, err := url.PathUnescape(fragment); err == nil {
+			fragment = decoded
+		}
+		if slug := headingSlug(fragment); ids[slug] {
+			link.Destination = []byte("#" + slug)
+		}
+	}
+}
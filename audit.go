@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditMove   = "move"
+	// auditDelete is logged for every output file or ConfigMap removed.
+	auditDelete = "delete"
+	auditSkip   = "skip"
+	auditError  = "error"
+	// auditRemove files were removed upstream, their output is kept.
+	auditRemove = "remove"
+)
+
+type auditEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Repo   string    `json:"repo"`
+	Path   string    `json:"path"`
+	Sha    string    `json:"sha,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+var auditLog struct {
+	sync.Mutex
+	file *os.File
+}
+
+// audit appends a sync decision to the --audit-log file as a JSON line. The
+// file is only ever appended to. Changes are also collected for CHANGES.md.
+func audit(action, repo, path, sha, reason string) {
+	recordChange(action, repo, path)
+	if cfg.AuditLog == "" {
+		return
+	}
+
+	auditLog.Lock()
+	defer auditLog.Unlock()
+
+	if auditLog.file == nil {
+		f, err := os.OpenFile(cfg.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Errorf("Failed to open audit log: %s\n", err)
+			return
+		}
+		auditLog.file = f
+	}
+
+	line, err := json.Marshal(auditEvent{
+		Time:   time.Now(),
+		Action: action,
+		Repo:   repo,
+		Path:   path,
+		Sha:    sha,
+		Reason: reason,
+	})
+	if err != nil {
+		log.Errorf("Failed to encode audit event: %s\n", err)
+		return
+	}
+	if _, err := auditLog.file.Write(append(line, '\n')); err != nil {
+		log.Errorf("Failed to write audit log: %s\n", err)
+	}
+}
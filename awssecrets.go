@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	awsSecretsPrefix = "aws-sm:"
+	ssmPrefix        = "ssm:"
+)
+
+// awsSecret reads a secret of AWS Secrets Manager, referenced by name or ARN
+// as aws-sm:<id>. A secret holding JSON key/value pairs is referenced as
+// aws-sm:<id>#<key>.
+func awsSecret(ref string) (string, error) {
+	id, key := strings.TrimPrefix(ref, awsSecretsPrefix), ""
+	if split := strings.SplitN(id, "#", 2); len(split) == 2 {
+		id, key = split[0], split[1]
+	}
+	var secret struct {
+		SecretString string
+	}
+	if err := awsJSONRequest("secretsmanager", "SECRETS_MANAGER", "secretsmanager.GetSecretValue", arnRegion(id), map[string]string{"SecretId": id}, &secret); err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %s", id, err)
+	}
+	if key == "" {
+		return secret.SecretString, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secret %s isn't JSON, reference it without #%s", id, key)
+	}
+	value, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", id, key)
+	}
+	return value, nil
+}
+
+// ssmParameter reads a parameter of the SSM Parameter Store, SecureString
+// parameters are decrypted.
+func ssmParameter(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, ssmPrefix)
+	var result struct {
+		Parameter struct {
+			Value string
+		}
+	}
+	body := map[string]interface{}{"Name": name, "WithDecryption": true}
+	if err := awsJSONRequest("ssm", "SSM", "AmazonSSM.GetParameter", arnRegion(name), body, &result); err != nil {
+		return "", fmt.Errorf("failed to read parameter %s: %s", name, err)
+	}
+	return result.Parameter.Value, nil
+}
+
+// arnRegion returns the region of an ARN, or the configured region for
+// plain names.
+func arnRegion(id string) string {
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" && parts[3] != "" {
+		return parts[3]
+	}
+	return awsRegion()
+}
+
+// awsJSONRequest calls an action of an AWS JSON protocol API.
+func awsJSONRequest(service, envName, target, region string, body, result interface{}) error {
+	creds, err := awsEnvCredentials()
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequest(http.MethodPost, awsEndpoint(service, envName, region)+"/", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWS(req, data, service, region, creds)
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// The type of the error, like ResourceNotFoundException, is more
+		// telling than the status.
+		var awsErr struct {
+			Type    string `json:"__type"`
+			Message string
+		}
+		if json.NewDecoder(resp.Body).Decode(&awsErr) == nil && awsErr.Type != "" {
+			return fmt.Errorf("%w: %s %s", httpStatusError(resp), awsErr.Type, awsErr.Message)
+		}
+		return httpStatusError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Blobs are stored in the cache directory by their git blob SHA, which is
+// the same for identical content in every repository, so license texts and
+// templates mirrored from many repositories are only fetched once.
+
+func blobCachePath(sha string) string {
+	return filepath.Join(cfg.CacheDir, "blobs", sha[:2], sha)
+}
+
+func readCachedBlob(sha string) ([]byte, bool) {
+	if cfg.NoBlobCache || len(sha) < 3 {
+		return nil, false
+	}
+	content, err := ioutil.ReadFile(blobCachePath(sha))
+	if err != nil {
+		return nil, false
+	}
+	return content, true
+}
+
+func cacheBlob(sha string, content []byte) {
+	if cfg.NoBlobCache || len(sha) < 3 {
+		return
+	}
+	// Only store content that really hashes to the SHA, so a bad response
+	// can't end up in every repository sharing the blob.
+	if gitBlobSha(content) != sha {
+		log.Debugf("Not caching blob %s, content doesn't match its SHA\n", sha)
+		return
+	}
+
+	path := blobCachePath(sha)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		log.Warnf("Failed to create blob cache directory: %s\n", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		log.Warnf("Failed to cache blob %s: %s\n", sha, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Warnf("Failed to cache blob %s: %s\n", sha, err)
+	}
+}
+
+// cacheBlobFile is cacheBlob for a file on disk, it is hashed and copied
+// without reading it into memory.
+func cacheBlobFile(sha, file string) {
+	if cfg.NoBlobCache || len(sha) < 3 {
+		return
+	}
+	if sum, err := gitBlobShaFile(file); err != nil || sum != sha {
+		log.Debugf("Not caching blob %s, content doesn't match its SHA\n", sha)
+		return
+	}
+
+	path := blobCachePath(sha)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		log.Warnf("Failed to create blob cache directory: %s\n", err)
+		return
+	}
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		log.Warnf("Failed to cache blob %s: %s\n", sha, err)
+		return
+	}
+	err = copyFileTo(out, file)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Warnf("Failed to cache blob %s: %s\n", sha, err)
+	}
+}
+
+func gitBlobShaFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", info.Size())
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func gitBlobSha(content []byte) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", len(content))
+	hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
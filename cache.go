@@ -0,0 +1,332 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+// cacheTransport is an http.RoundTripper that keeps GET responses on disk and
+// revalidates them with ETag/Last-Modified once they are no longer fresh.
+type cacheTransport struct {
+	dir       string
+	transport http.RoundTripper
+}
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "md-downloader")
+	}
+	return filepath.Join(dir, "md-downloader")
+}
+
+var sharedClient struct {
+	sync.Mutex
+	client *http.Client
+}
+
+// httpClient returns the client every request goes through, so connections
+// are kept alive and reused across files and repositories.
+func httpClient() *http.Client {
+	sharedClient.Lock()
+	defer sharedClient.Unlock()
+	if sharedClient.client == nil {
+		sharedClient.client = newHTTPClient()
+	}
+	return sharedClient.client
+}
+
+// resetHTTPClient makes httpClient build a new client, so a reloaded config
+// gets its proxy, DNS and cache settings applied.
+func resetHTTPClient() {
+	sharedClient.Lock()
+	defer sharedClient.Unlock()
+	sharedClient.client = nil
+}
+
+// newTransport tunes the default transport for syncs of many small files
+// from few hosts: more idle connections are kept per host and HTTP/2 is
+// used where the server supports it. Responses are gzip compressed unless a
+// request asks for a specific encoding.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 16
+	transport.IdleConnTimeout = 90 * time.Second
+	transport.ForceAttemptHTTP2 = true
+	transport.DialContext = dialContext()
+	transport.Proxy = proxyFunc()
+	return transport
+}
+
+func newHTTPClient() *http.Client {
+	transport := &retryAfterTransport{transport: &tracingTransport{transport: &limitTransport{transport: newTransport()}}}
+	if cfg.NoCache {
+		return &http.Client{Transport: transport}
+	}
+
+	if err := os.MkdirAll(cfg.CacheDir, os.ModePerm); err != nil {
+		log.Warnf("Failed to create cache directory, caching disabled: %s\n", err)
+		return &http.Client{Transport: transport}
+	}
+
+	return &http.Client{
+		Transport: &cacheTransport{
+			dir:       cfg.CacheDir,
+			transport: transport,
+		},
+	}
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if cfg.Offline {
+		return t.offlineResponse(req)
+	}
+	if req.Method != http.MethodGet || hasDirective(req.Header.Get("Cache-Control"), "no-store") {
+		return t.transport.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry, body, ok := t.load(key)
+	if ok && entry.isFresh() && !hasDirective(req.Header.Get("Cache-Control"), "no-cache") {
+		log.Debugf("Serving from cache: %s\n", req.URL)
+		return entry.response(req, body)
+	}
+
+	if ok {
+		req = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		log.Debugf("Revalidated cache entry: %s\n", req.URL)
+		for name, values := range resp.Header {
+			entry.Header[name] = values
+		}
+		entry.StoredAt = time.Now()
+		t.store(key, entry)
+		return entry.response(req, body)
+	}
+
+	if resp.StatusCode != http.StatusOK || !isCacheable(resp.Header) {
+		return resp, nil
+	}
+
+	// The body is written to the cache while the caller reads it, large
+	// files are never held in memory.
+	bodyPath := filepath.Join(t.dir, key+".body")
+	file, err := os.Create(bodyPath + ".tmp")
+	if err != nil {
+		log.Warnf("Failed to write cache body %s: %s\n", key, err)
+		return resp, nil
+	}
+	resp.Body = &cachingBody{
+		ReadCloser: resp.Body,
+		file:       file,
+		path:       bodyPath,
+		done: func() {
+			t.store(key, cacheEntry{
+				URL:        req.URL.String(),
+				StatusCode: resp.StatusCode,
+				Header:     resp.Header.Clone(),
+				StoredAt:   time.Now(),
+			})
+		},
+	}
+
+	return resp, nil
+}
+
+// cachingBody copies a response body to a temporary file as it is read. Only
+// a body read to the end replaces the cached one.
+type cachingBody struct {
+	io.ReadCloser
+	file *os.File
+	path string
+	done func()
+	err  error
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.file != nil && b.err == nil {
+		_, b.err = b.file.Write(p[:n])
+	}
+	if err == io.EOF && b.file != nil {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	if b.file != nil {
+		// JSON decoders stop at the end of the value, the rest of the body
+		// is read here so it still ends up in the cache.
+		io.CopyN(ioutil.Discard, b, 64<<10)
+	}
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+	return b.ReadCloser.Close()
+}
+
+func (b *cachingBody) finish() {
+	tmp := b.file.Name()
+	err := b.file.Close()
+	b.file = nil
+	if b.err != nil || err != nil {
+		os.Remove(tmp)
+		return
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		log.Warnf("Failed to write cache body %s: %s\n", b.path, err)
+		os.Remove(tmp)
+		return
+	}
+	b.done()
+}
+
+// load returns a cache entry and the path of its body.
+func (t *cacheTransport) load(key string) (cacheEntry, string, bool) {
+	var entry cacheEntry
+
+	meta, err := ioutil.ReadFile(filepath.Join(t.dir, key+".json"))
+	if err != nil {
+		return entry, "", false
+	}
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		log.Warnf("Failed to parse cache entry %s: %s\n", key, err)
+		return entry, "", false
+	}
+
+	body := filepath.Join(t.dir, key+".body")
+	if _, err := os.Stat(body); err != nil {
+		return entry, "", false
+	}
+
+	return entry, body, true
+}
+
+func (t *cacheTransport) store(key string, entry cacheEntry) {
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		log.Warnf("Failed to encode cache entry %s: %s\n", key, err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(t.dir, key+".json"), meta, 0644); err != nil {
+		log.Warnf("Failed to write cache entry %s: %s\n", key, err)
+	}
+}
+
+func (e cacheEntry) isFresh() bool {
+	cacheControl := e.Header.Get("Cache-Control")
+	if hasDirective(cacheControl, "no-cache") {
+		return false
+	}
+
+	maxAge, ok := directiveValue(cacheControl, "max-age")
+	if !ok {
+		return false
+	}
+	seconds, err := strconv.Atoi(maxAge)
+	if err != nil {
+		return false
+	}
+
+	return time.Since(e.StoredAt) < time.Duration(seconds)*time.Second
+}
+
+func (e cacheEntry) response(req *http.Request, body string) (*http.Response, error) {
+	file, err := os.Open(body)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	header := e.Header.Clone()
+	header.Set("X-From-Cache", "1")
+
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          file,
+		ContentLength: info.Size(),
+		Request:       req,
+	}, nil
+}
+
+func cacheKey(req *http.Request) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.String()))
+	// Responses differ per token and media type, so they are part of the key.
+	hash.Write([]byte("\n" + req.Header.Get("Authorization")))
+	hash.Write([]byte("\n" + req.Header.Get("Accept")))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isCacheable(header http.Header) bool {
+	cacheControl := header.Get("Cache-Control")
+	if hasDirective(cacheControl, "no-store") {
+		return false
+	}
+	if _, ok := directiveValue(cacheControl, "max-age"); ok {
+		return true
+	}
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+func hasDirective(cacheControl, name string) bool {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func directiveValue(cacheControl, name string) (string, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		split := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		if len(split) == 2 && strings.EqualFold(split[0], name) {
+			return strings.Trim(split[1], `"`), true
+		}
+	}
+	return "", false
+}
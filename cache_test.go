@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResetHTTPClient(t *testing.T) {
+	testConfig(t)
+	defer func() {
+		parseProxy()
+		resetHTTPClient()
+	}()
+	cfg.Proxy = "http://proxy.example:3128"
+	if err := parseProxy(); err != nil {
+		t.Fatal(err)
+	}
+	resetHTTPClient()
+	old := httpClient()
+
+	// A reload without the proxy gets a client without it.
+	cfg.Proxy = ""
+	if err := parseProxy(); err != nil {
+		t.Fatal(err)
+	}
+	if httpClient() != old {
+		t.Fatal("client changed before it was reset")
+	}
+	resetHTTPClient()
+	if httpClient() == old {
+		t.Fatal("client wasn't rebuilt")
+	}
+	transport := httpClient().Transport.(*retryAfterTransport).transport.(*tracingTransport).transport.(*limitTransport).transport.(*http.Transport)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	if proxy, _ := transport.Proxy(req); proxy != nil && proxy.Host == "proxy.example:3128" {
+		t.Errorf("the reset client still uses %s", proxy)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type catalogEntry struct {
+	Repo       string `json:"repo"`
+	Name       string `json:"name"`
+	URL        string `json:"url,omitempty"`
+	Title      string `json:"title,omitempty"`
+	EntryPoint string `json:"entry_point,omitempty"`
+	Documents  int    `json:"documents"`
+}
+
+type opmlOutline struct {
+	Text    string `xml:"text,attr"`
+	Title   string `xml:"title,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	HTMLURL string `xml:"htmlUrl,attr,omitempty"`
+	URL     string `xml:"url,attr,omitempty"`
+}
+
+type opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	} `xml:"head"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+func newCatalogCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Export the configured repositories and their documentation entry points",
+		Run: func(cmd *cobra.Command, args []string) {
+			var entries []catalogEntry
+			for _, repo := range cfg.Repos {
+				entries = append(entries, catalogEntryFor(repo))
+			}
+
+			switch format {
+			case "json":
+				data, err := json.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					log.Errorf("Failed to encode catalog: %s\n", err)
+					return
+				}
+				fmt.Println(string(data))
+			case "opml":
+				var o opml
+				o.Version = "2.0"
+				o.Head.Title = "md-downloader catalog"
+				o.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+				for _, entry := range entries {
+					o.Outlines = append(o.Outlines, opmlOutline{
+						Text:    entry.Name,
+						Title:   entry.Title,
+						Type:    "link",
+						HTMLURL: entry.URL,
+						URL:     entry.EntryPoint,
+					})
+				}
+				data, err := xml.MarshalIndent(o, "", "  ")
+				if err != nil {
+					log.Errorf("Failed to encode catalog: %s\n", err)
+					return
+				}
+				fmt.Println(xml.Header + string(data))
+			default:
+				log.Errorf("Invalid format: %s\n", format)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "opml", "Output format (opml or json)")
+
+	return cmd
+}
+
+// catalogEntryFor describes a repository from its downloaded files. The entry
+// point is its README in the output directory, if there is one.
+func catalogEntryFor(repo string) catalogEntry {
+	entry := catalogEntry{Repo: repo, Name: repoName(repo), URL: repoWebURL(repo)}
+
+	dir := filepath.Join(cfg.Output, repoName(repo))
+	walkMarkdown(dir, func(file, rel string, content []byte) {
+		entry.Documents++
+		if isReadme(filepath.ToSlash(rel)) && entry.EntryPoint == "" {
+			entry.EntryPoint = file
+			entry.Title = documentTitle(content, entry.Name)
+		}
+	})
+	return entry
+}
+
+func repoWebURL(repo string) string {
+	switch {
+	case isLocalRepo(repo):
+		return ""
+	case isGist(repo):
+		return "https://gist.github.com/" + repo[len(gistPrefix):]
+	}
+	remote, err := parseRemoteRepo(repo)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("https://%s/%s", remote.Host, remote.Path)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	versionHeading = regexp.MustCompile(`^(#{1,3})\s+.*?\[?v?(\d+\.\d+(?:\.\d+)?(?:[-+][0-9A-Za-z.-]+)?)\]?`)
+	headingDate    = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+	changelogNames = []string{"changelog", "history", "changes"}
+)
+
+type changelogEntry struct {
+	Project string
+	Version string
+	Date    time.Time
+	Body    string
+	// Level is the level of the release's heading in the changelog.
+	Level int
+}
+
+func newChangelogCmd() *cobra.Command {
+	var out string
+
+	cmd := &cobra.Command{
+		Use:   "changelog",
+		Short: "Combine the changelogs of all downloaded repositories into one digest",
+		Run: func(cmd *cobra.Command, args []string) {
+			var entries []changelogEntry
+			walkMarkdown(cfg.Output, func(file, rel string, content []byte) {
+				// The CHANGES.md of --changes describes the mirror itself.
+				if isChangelog(rel) && rel != changesFile {
+					entries = append(entries, parseChangelog(path.Dir(filepath.ToSlash(rel)), string(content))...)
+				}
+			})
+
+			w := io.Writer(os.Stdout)
+			if out != "-" {
+				f, err := os.Create(out)
+				if err != nil {
+					log.Errorf("Failed to create file: %s\n", out)
+					return
+				}
+				defer f.Close()
+				w = f
+			}
+			writeChangelogDigest(w, entries)
+			log.Infof("Collected %d releases\n", len(entries))
+		},
+	}
+
+	cmd.Flags().StringVar(&out, "out", "-", "File the digest is written to, - for stdout")
+
+	return cmd
+}
+
+func isChangelog(filePath string) bool {
+	if !isMarkdown(filePath) {
+		return false
+	}
+	name := strings.ToLower(path.Base(filepath.ToSlash(filePath)))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	for _, changelog := range changelogNames {
+		if name == changelog {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChangelog splits a changelog into its releases by version headings,
+// such as "## [1.2.0] - 2024-01-31" or "# v1.2.0 (2024-01-31)".
+func parseChangelog(project, content string) []changelogEntry {
+	var entries []changelogEntry
+	var current *changelogEntry
+	var body strings.Builder
+	level := 0
+
+	flush := func() {
+		if current != nil {
+			current.Body = strings.TrimSpace(body.String())
+			entries = append(entries, *current)
+		}
+		body.Reset()
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if match := versionHeading.FindStringSubmatch(line); match != nil && (current == nil || len(match[1]) <= level) {
+			flush()
+			level = len(match[1])
+			current = &changelogEntry{Project: project, Version: match[2], Level: level}
+			if date := headingDate.FindString(line); date != "" {
+				current.Date, _ = time.Parse("2006-01-02", date)
+			}
+			continue
+		}
+		if current != nil {
+			body.WriteString(line + "\n")
+		}
+	}
+	flush()
+	return entries
+}
+
+// writeChangelogDigest writes the releases newest first, releases without a
+// date at the end.
+func writeChangelogDigest(w io.Writer, entries []changelogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date.IsZero() != entries[j].Date.IsZero() {
+			return !entries[i].Date.IsZero()
+		}
+		return entries[i].Date.After(entries[j].Date)
+	})
+
+	fmt.Fprintf(w, "# Changelog digest\n")
+	for _, entry := range entries {
+		date := "undated"
+		if !entry.Date.IsZero() {
+			date = entry.Date.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "\n## %s %s (%s)\n", entry.Project, entry.Version, date)
+		if entry.Body != "" {
+			fmt.Fprintf(w, "\n%s\n", demoteHeadings(entry.Body, 2-entry.Level))
+		}
+	}
+}
+
+// demoteHeadings moves the headings of a release below the digest's release
+// heading.
+func demoteHeadings(body string, levels int) string {
+	if levels <= 0 {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	fenced := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "```") {
+			fenced = !fenced
+		}
+		if !fenced && strings.HasPrefix(line, "#") {
+			lines[i] = strings.Repeat("#", levels) + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
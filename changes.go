@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	changesFile    = "CHANGES.md"
+	changesHeader  = "# Changes\n\n"
+	changesPerList = 50
+)
+
+// runChanges collects the files each repository got in this run for
+// CHANGES.md.
+var runChanges = struct {
+	sync.Mutex
+	repos map[string]map[string][]string
+}{repos: make(map[string]map[string][]string)}
+
+func recordChange(action, repo, path string) {
+	if action != auditCreate && action != auditUpdate && action != auditMove && action != auditRemove {
+		return
+	}
+	runChanges.Lock()
+	defer runChanges.Unlock()
+	if runChanges.repos[repo] == nil {
+		runChanges.repos[repo] = make(map[string][]string)
+	}
+	runChanges.repos[repo][action] = append(runChanges.repos[repo][action], path)
+}
+
+func resetChanges() {
+	runChanges.Lock()
+	defer runChanges.Unlock()
+	runChanges.repos = make(map[string]map[string][]string)
+}
+
+// writeChanges prepends a section describing this run to CHANGES.md in the
+// output directory, runs without changes add nothing.
+func writeChanges() {
+	runChanges.Lock()
+	defer runChanges.Unlock()
+	if len(runChanges.repos) == 0 {
+		return
+	}
+
+	var repos []string
+	for repo := range runChanges.repos {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	var section strings.Builder
+	fmt.Fprintf(&section, "## %s\n\n", time.Now().UTC().Format("2006-01-02 15:04 UTC"))
+	for _, repo := range repos {
+		fmt.Fprintf(&section, "### %s\n\n", repo)
+		for _, kind := range []struct{ action, title string }{
+			{auditCreate, "Added"},
+			{auditUpdate, "Updated"},
+			{auditMove, "Moved"},
+			{auditRemove, "Removed upstream"},
+		} {
+			paths := runChanges.repos[repo][kind.action]
+			if len(paths) == 0 {
+				continue
+			}
+			sort.Strings(paths)
+			fmt.Fprintf(&section, "%s (%d):\n\n", kind.title, len(paths))
+			for i, path := range paths {
+				if i == changesPerList {
+					fmt.Fprintf(&section, "- and %d more\n", len(paths)-i)
+					break
+				}
+				fmt.Fprintf(&section, "- `%s`\n", path)
+			}
+			section.WriteString("\n")
+		}
+	}
+
+	file := filepath.Join(cfg.Output, changesFile)
+	previous, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Failed to read %s: %s\n", file, err)
+		return
+	}
+	content := changesHeader + section.String() + strings.TrimPrefix(string(previous), changesHeader)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		log.Errorf("Failed to write %s: %s\n", file, err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteChangesPerSync(t *testing.T) {
+	testConfig(t)
+	defer resetChanges()
+	if err := os.MkdirAll(cfg.Output, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	beginSync()
+	recordChange(auditCreate, testRepo, "first.md")
+	writeChanges()
+	endSync()
+
+	beginSync()
+	recordChange(auditUpdate, testRepo, "second.md")
+	writeChanges()
+	endSync()
+
+	content, err := ioutil.ReadFile(filepath.Join(cfg.Output, changesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := strings.Split(strings.TrimPrefix(string(content), changesHeader), "\n## ")
+	if len(sections) != 2 {
+		t.Fatalf("got %d sections, want 2:\n%s", len(sections), content)
+	}
+	if !strings.Contains(sections[0], "second.md") || strings.Contains(sections[0], "first.md") {
+		t.Errorf("the second sync repeats the first one:\n%s", sections[0])
+	}
+	if !strings.Contains(sections[1], "first.md") || strings.Contains(sections[1], "second.md") {
+		t.Errorf("unexpected first section:\n%s", sections[1])
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var configFile string
+var profile string
+
+// configured holds the flags applyConfig set, a reload resets them before
+// reading the config file again.
+var configured = make(map[*pflag.Flag]bool)
+
+// configEntry is one top level key of the config file with the line it is
+// on, for error messages.
+type configEntry struct {
+	Key    string
+	Line   int
+	Values []string
+}
+
+// readConfig parses the config file. Keys are flag names, lists and
+// mappings are turned into the repeated values of the flag: a mapping like
+// token: {gitlab.com: TOKEN} becomes --token gitlab.com=TOKEN. The keys of
+// the selected --profile replace the top level ones.
+func readConfig(file string) ([]configEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: expected a mapping of flag names to values", file)
+	}
+
+	var profiles *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "profiles" {
+			profiles = root.Content[i+1]
+		}
+	}
+	entries, err := configEntries(file, root)
+	if err != nil || profile == "" {
+		return entries, err
+	}
+
+	if profiles == nil || profiles.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: no profiles to select %s from", file, profile)
+	}
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		if profiles.Content[i].Value != profile {
+			continue
+		}
+		if profiles.Content[i+1].Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s:%d: profile %s must be a mapping", file, profiles.Content[i].Line, profile)
+		}
+		overrides, err := configEntries(file, profiles.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		replaced := make(map[string]bool)
+		for _, entry := range overrides {
+			replaced[entry.Key] = true
+		}
+		var merged []configEntry
+		for _, entry := range entries {
+			if !replaced[entry.Key] {
+				merged = append(merged, entry)
+			}
+		}
+		return append(merged, overrides...), nil
+	}
+	return nil, fmt.Errorf("%s: unknown profile %s", file, profile)
+}
+
+func configEntries(file string, mapping *yaml.Node) ([]configEntry, error) {
+	var entries []configEntry
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if key.Value == "profiles" {
+			continue
+		}
+		values, err := configValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %s", file, key.Line, key.Value, err)
+		}
+		entries = append(entries, configEntry{Key: key.Value, Line: key.Line, Values: values})
+	}
+	return entries, nil
+}
+
+func configValues(node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		var values []string
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("expected a list of values")
+			}
+			values = append(values, item.Value)
+		}
+		return values, nil
+	case yaml.MappingNode:
+		var values []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			switch value.Kind {
+			case yaml.ScalarNode:
+				values = append(values, key+"="+value.Value)
+			case yaml.MappingNode:
+				var options []string
+				for j := 0; j+1 < len(value.Content); j += 2 {
+					options = append(options, value.Content[j].Value+":"+value.Content[j+1].Value)
+				}
+				values = append(values, key+"="+strings.Join(options, ","))
+			case yaml.SequenceNode:
+				var items []string
+				for _, item := range value.Content {
+					items = append(items, item.Value)
+				}
+				values = append(values, key+"="+strings.Join(items, ","))
+			default:
+				return nil, fmt.Errorf("unsupported value of %s", key)
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported value")
+}
+
+// lookupFlag finds the flag for a config key in cmd or, failing that, in any
+// other command. known is false for keys no command has.
+func lookupFlag(cmd *cobra.Command, name string) (flag *pflag.Flag, known bool) {
+	if flag := cmd.Flags().Lookup(name); flag != nil {
+		return flag, true
+	}
+	var find func(c *cobra.Command) bool
+	find = func(c *cobra.Command) bool {
+		if c.Flags().Lookup(name) != nil || c.PersistentFlags().Lookup(name) != nil {
+			return true
+		}
+		for _, sub := range c.Commands() {
+			if find(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return nil, find(cmd.Root())
+}
+
+// applyConfig sets the flags of cmd from the config file. Flags given on the
+// command line win, keys of other commands' flags are skipped.
+func applyConfig(cmd *cobra.Command, entries []configEntry) []error {
+	var errs []error
+	for _, entry := range entries {
+		flag, known := lookupFlag(cmd, entry.Key)
+		if !known {
+			errs = append(errs, fmt.Errorf("%s:%d: unknown key %s", configFile, entry.Line, entry.Key))
+			continue
+		}
+		if flag == nil || flag.Changed {
+			continue
+		}
+		for _, value := range entry.Values {
+			if err := flag.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: invalid %s: %s", configFile, entry.Line, entry.Key, err))
+				break
+			}
+		}
+		flag.Changed = true
+		configured[flag] = true
+	}
+	return errs
+}
+
+// resetConfiguredFlags sets the flags taken from the config file back to
+// their defaults, so keys removed from it are unset by a reload.
+func resetConfiguredFlags() {
+	for flag := range configured {
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			var values []string
+			if def := strings.Trim(flag.DefValue, "[]"); def != "" {
+				values = strings.Split(def, ",")
+			}
+			slice.Replace(values)
+		} else {
+			flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	}
+	configured = make(map[*pflag.Flag]bool)
+}
+
+// envPrefix is the prefix of the environment variables setting flags, e.g.
+// MD_DOWNLOADER_REPO for --repo.
+const envPrefix = "MD_DOWNLOADER_"
+
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyEnv sets the flags of cmd that have an environment variable. They
+// win over the config file and lose to the command line. Flags taking
+// several values take one per line.
+func applyEnv(cmd *cobra.Command) []error {
+	var errs []error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		value, ok := os.LookupEnv(envName(flag.Name))
+		if !ok || flag.Changed {
+			return
+		}
+		values := []string{value}
+		if _, ok := flag.Value.(pflag.SliceValue); ok {
+			values = nil
+			for _, line := range strings.Split(value, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					values = append(values, line)
+				}
+			}
+		}
+		for _, v := range values {
+			if err := flag.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %s", envName(flag.Name), err))
+				return
+			}
+		}
+		flag.Changed = true
+	})
+	return errs
+}
+
+func loadConfig(cmd *cobra.Command, args []string) {
+	if errs := applyEnv(cmd); len(errs) > 0 {
+		for _, err := range errs {
+			log.Errorf("%s\n", err)
+		}
+		os.Exit(exitUsage)
+	}
+	if configFile == "" {
+		if profile != "" {
+			log.Errorf("--profile needs a config file given with --config\n")
+			os.Exit(exitUsage)
+		}
+		return
+	}
+	entries, err := readConfig(configFile)
+	if err != nil {
+		log.Errorf("Failed to read config: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if errs := applyConfig(cmd, entries); len(errs) > 0 {
+		for _, err := range errs {
+			log.Errorf("%s\n", err)
+		}
+		os.Exit(exitUsage)
+	}
+}
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Check the config file",
+		// The subcommands read the config file themselves.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	var network bool
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Report every problem of the config file at once",
+		Run: func(cmd *cobra.Command, args []string) {
+			if configFile == "" {
+				log.Errorf("No config file given, set it with --config\n")
+				os.Exit(exitUsage)
+			}
+			problems := validateConfig(cmd, network)
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			if len(problems) > 0 {
+				fmt.Printf("%d problems in %s\n", len(problems), configFile)
+				os.Exit(exitUsage)
+			}
+			fmt.Printf("%s is valid\n", configFile)
+		},
+	}
+	validate.Flags().BoolVar(&network, "network", false, "Also check that the hosts of the repositories are reachable")
+
+	cmd.AddCommand(validate)
+	cmd.AddCommand(newConfigSchemaCmd())
+	return cmd
+}
+
+func validateConfig(cmd *cobra.Command, network bool) []string {
+	entries, err := readConfig(configFile)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	for _, err := range applyConfig(cmd.Root(), entries) {
+		problems = append(problems, err.Error())
+	}
+	parseIgnorePaths()
+	for _, parse := range []func() error{parseIgnoreFiles, parseHeaders, parseProviders, parseTokens, parseHostLimits, parseResolves, parseProxy, parseTransforms, parseRedactions, parseValidations, parseSecretScan, parseTranslator, checkConfigMaps} {
+		if err := parse(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if since != "" {
+		if _, err := parseSince(since); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	hosts := make(map[string]bool)
+	for _, repo := range cfg.Repos {
+		host, err := validateRepo(repo)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid repo %s: %s", repo, err))
+		} else if host != "" {
+			hosts[host] = true
+		}
+	}
+	problems = append(problems, validateIgnoreRules()...)
+
+	if network {
+		client := &http.Client{Transport: httpClient().Transport, Timeout: 10 * time.Second}
+		for host := range hosts {
+			resp, err := client.Head("https://" + host)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("host %s is unreachable: %s", host, err))
+				continue
+			}
+			resp.Body.Close()
+		}
+	}
+	return problems
+}
+
+// validateRepo checks a repository identifier and returns the host it is
+// fetched from, empty for local repositories.
+func validateRepo(repo string) (string, error) {
+	switch {
+	case isLocalRepo(repo):
+		path, _ := parseLocalRepo(repo)
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return "", nil
+	case isGist(repo):
+		if strings.TrimPrefix(repo, gistPrefix) == "" {
+			return "", fmt.Errorf("missing gist id")
+		}
+		return "api.github.com", nil
+	case strings.Contains(repo, "://"):
+		remote, err := parseRemoteRepo(repo)
+		if err != nil {
+			return "", err
+		}
+		return remote.Host, nil
+	}
+	segments := strings.Split(repo, "/")
+	if len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+		return "", fmt.Errorf("expected owner/name or a URL")
+	}
+	return "api.github.com", nil
+}
+
+// validateIgnoreRules reports ignore rules that are malformed, for
+// repositories that aren't synced, repeated, or for paths --include already
+// excludes.
+func validateIgnoreRules() []string {
+	repos := make(map[string]bool)
+	for _, repo := range cfg.Repos {
+		repos[repo] = true
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for _, rule := range ignore {
+		split := strings.LastIndex(rule, ":")
+		if split < 0 {
+			problems = append(problems, fmt.Sprintf("invalid ignore rule %s, expected repo:pattern", rule))
+			continue
+		}
+		repo := rule[:split]
+		if !repos[repo] {
+			problems = append(problems, fmt.Sprintf("ignore rule %s is for %s, which isn't a configured repo", rule, repo))
+		}
+		for _, path := range strings.Split(rule[split+1:], ",") {
+			key := repo + ":" + path
+			if seen[key] {
+				problems = append(problems, fmt.Sprintf("%s is ignored more than once", key))
+			}
+			seen[key] = true
+			// Only literal paths can be checked against --include.
+			if strings.ContainsAny(path, "*?[!") || !strings.Contains(path, "/") {
+				continue
+			}
+			if !isDocFile(strings.TrimPrefix(path, "/")) {
+				problems = append(problems, fmt.Sprintf("ignore rule %s never applies, %s isn't synced with the configured --include", rule, path))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	configMapsPerRepo = "repo"
+	configMapsPerFile = "file"
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// configMapLimit keeps the data of a ConfigMap below the 1MiB etcd limits
+	// with room for the metadata.
+	configMapLimit = 1000000
+
+	configMapManagedBy = "app.kubernetes.io/managed-by"
+	configMapPrefixKey = "md-downloader/prefix"
+	configMapPathKey   = "md-downloader/path"
+)
+
+var (
+	invalidConfigMapName = regexp.MustCompile(`[^a-z0-9-]+`)
+	configMapPrefixRe    = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$`)
+)
+
+func checkConfigMaps() error {
+	if cfg.ConfigMaps == "" {
+		return nil
+	}
+	if cfg.ConfigMaps != configMapsPerRepo && cfg.ConfigMaps != configMapsPerFile {
+		return fmt.Errorf("invalid --configmaps %s, expected repo or file", cfg.ConfigMaps)
+	}
+	if !configMapPrefixRe.MatchString(cfg.ConfigMapPrefix) {
+		return fmt.Errorf("invalid --configmap-prefix %s, use up to 40 lowercase letters, digits and dashes", cfg.ConfigMapPrefix)
+	}
+	return nil
+}
+
+type configMap struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   configMapMeta     `json:"metadata"`
+	Data       map[string]string `json:"data,omitempty"`
+	BinaryData map[string][]byte `json:"binaryData,omitempty"`
+}
+
+type configMapMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type kubeClient struct {
+	client    *http.Client
+	api       string
+	namespace string
+	token     string
+}
+
+// writeConfigMaps mirrors the output directory into ConfigMaps, one per
+// repository directory or one per file. Every key is a path with the slashes
+// replaced by "__", which ConfigMap keys can't contain. Groups over the size
+// limit continue in ConfigMaps named -2, -3 and so on, files over it are
+// split into keys ending in .part1, .part2. ConfigMaps of the --configmap-prefix
+// that a sync no longer writes are deleted.
+func writeConfigMaps() {
+	kube, err := newKubeClient()
+	if err != nil {
+		log.Errorf("Failed to connect to Kubernetes: %s\n", err)
+		recordError(err)
+		return
+	}
+	groups, err := configMapGroups()
+	if err != nil {
+		log.Errorf("Failed to read %s for ConfigMaps: %s\n", cfg.Output, err)
+		recordError(err)
+		return
+	}
+
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	written := make(map[string]bool)
+	failed := false
+	for _, group := range names {
+		for _, cm := range packConfigMaps(group, groups[group]) {
+			if err := kube.apply(cm); err != nil {
+				log.Errorf("Failed to write ConfigMap %s: %s\n", cm.Metadata.Name, err)
+				recordError(err)
+				failed = true
+				continue
+			}
+			written[cm.Metadata.Name] = true
+		}
+	}
+	// A ConfigMap that failed to update keeps its old content.
+	if failed {
+		return
+	}
+
+	existing, err := kube.list()
+	if err != nil {
+		log.Errorf("Failed to list ConfigMaps: %s\n", err)
+		recordError(err)
+		return
+	}
+	for _, name := range existing {
+		if written[name] {
+			continue
+		}
+		if err := kube.delete(name); err != nil {
+			log.Errorf("Failed to delete ConfigMap %s: %s\n", name, err)
+			recordError(err)
+			continue
+		}
+		log.Infof("Deleted ConfigMap %s\n", name)
+		audit(auditDelete, "", kube.namespace+"/"+name, "", "ConfigMap no longer written")
+	}
+	log.Infof("Wrote %d ConfigMaps to namespace %s\n", len(written), kube.namespace)
+}
+
+// configMapGroups reads the output directory into the files of each
+// ConfigMap group, keyed by the relative path.
+func configMapGroups() (map[string]map[string][]byte, error) {
+	groups := make(map[string]map[string][]byte)
+	err := filepath.Walk(cfg.Output, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(cfg.Output, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		group := rel
+		if cfg.ConfigMaps == configMapsPerRepo {
+			group = strings.SplitN(rel, "/", 2)[0]
+			if !strings.Contains(rel, "/") {
+				// Files of the whole run like manifest.json.
+				group = ""
+			}
+		}
+		if groups[group] == nil {
+			groups[group] = make(map[string][]byte)
+		}
+		groups[group][rel] = content
+		return nil
+	})
+	return groups, err
+}
+
+// configMapName turns a group into a valid object name, a hash of the group
+// keeps names unique that only differ in characters that were replaced.
+func configMapName(group string, part int) string {
+	name := cfg.ConfigMapPrefix
+	if group != "" {
+		sum := sha256.Sum256([]byte(group))
+		slug := strings.Trim(invalidConfigMapName.ReplaceAllString(strings.ToLower(group), "-"), "-")
+		if len(slug) > 200 {
+			slug = slug[:200]
+		}
+		name += "-" + slug
+		if cfg.ConfigMaps == configMapsPerFile || slug != group {
+			name += "-" + hex.EncodeToString(sum[:4])
+		}
+	}
+	if part > 1 {
+		name += fmt.Sprintf("-%d", part)
+	}
+	return name
+}
+
+func configMapKey(path string) string {
+	return strings.ReplaceAll(path, "/", "__")
+}
+
+// packConfigMaps fills ConfigMaps with the files of a group in path order,
+// starting the next one when the limit would be exceeded.
+func packConfigMaps(group string, files map[string][]byte) []configMap {
+	maps := []configMap{newConfigMap(group, 1)}
+	size := 0
+	add := func(key string, content []byte) {
+		binary := !utf8.Valid(content)
+		encoded := len(content)
+		if binary {
+			encoded = (len(content) + 2) / 3 * 4
+		}
+		if size > 0 && size+len(key)+encoded > configMapLimit {
+			maps = append(maps, newConfigMap(group, len(maps)+1))
+			size = 0
+		}
+		cm := &maps[len(maps)-1]
+		if binary {
+			cm.BinaryData[key] = content
+		} else {
+			cm.Data[key] = string(content)
+		}
+		size += len(key) + encoded
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	// Parts are raw byte ranges, applications join them in order.
+	partSize := configMapLimit * 3 / 4
+	for _, path := range paths {
+		content, key := files[path], configMapKey(path)
+		if len(content) <= partSize {
+			add(key, content)
+			continue
+		}
+		for part := 1; len(content) > 0; part++ {
+			n := partSize
+			if n > len(content) {
+				n = len(content)
+			}
+			add(fmt.Sprintf("%s.part%d", key, part), content[:n])
+			content = content[n:]
+		}
+	}
+	return maps
+}
+
+func newConfigMap(group string, part int) configMap {
+	cm := configMap{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata: configMapMeta{
+			Name: configMapName(group, part),
+			Labels: map[string]string{
+				configMapManagedBy: "md-downloader",
+				configMapPrefixKey: cfg.ConfigMapPrefix,
+			},
+		},
+		Data:       make(map[string]string),
+		BinaryData: make(map[string][]byte),
+	}
+	if group != "" {
+		cm.Metadata.Annotations = map[string]string{configMapPathKey: group}
+	}
+	return cm
+}
+
+// newKubeClient talks to the API server of --kube-api, or the one of the
+// cluster with the service account of the pod. Outside of a cluster the
+// token comes from --token host=TOKEN.
+func newKubeClient() (*kubeClient, error) {
+	kube := &kubeClient{api: strings.TrimSuffix(cfg.KubeAPI, "/"), namespace: cfg.Namespace}
+	if kube.api == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("not running in a cluster, set --kube-api")
+		}
+		kube.api = "https://" + net.JoinHostPort(host, port)
+	}
+	u, err := url.Parse(kube.api)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid --kube-api %s", cfg.KubeAPI)
+	}
+
+	transport := newTransport()
+	if ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")); err == nil {
+		pool, _ := x509.SystemCertPool()
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pool.AppendCertsFromPEM(ca)
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	kube.client = &http.Client{Transport: transport}
+
+	// Service account tokens are rotated, they are read on every sync.
+	if token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token")); err == nil {
+		kube.token = strings.TrimSpace(string(token))
+	} else {
+		kube.token = tokenFor(u.Host)
+	}
+	if kube.namespace == "" {
+		namespace, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("no namespace, set --namespace")
+		}
+		kube.namespace = strings.TrimSpace(string(namespace))
+	}
+	return kube, nil
+}
+
+func (k *kubeClient) do(method, path string, body interface{}) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, k.api+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+	return k.client.Do(req)
+}
+
+func (k *kubeClient) configMapsPath() string {
+	return "/api/v1/namespaces/" + url.PathEscape(k.namespace) + "/configmaps"
+}
+
+// apply replaces the ConfigMap, creating it when it doesn't exist yet.
+func (k *kubeClient) apply(cm configMap) error {
+	cm.Metadata.Namespace = k.namespace
+	resp, err := k.do(http.MethodPut, k.configMapsPath()+"/"+cm.Metadata.Name, cm)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		if resp, err = k.do(http.MethodPost, k.configMapsPath(), cm); err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return httpStatusError(resp)
+	}
+	return nil
+}
+
+// list returns the names of the ConfigMaps written with the same prefix.
+func (k *kubeClient) list() ([]string, error) {
+	selector := url.QueryEscape(configMapManagedBy + "=md-downloader," + configMapPrefixKey + "=" + cfg.ConfigMapPrefix)
+	resp, err := k.do(http.MethodGet, k.configMapsPath()+"?labelSelector="+selector, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpStatusError(resp)
+	}
+	var list struct {
+		Items []struct {
+			Metadata configMapMeta `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.Metadata.Name)
+	}
+	return names, nil
+}
+
+func (k *kubeClient) delete(name string) error {
+	resp, err := k.do(http.MethodDelete, k.configMapsPath()+"/"+name, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return httpStatusError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+const keyringService = "md-downloader"
+
+var storedTokens = struct {
+	sync.Mutex
+	tokens map[string]string
+}{tokens: make(map[string]string)}
+
+// storedToken looks up the token of a host in the OS keyring and then asks
+// the credential helper. Results are cached for the rest of the run.
+func storedToken(host string) string {
+	storedTokens.Lock()
+	defer storedTokens.Unlock()
+	if token, ok := storedTokens.tokens[host]; ok {
+		return token
+	}
+
+	token := keyringToken(host)
+	if token == "" {
+		token = helperToken(host)
+	}
+	storedTokens.tokens[host] = token
+	return token
+}
+
+func keyringToken(host string) string {
+	token, err := keyring.Get(keyringService, host)
+	if err != nil {
+		if err != keyring.ErrNotFound {
+			log.Debugf("Failed to read token from keyring: %s\n", err)
+		}
+		return ""
+	}
+	return token
+}
+
+// helperToken asks the external credential helper for the token of a host.
+// It speaks git's credential helper protocol, so existing helpers work: the
+// command is run with "get" and the password line of its output is used.
+func helperToken(host string) string {
+	if cfg.CredentialHelper == "" {
+		return ""
+	}
+
+	cmd := exec.Command("sh", "-c", cfg.CredentialHelper+" get")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\n\n", host))
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		log.Errorf("Credential helper failed for %s: %s\n", host, err)
+		return ""
+	}
+
+	token := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if value := strings.TrimPrefix(scanner.Text(), "password="); value != scanner.Text() {
+			token = value
+		}
+	}
+	if token == "" {
+		log.Warnf("Credential helper returned no token for %s\n", host)
+	}
+	return token
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted state files start with this header, followed by the scrypt salt,
+// the GCM nonce and the sealed JSON.
+const encryptedHeader = "md-downloader-encrypted-v1\n"
+
+const passphraseEnv = "MD_DOWNLOADER_PASSPHRASE"
+
+func encryptionEnabled() bool {
+	return cfg.KeyFile != "" || os.Getenv(passphraseEnv) != ""
+}
+
+// stateKeys caches the keys derived for each salt, scrypt is too slow to run
+// for every save of the progress file. Files written by one run share a
+// salt, with a new nonce for each of them.
+var stateKeys = struct {
+	sync.Mutex
+	keys      map[string][]byte
+	writeSalt []byte
+}{keys: make(map[string][]byte)}
+
+func stateKey(salt []byte) ([]byte, error) {
+	stateKeys.Lock()
+	defer stateKeys.Unlock()
+	id := cfg.KeyFile + "\x00" + os.Getenv(passphraseEnv) + "\x00" + string(salt)
+	if key, ok := stateKeys.keys[id]; ok {
+		return key, nil
+	}
+	var key []byte
+	if cfg.KeyFile != "" {
+		keyFile, err := ioutil.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		h.Write(salt)
+		h.Write(bytes.TrimSpace(keyFile))
+		key = h.Sum(nil)
+	} else {
+		var err error
+		key, err = scrypt.Key([]byte(os.Getenv(passphraseEnv)), salt, 1<<15, 8, 1, 32)
+		if err != nil {
+			return nil, err
+		}
+	}
+	stateKeys.keys[id] = key
+	return key, nil
+}
+
+func writeSalt() ([]byte, error) {
+	stateKeys.Lock()
+	defer stateKeys.Unlock()
+	if stateKeys.writeSalt == nil {
+		salt := make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, err
+		}
+		stateKeys.writeSalt = salt
+	}
+	return stateKeys.writeSalt, nil
+}
+
+// readStateFile reads a history or state file, decrypting it when it was
+// written encrypted. Plain files are still read so enabling encryption
+// doesn't lose existing state, they are encrypted on the next save.
+func readStateFile(path string) ([]byte, error) {
+	data, err := readState(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(encryptedHeader)) {
+		return data, nil
+	}
+	if !encryptionEnabled() {
+		return nil, fmt.Errorf("%s is encrypted, set --key-file or %s", path, passphraseEnv)
+	}
+
+	data = data[len(encryptedHeader):]
+	if len(data) < 16 {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	// Copied, the salt must not share its backing array with the rest of the
+	// file.
+	salt := append([]byte(nil), data[:16]...)
+	data = data[16:]
+
+	gcm, err := stateCipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, data, []byte(encryptedHeader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s, wrong key?", path)
+	}
+	return plain, nil
+}
+
+func writeStateFile(path string, data []byte) error {
+	if !encryptionEnabled() {
+		// Don't replace an encrypted file with a plain one just because the
+		// key was missing on this run. Remote state isn't read again, that
+		// would pick up the ETag of a state another run saved meanwhile.
+		if existing, err := ioutil.ReadFile(path); err == nil && bytes.HasPrefix(existing, []byte(encryptedHeader)) {
+			return fmt.Errorf("%s is encrypted, set --key-file or %s", path, passphraseEnv)
+		}
+	} else {
+		salt, err := writeSalt()
+		if err != nil {
+			return err
+		}
+		gcm, err := stateCipher(salt)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return err
+		}
+
+		sealed := []byte(encryptedHeader)
+		sealed = append(sealed, salt...)
+		sealed = append(sealed, nonce...)
+		data = gcm.Seal(sealed, nonce, data, []byte(encryptedHeader))
+	}
+
+	return writeState(path, data)
+}
+
+func stateCipher(salt []byte) (cipher.AEAD, error) {
+	key, err := stateKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
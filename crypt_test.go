@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("secret key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		keyFile    string
+		passphrase string
+	}{
+		{"key file", keyFile, ""},
+		{"passphrase", "", "correct horse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.KeyFile = tt.keyFile
+			t.Setenv(passphraseEnv, tt.passphrase)
+			defer func() { cfg.KeyFile = "" }()
+
+			path := filepath.Join(dir, tt.name+".json")
+			for _, data := range [][]byte{[]byte(`{"version":2}`), []byte(`{"version":2,"files":{}}`)} {
+				if err := writeStateFile(path, data); err != nil {
+					t.Fatal(err)
+				}
+				written, _ := ioutil.ReadFile(path)
+				if !bytes.HasPrefix(written, []byte(encryptedHeader)) || bytes.Contains(written, data) {
+					t.Fatalf("%s isn't encrypted", path)
+				}
+				read, err := readStateFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(read, data) {
+					t.Fatalf("read %q, want %q", read, data)
+				}
+			}
+		})
+	}
+}
+
+func TestStateFileWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	t.Setenv(passphraseEnv, "one")
+	if err := writeStateFile(path, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(passphraseEnv, "two")
+	if _, err := readStateFile(path); err == nil {
+		t.Fatal("decrypted with the wrong passphrase")
+	}
+}
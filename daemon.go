@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const defaultPIDFile = "md-downloader.pid"
+
+// daemonCommands can be run in the background with daemon start.
+var daemonCommands = map[string]bool{"watch": true, "serve": true}
+
+// reloadRequests receives a value for every SIGHUP of a daemon, the sync loop
+// reloads the config file between syncs. It is nil outside of daemons.
+var reloadRequests chan struct{}
+
+// stopRequests is closed on the first SIGTERM or SIGINT of a daemon. A sync
+// in progress stops after the current file, it is resumed by the next start,
+// and the daemon exits once it has.
+var stopRequests = make(chan struct{})
+
+// syncLoops counts the running watchRepos loops, the daemon exits right away
+// when there is none to wait for.
+var syncLoops int32
+
+var daemonCmd *cobra.Command
+
+func newDaemonCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run watch or serve in the background and control it through its PID file",
+	}
+
+	var logFile string
+	start := &cobra.Command{
+		Use:   "start -- <watch|serve> [flags]",
+		Short: "Start a command in the background",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !daemonCommands[args[0]] {
+				log.Errorf("Only watch and serve can run as a daemon, not %s\n", args[0])
+				os.Exit(exitUsage)
+			}
+			if pid, ok := runningPID(); ok {
+				log.Errorf("Already running with pid %d\n", pid)
+				os.Exit(1)
+			}
+			pid, err := startDaemon(args, logFile)
+			if err != nil {
+				log.Errorf("Failed to start %s: %s\n", args[0], err)
+				os.Exit(1)
+			}
+			fmt.Printf("Started %s with pid %d, logging to %s\n", args[0], pid, logFile)
+		},
+	}
+	start.Flags().StringVar(&logFile, "log-file", "md-downloader.log", "File the output of the daemon is appended to")
+
+	stop := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the daemon and wait for it to exit",
+		Run: func(cmd *cobra.Command, args []string) {
+			pid, ok := runningPID()
+			if !ok {
+				fmt.Println("Not running")
+				return
+			}
+			if err := signalProcess(pid, syscall.SIGTERM); err != nil {
+				log.Errorf("Failed to stop pid %d: %s\n", pid, err)
+				os.Exit(1)
+			}
+			for i := 0; i < 100 && processAlive(pid); i++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+			if processAlive(pid) {
+				log.Errorf("Pid %d is still running after 10s\n", pid)
+				os.Exit(1)
+			}
+			os.Remove(pidFile())
+			fmt.Printf("Stopped pid %d\n", pid)
+		},
+	}
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "Print whether the daemon is running, exits with 3 when it isn't",
+		Run: func(cmd *cobra.Command, args []string) {
+			pid, ok := runningPID()
+			if !ok {
+				fmt.Println("Not running")
+				// The LSB status code for a stopped service.
+				os.Exit(3)
+			}
+			fmt.Printf("Running with pid %d\n", pid)
+		},
+	}
+
+	reload := &cobra.Command{
+		Use:   "reload",
+		Short: "Make the daemon read its config file again",
+		Run: func(cmd *cobra.Command, args []string) {
+			pid, ok := runningPID()
+			if !ok {
+				log.Errorf("Not running\n")
+				os.Exit(1)
+			}
+			if err := signalProcess(pid, syscall.SIGHUP); err != nil {
+				log.Errorf("Failed to reload pid %d: %s\n", pid, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Asked pid %d to reload its config\n", pid)
+		},
+	}
+
+	cmd.AddCommand(start, stop, status, reload)
+	return cmd
+}
+
+func pidFile() string {
+	if cfg.PIDFile != "" {
+		return cfg.PIDFile
+	}
+	return defaultPIDFile
+}
+
+// runningPID returns the pid of the PID file if that process is running.
+func runningPID() (int, bool) {
+	data, err := ioutil.ReadFile(pidFile())
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || !processAlive(pid) {
+		return 0, false
+	}
+	return pid, true
+}
+
+// startDaemon runs the command detached from the terminal and waits for it
+// to write its PID file.
+func startDaemon(args []string, logFile string) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	os.Remove(pidFile())
+	child := exec.Command(executable, append(args, "--pid-file", pidFile())...)
+	child.Stdout = out
+	child.Stderr = out
+	child.SysProcAttr = detachedProcess()
+	if err := child.Start(); err != nil {
+		return 0, err
+	}
+	pid := child.Process.Pid
+	child.Process.Release()
+
+	for i := 0; i < 50; i++ {
+		if running, ok := runningPID(); ok && running == pid {
+			return pid, nil
+		}
+		if !processAlive(pid) {
+			return 0, fmt.Errorf("exited right away, see %s", logFile)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return pid, nil
+}
+
+// runAsDaemon writes the --pid-file of a long running command, removing it
+// again when it stops on SIGTERM or SIGINT, and turns SIGHUP into config
+// reloads. Services of systemd get the same without a PID file.
+func runAsDaemon(cmd *cobra.Command) {
+	if cfg.PIDFile == "" && os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	if cfg.PIDFile != "" {
+		if err := ioutil.WriteFile(cfg.PIDFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			log.Warnf("Failed to write pid file %s: %s\n", cfg.PIDFile, err)
+		}
+	}
+	daemonCmd = cmd
+	reloadRequests = make(chan struct{}, 1)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		for sig := range signals {
+			if sig != syscall.SIGHUP {
+				if stopping() {
+					log.Warnf("Stopping right away on a second %s\n", sig)
+					exitDaemon()
+				}
+				log.Infof("Stopping on %s\n", sig)
+				sdNotify(sdStopping)
+				close(stopRequests)
+				if atomic.LoadInt32(&syncLoops) == 0 {
+					exitDaemon()
+				}
+				continue
+			}
+			log.Infof("Reloading the config before the next sync\n")
+			select {
+			case reloadRequests <- struct{}{}:
+			default:
+			}
+		}
+	}()
+}
+
+func stopping() bool {
+	select {
+	case <-stopRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+func exitDaemon() {
+	if cfg.PIDFile != "" {
+		os.Remove(cfg.PIDFile)
+	}
+	os.Exit(exitOK)
+}
+
+// flagState is the value of a flag before a reload.
+type flagState struct {
+	flag    *pflag.Flag
+	values  []string
+	changed bool
+}
+
+func saveFlags(cmd *cobra.Command) []flagState {
+	var states []flagState
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		state := flagState{flag: flag, values: []string{flag.Value.String()}, changed: flag.Changed}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			state.values = slice.GetSlice()
+		}
+		states = append(states, state)
+	})
+	return states
+}
+
+func restoreFlags(states []flagState) {
+	for _, state := range states {
+		if slice, ok := state.flag.Value.(pflag.SliceValue); ok {
+			slice.Replace(state.values)
+		} else {
+			state.flag.Value.Set(state.values[0])
+		}
+		state.flag.Changed = state.changed
+	}
+}
+
+// reloadConfig applies the config file again after a SIGHUP. When it can't
+// be read or the new config is invalid the daemon keeps running with the old
+// one.
+func reloadConfig() {
+	if configFile == "" {
+		log.Warnf("No config file to reload, start the daemon with --config\n")
+		return
+	}
+	entries, err := readConfig(configFile)
+	if err != nil {
+		log.Errorf("Failed to reload config, keeping the old one: %s\n", err)
+		return
+	}
+	sdNotify(sdReloading)
+	defer sdNotify(sdReady)
+	saved, savedConfigured := saveFlags(daemonCmd), configured
+	resetConfiguredFlags()
+	errs := applyConfig(daemonCmd, entries)
+	for _, err := range errs {
+		log.Errorf("%s\n", err)
+	}
+	// The shared client captured the network settings of the old config,
+	// setup resolves secret references in tokens with a new one.
+	resetHTTPClient()
+	if len(errs) == 0 && setup() {
+		return
+	}
+	log.Errorf("The reloaded config is invalid, keeping the old one\n")
+	restoreFlags(saved)
+	configured = savedConfigured
+	resetHTTPClient()
+	setup()
+}
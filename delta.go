@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// The compare API stops listing files after this many entries.
+const compareFileLimit = 300
+
+// ListChanges lists the files changed between base and the current head of
+// ref. It reports false when the changes can't be determined from the compare
+// API (rewritten history, truncated results).
+func (p *githubProvider) ListChanges(base, ref string) ([]treeItem, string, bool) {
+	repo := p.repo
+	compareURL := fmt.Sprintf("%s/repos/%s/compare/%s...%s", apiURL, repo, base, ref)
+
+	req := newAPIRequest(compareURL)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return nil, "", false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Warnf("Failed to compare %s with %s (%s), listing the full tree\n", repo, base, resp.Status)
+		return nil, "", false
+	}
+
+	var comparison struct {
+		Status       string `json:"status"`
+		TotalCommits int    `json:"total_commits"`
+		Commits      []struct {
+			Sha string `json:"sha"`
+		} `json:"commits"`
+		Files []struct {
+			Sha              string `json:"sha"`
+			Filename         string `json:"filename"`
+			PreviousFilename string `json:"previous_filename"`
+			Status           string `json:"status"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&comparison); err != nil {
+		log.Errorf("Failed to decode response JSON: %s\n", err)
+		return nil, "", false
+	}
+
+	if comparison.Status == "diverged" || comparison.Status == "behind" {
+		log.Warnf("History of %s was rewritten since %s, listing the full tree\n", repo, base)
+		return nil, "", false
+	}
+	if comparison.TotalCommits == 0 {
+		return nil, base, true
+	}
+	if comparison.TotalCommits > len(comparison.Commits) || len(comparison.Files) >= compareFileLimit {
+		log.Infof("Too many changes in %s since %s, listing the full tree\n", repo, base)
+		return nil, "", false
+	}
+
+	var items []treeItem
+	for _, file := range comparison.Files {
+		if file.Status == "removed" {
+			items = append(items, treeItem{Path: file.Filename, Type: "removed"})
+			continue
+		}
+		if file.Sha == "" {
+			continue
+		}
+		items = append(items, treeItem{
+			Path:         file.Filename,
+			Type:         "blob",
+			Sha:          file.Sha,
+			Url:          fmt.Sprintf("%s/repos/%s/git/blobs/%s", apiURL, repo, file.Sha),
+			PreviousPath: file.PreviousFilename,
+		})
+	}
+	head := comparison.Commits[len(comparison.Commits)-1].Sha
+
+	return items, head, true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"html"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var plantUMLEncoding = base64.NewEncoding("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_").WithPadding(base64.NoPadding)
+
+var kindDiagram = ast.NewNodeKind("Diagram")
+
+// diagramBlock replaces a mermaid or plantuml fenced code block so it isn't
+// highlighted as code.
+type diagramBlock struct {
+	ast.BaseBlock
+	Language string
+	Source   string
+}
+
+func (n *diagramBlock) Kind() ast.NodeKind {
+	return kindDiagram
+}
+
+func (n *diagramBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Language": n.Language}, nil)
+}
+
+// diagrams renders mermaid blocks for mermaid.js in the browser and plantuml
+// blocks as SVG images from a PlantUML server. Without a server, plantuml
+// blocks stay code blocks, their source isn't sent anywhere.
+type diagrams struct {
+	plantUMLServer string
+}
+
+func (d *diagrams) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(d, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(d, 100)))
+}
+
+func (d *diagrams) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := n.(*ast.FencedCodeBlock); ok && entering {
+			language := string(block.Language(source))
+			plantUML := language == "plantuml" || language == "puml"
+			if language == "mermaid" || plantUML && d.plantUMLServer != "" {
+				blocks = append(blocks, block)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		var code strings.Builder
+		lines := block.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			code.Write(segment.Value(source))
+		}
+		diagram := &diagramBlock{Language: string(block.Language(source)), Source: code.String()}
+		block.Parent().ReplaceChild(block.Parent(), block, diagram)
+	}
+}
+
+func (d *diagrams) RegisterFuncs(r renderer.NodeRendererFuncRegisterer) {
+	r.Register(kindDiagram, d.render)
+}
+
+func (d *diagrams) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	diagram := n.(*diagramBlock)
+	if diagram.Language == "mermaid" {
+		w.WriteString(`<pre class="mermaid">`)
+		w.WriteString(html.EscapeString(diagram.Source))
+		w.WriteString("</pre>\n")
+		return ast.WalkSkipChildren, nil
+	}
+
+	encoded, err := encodePlantUML(diagram.Source)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	w.WriteString(`<p><img class="plantuml" alt="PlantUML diagram" src="`)
+	w.WriteString(html.EscapeString(strings.TrimSuffix(d.plantUMLServer, "/") + "/svg/" + encoded))
+	w.WriteString("\"></p>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// encodePlantUML encodes a diagram the way PlantUML servers expect it in the
+// URL: deflated, then base64 with PlantUML's own alphabet.
+func encodePlantUML(source string) (string, error) {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	writer.Write([]byte(source))
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return plantUMLEncoding.EncodeToString(buf.Bytes()), nil
+}
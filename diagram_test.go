@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiagrams(t *testing.T) {
+	source := []byte("```plantuml\nA -> B\n```\n\n```mermaid\ngraph TD; A-->B\n```\n")
+	tests := []struct {
+		name   string
+		server string
+		want   []string
+		absent []string
+	}{
+		{"no server", "", []string{`<pre class="mermaid">`, "A -&gt; B"}, []string{"<img"}},
+		{"server", "https://plantuml.example/", []string{`<pre class="mermaid">`, `<img class="plantuml" alt="PlantUML diagram" src="https://plantuml.example/svg/`}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := newMarkdown("none", tt.server).Convert(source, &out); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("missing %q in %s", want, out.String())
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(out.String(), absent) {
+					t.Errorf("unexpected %q in %s", absent, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestMermaidScript(t *testing.T) {
+	defer func() { mermaidScript = defaultMermaidScript }()
+	for _, script := range []string{"/_theme/mermaid.mjs", ""} {
+		mermaidScript = script
+		var out bytes.Buffer
+		if err := templates.ExecuteTemplate(&out, "end", page{}); err != nil {
+			t.Fatal(err)
+		}
+		loaded := strings.Contains(out.String(), `import("/_theme/mermaid.mjs")`)
+		if loaded != (script != "") {
+			t.Errorf("script %q: got %s", script, out.String())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"golang.org/x/term"
+)
+
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorFaint = "\x1b[2m"
+	colorReset = "\x1b[0m"
+)
+
+// printDiff prints how a file changed compared to the version on disk, as
+// added and removed line counts or with --verbose every changed line.
+func printDiff(filePath, dest string, content []byte) {
+	old, err := ioutil.ReadFile(dest)
+	if err != nil {
+		return
+	}
+
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToChars(string(old), string(content))
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+
+	added, removed := 0, 0
+	for _, d := range diffs {
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			added += countLines(d.Text)
+		case diffmatchpatch.DiffDelete:
+			removed += countLines(d.Text)
+		}
+	}
+	if added == 0 && removed == 0 {
+		return
+	}
+
+	color := useColor()
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + colorReset
+	}
+
+	fmt.Printf("%s %s %s\n", filePath, paint(colorGreen, fmt.Sprintf("+%d", added)), paint(colorRed, fmt.Sprintf("-%d", removed)))
+	if !cfg.Verbose {
+		return
+	}
+	for _, d := range diffs {
+		prefix, code := "", ""
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			prefix, code = "+", colorGreen
+		case diffmatchpatch.DiffDelete:
+			prefix, code = "-", colorRed
+		default:
+			fmt.Println(paint(colorFaint, fmt.Sprintf("  ... (%d unchanged)", countLines(d.Text))))
+			continue
+		}
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(d.Text, "\n"), "\n") {
+			fmt.Println(paint(code, prefix+" "+strings.TrimSuffix(line, "\n")))
+		}
+	}
+}
+
+func countLines(text string) int {
+	n := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		n++
+	}
+	return n
+}
+
+// useColor reports whether stdout is a terminal and NO_COLOR isn't set.
+func useColor() bool {
+	return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+type discoveredRepo struct {
+	FullName    string `json:"full_name"`
+	Description string `json:"description"`
+	Fork        bool   `json:"fork"`
+	Archived    bool   `json:"archived"`
+}
+
+func newDiscoverCmd() *cobra.Command {
+	var interactive, forks, archived bool
+
+	cmd := &cobra.Command{
+		Use:   "discover <user or org>",
+		Short: "List the GitHub repositories of a user or organization and add them to the config",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !setup() {
+				os.Exit(exitUsage)
+			}
+
+			repos, err := discoverRepos(args[0], forks, archived)
+			if err != nil {
+				recordError(err)
+				os.Exit(reportErrors())
+			}
+			if len(repos) == 0 {
+				log.Infof("No repositories found for %s\n", args[0])
+				return
+			}
+
+			if interactive {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					log.Errorf("--interactive needs a terminal\n")
+					os.Exit(exitUsage)
+				}
+				if repos = selectRepos(repos, os.Stdin, os.Stderr); repos == nil {
+					return
+				}
+			}
+
+			var names []string
+			for _, repo := range repos {
+				names = append(names, repo.FullName)
+			}
+			if configFile == "" {
+				for _, name := range names {
+					fmt.Println(name)
+				}
+				return
+			}
+			added, err := addReposToConfig(configFile, names)
+			if err != nil {
+				log.Errorf("Failed to update %s: %s\n", configFile, err)
+				return
+			}
+			log.Infof("Added %d repositories to %s\n", added, configFile)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Choose the repositories to add from a searchable list")
+	cmd.Flags().BoolVar(&forks, "forks", false, "Also list forks")
+	cmd.Flags().BoolVar(&archived, "archived", false, "Also list archived repositories")
+
+	return cmd
+}
+
+// discoverRepos lists the repositories of a user or organization. The users
+// endpoint only lists the public ones of an organization, its own endpoint
+// also the private and internal ones the token can see.
+func discoverRepos(owner string, forks, archived bool) ([]discoveredRepo, error) {
+	client := httpClient()
+	var account struct {
+		Type string `json:"type"`
+	}
+	if err := getJSON(client, fmt.Sprintf("%s/users/%s", apiURL, owner), &account); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/users/%s/repos?per_page=100", apiURL, owner)
+	if account.Type == "Organization" {
+		endpoint = fmt.Sprintf("%s/orgs/%s/repos?type=all&per_page=100", apiURL, owner)
+	}
+
+	var repos []discoveredRepo
+	for page := 1; ; page++ {
+		var list []discoveredRepo
+		if err := getJSON(client, fmt.Sprintf("%s&page=%d", endpoint, page), &list); err != nil {
+			return nil, err
+		}
+		for _, repo := range list {
+			if (repo.Fork && !forks) || (repo.Archived && !archived) {
+				continue
+			}
+			repos = append(repos, repo)
+		}
+		if len(list) < 100 {
+			break
+		}
+	}
+	return repos, nil
+}
+
+// selectRepos is a line based multi-select: numbers and ranges toggle
+// repositories, /text filters the list, a and n select all or none of the
+// listed ones, an empty line accepts and q aborts with nil.
+func selectRepos(repos []discoveredRepo, in io.Reader, out io.Writer) []discoveredRepo {
+	selected := make([]bool, len(repos))
+	filter := ""
+	reader := bufio.NewReader(in)
+
+	for {
+		var shown []int
+		for i, repo := range repos {
+			if filter == "" || strings.Contains(strings.ToLower(repo.FullName+" "+repo.Description), filter) {
+				shown = append(shown, i)
+			}
+		}
+
+		fmt.Fprintln(out)
+		for n, i := range shown {
+			mark := " "
+			if selected[i] {
+				mark = "x"
+			}
+			fmt.Fprintf(out, "%3d [%s] %s", n+1, mark, repos[i].FullName)
+			if repos[i].Description != "" {
+				fmt.Fprintf(out, "  %s", repos[i].Description)
+			}
+			fmt.Fprintln(out)
+		}
+		if filter != "" {
+			fmt.Fprintf(out, "Filter: %s (/ to clear)\n", filter)
+		}
+		fmt.Fprint(out, "Toggle (1 3-5), search (/text), all (a), none (n), done (enter), quit (q): ")
+
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return nil
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+			var chosen []discoveredRepo
+			for i, repo := range repos {
+				if selected[i] {
+					chosen = append(chosen, repo)
+				}
+			}
+			return chosen
+		case line == "q":
+			return nil
+		case strings.HasPrefix(line, "/"):
+			filter = strings.ToLower(strings.TrimSpace(line[1:]))
+		case line == "a" || line == "n":
+			for _, i := range shown {
+				selected[i] = line == "a"
+			}
+		default:
+			var toggle []int
+			for _, field := range strings.Fields(line) {
+				from, to, err := parseRange(field, len(shown))
+				if err != nil {
+					fmt.Fprintf(out, "%s\n", err)
+					toggle = nil
+					break
+				}
+				for n := from; n <= to; n++ {
+					toggle = append(toggle, shown[n-1])
+				}
+			}
+			for _, i := range toggle {
+				selected[i] = !selected[i]
+			}
+		}
+	}
+}
+
+func parseRange(field string, max int) (int, int, error) {
+	bounds := strings.SplitN(field, "-", 2)
+	from, err := strconv.Atoi(bounds[0])
+	to := from
+	if err == nil && len(bounds) == 2 {
+		to, err = strconv.Atoi(bounds[1])
+	}
+	if err != nil || from < 1 || to > max || from > to {
+		return 0, 0, fmt.Errorf("invalid selection: %s", field)
+	}
+	return from, to, nil
+}
+
+// mappingValue returns the value of a key of a YAML mapping, nil when it
+// isn't there.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// addMappingValue returns the value of a key of a YAML mapping, adding value
+// under the key when it isn't there.
+func addMappingValue(mapping *yaml.Node, key string, value *yaml.Node) *yaml.Node {
+	if existing := mappingValue(mapping, key); existing != nil {
+		return existing
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value
+}
+
+// addReposToConfig appends repositories missing from the repo key of the
+// config file, or of the --profile in it, keeping the rest of the file and
+// its comments. A profile without a repo key gets a copy of the top level
+// list first, as its key replaces that one.
+func addReposToConfig(file string, repos []string) (int, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return 0, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return 0, fmt.Errorf("expected a mapping of flag names to values")
+	}
+
+	list := mappingValue(root, "repo")
+	if profile != "" {
+		profiles := addMappingValue(root, "profiles", &yaml.Node{Kind: yaml.MappingNode})
+		if profiles.Kind != yaml.MappingNode {
+			return 0, fmt.Errorf("profiles must be a mapping")
+		}
+		selected := addMappingValue(profiles, profile, &yaml.Node{Kind: yaml.MappingNode})
+		if selected.Kind != yaml.MappingNode {
+			return 0, fmt.Errorf("profile %s must be a mapping", profile)
+		}
+		inherited := &yaml.Node{Kind: yaml.SequenceNode}
+		if list != nil && list.Kind == yaml.SequenceNode {
+			for _, item := range list.Content {
+				copied := *item
+				inherited.Content = append(inherited.Content, &copied)
+			}
+		} else if list != nil && list.Kind == yaml.ScalarNode {
+			copied := *list
+			inherited.Content = []*yaml.Node{&copied}
+		}
+		list = addMappingValue(selected, "repo", inherited)
+	} else if list == nil {
+		list = addMappingValue(root, "repo", &yaml.Node{Kind: yaml.SequenceNode})
+	}
+	if list.Kind == yaml.ScalarNode {
+		item := *list
+		*list = yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{&item}}
+	}
+	if list.Kind != yaml.SequenceNode {
+		return 0, fmt.Errorf("repo must be a list")
+	}
+
+	existing := make(map[string]bool)
+	for _, item := range list.Content {
+		existing[item.Value] = true
+	}
+	added := 0
+	for _, repo := range repos {
+		if !existing[repo] {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: repo})
+			existing[repo] = true
+			added++
+		}
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return 0, err
+	}
+	return added, ioutil.WriteFile(file, []byte(buf.String()), 0644)
+}
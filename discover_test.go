@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddReposToConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		config  string
+		want    string
+		added   int
+	}{
+		{
+			name:   "new key",
+			config: "output: docs\n",
+			want:   "output: docs\nrepo:\n  - octo/a\n  - octo/b\n",
+			added:  2,
+		},
+		{
+			name:   "existing repositories are kept",
+			config: "# mirrors\nrepo: octo/a\n",
+			want:   "# mirrors\nrepo:\n  - octo/a\n  - octo/b\n",
+			added:  1,
+		},
+		{
+			name:    "profile inherits the top level list",
+			profile: "work",
+			config:  "repo:\n  - octo/a\nprofiles:\n  work:\n    output: work\n",
+			want:    "repo:\n  - octo/a\nprofiles:\n  work:\n    output: work\n    repo:\n      - octo/a\n      - octo/b\n",
+			added:   1,
+		},
+		{
+			name:    "profile with its own list",
+			profile: "work",
+			config:  "repo:\n  - octo/c\nprofiles:\n  work:\n    repo:\n      - octo/a\n",
+			want:    "repo:\n  - octo/c\nprofiles:\n  work:\n    repo:\n      - octo/a\n      - octo/b\n",
+			added:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := profile
+			profile = tt.profile
+			defer func() { profile = saved }()
+			file := filepath.Join(t.TempDir(), "md-downloader.yaml")
+			if err := ioutil.WriteFile(file, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			added, err := addReposToConfig(file, []string{"octo/a", "octo/b"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := ioutil.ReadFile(file)
+			if added != tt.added || string(got) != tt.want {
+				t.Errorf("added %d:\n%s\nwant %d:\n%s", added, got, tt.added, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const discussionsQuery = `query($owner: String!, $name: String!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    discussions(first: 50, after: $cursor, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        id number title body url createdAt updatedAt
+        author { login }
+        category { name }
+        comments(first: 100) {
+          pageInfo { hasNextPage endCursor }
+          nodes {
+            id author { login } body createdAt isAnswer
+            replies(first: 100) {
+              pageInfo { hasNextPage endCursor }
+              nodes { author { login } body createdAt }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// The first page of comments and replies comes with the discussions, the
+// rest is fetched by the node ID of the discussion or comment.
+const discussionCommentsQuery = `query($id: ID!, $cursor: String) {
+  node(id: $id) {
+    ... on Discussion {
+      comments(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          id author { login } body createdAt isAnswer
+          replies(first: 100) {
+            pageInfo { hasNextPage endCursor }
+            nodes { author { login } body createdAt }
+          }
+        }
+      }
+    }
+  }
+}`
+
+const discussionRepliesQuery = `query($id: ID!, $cursor: String) {
+  node(id: $id) {
+    ... on DiscussionComment {
+      replies(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes { author { login } body createdAt }
+      }
+    }
+  }
+}`
+
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type discussionPost struct {
+	Author    issueUser `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type discussionReplies struct {
+	PageInfo pageInfo         `json:"pageInfo"`
+	Nodes    []discussionPost `json:"nodes"`
+}
+
+type discussionComment struct {
+	discussionPost
+	ID       string            `json:"id"`
+	IsAnswer bool              `json:"isAnswer"`
+	Replies  discussionReplies `json:"replies"`
+}
+
+type discussionComments struct {
+	PageInfo pageInfo            `json:"pageInfo"`
+	Nodes    []discussionComment `json:"nodes"`
+}
+
+type discussion struct {
+	discussionPost
+	ID        string    `json:"id"`
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Category  struct {
+		Name string `json:"name"`
+	} `json:"category"`
+	Comments discussionComments `json:"comments"`
+}
+
+// syncDiscussions saves the GitHub Discussions of a repository as
+// discussions/<number>.md threads, with --discussions. Discussions come newest
+// first, so paging stops at the first one that is already up to date.
+func syncDiscussions(client *http.Client, repo string, history History) {
+	if isLocalRepo(repo) || isGist(repo) {
+		return
+	}
+	remote, err := parseRemoteRepo(repo)
+	if err != nil || remote.Provider != providerGitHub {
+		log.Warnf("Discussions are only supported for GitHub repositories: %s\n", repo)
+		return
+	}
+	split := strings.SplitN(remote.Path, "/", 2)
+	if len(split) != 2 {
+		log.Errorf("Invalid repository: %s\n", repo)
+		return
+	}
+
+	variables := map[string]interface{}{"owner": split[0], "name": split[1]}
+	for {
+		var data struct {
+			Repository struct {
+				Discussions struct {
+					PageInfo pageInfo     `json:"pageInfo"`
+					Nodes    []discussion `json:"nodes"`
+				} `json:"discussions"`
+			} `json:"repository"`
+		}
+		if err := queryGraphQL(client, discussionsQuery, variables, &data); err != nil {
+			return
+		}
+
+		discussions := data.Repository.Discussions
+		for _, d := range discussions.Nodes {
+			filePath := fmt.Sprintf("discussions/%d.md", d.Number)
+			if entry, ok := history.Files[filePath]; ok && entry.Status == statusOK && entry.DownloadedAt.After(d.UpdatedAt) {
+				return
+			}
+
+			if err := fetchDiscussionComments(client, &d); err != nil {
+				history.Files[filePath] = HistoryEntry{Status: statusError, DownloadedAt: time.Now()}
+				continue
+			}
+			content := []byte(discussionMarkdown(d))
+			saveGenerated(repo, filePath, content, history)
+		}
+
+		if !discussions.PageInfo.HasNextPage {
+			return
+		}
+		variables["cursor"] = discussions.PageInfo.EndCursor
+	}
+}
+
+// fetchDiscussionComments fetches the comments and replies of a discussion
+// that didn't fit in the first page.
+func fetchDiscussionComments(client *http.Client, d *discussion) error {
+	for page := d.Comments.PageInfo; page.HasNextPage; {
+		var data struct {
+			Node struct {
+				Comments discussionComments `json:"comments"`
+			} `json:"node"`
+		}
+		if err := queryGraphQL(client, discussionCommentsQuery, map[string]interface{}{"id": d.ID, "cursor": page.EndCursor}, &data); err != nil {
+			return err
+		}
+		d.Comments.Nodes = append(d.Comments.Nodes, data.Node.Comments.Nodes...)
+		page = data.Node.Comments.PageInfo
+	}
+	for i := range d.Comments.Nodes {
+		c := &d.Comments.Nodes[i]
+		for page := c.Replies.PageInfo; page.HasNextPage; {
+			var data struct {
+				Node struct {
+					Replies discussionReplies `json:"replies"`
+				} `json:"node"`
+			}
+			if err := queryGraphQL(client, discussionRepliesQuery, map[string]interface{}{"id": c.ID, "cursor": page.EndCursor}, &data); err != nil {
+				return err
+			}
+			c.Replies.Nodes = append(c.Replies.Nodes, data.Node.Replies.Nodes...)
+			page = data.Node.Replies.PageInfo
+		}
+	}
+	return nil
+}
+
+func queryGraphQL(client *http.Client, query string, variables map[string]interface{}, v interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+
+	req := newAPIRequest(apiURL + "/graphql")
+	req.Method = http.MethodPost
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := httpStatusError(resp)
+		log.Errorf("GraphQL query failed: %s\n", err)
+		return err
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Errorf("Failed to decode response JSON: %s\n", err)
+		return err
+	}
+	if len(result.Errors) > 0 {
+		err := fmt.Errorf("%s", result.Errors[0].Message)
+		log.Errorf("GraphQL query failed: %s\n", err)
+		return err
+	}
+	return json.Unmarshal(result.Data, v)
+}
+
+func discussionMarkdown(d discussion) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(d.Title))
+	fmt.Fprintf(&b, "number: %d\n", d.Number)
+	fmt.Fprintf(&b, "category: %s\n", yamlString(d.Category.Name))
+	fmt.Fprintf(&b, "author: %s\n", yamlString(d.Author.Login))
+	fmt.Fprintf(&b, "created_at: %s\n", d.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated_at: %s\n", d.UpdatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "url: %s\n", d.URL)
+	b.WriteString("---\n\n")
+	fmt.Fprintf(&b, "# %s\n", d.Title)
+	if body := strings.TrimSpace(d.Body); body != "" {
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+
+	for _, c := range d.Comments.Nodes {
+		answer := ""
+		if c.IsAnswer {
+			answer = " (answer)"
+		}
+		fmt.Fprintf(&b, "\n---\n\n**%s** commented on %s%s:\n\n%s\n", c.Author.Login, c.CreatedAt.Format("2006-01-02"), answer, strings.TrimSpace(c.Body))
+		for _, r := range c.Replies.Nodes {
+			fmt.Fprintf(&b, "\n> **%s** replied on %s:\n>\n> %s\n", r.Author.Login, r.CreatedAt.Format("2006-01-02"), strings.ReplaceAll(strings.TrimSpace(r.Body), "\n", "\n> "))
+		}
+	}
+	return b.String()
+}
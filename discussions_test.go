@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// serverTransport sends every request to a test server, whatever its host.
+type serverTransport struct {
+	server *httptest.Server
+}
+
+func (t serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(t.server.URL)
+	req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestFetchDiscussionComments(t *testing.T) {
+	testConfig(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string            `json:"query"`
+			Variables map[string]string `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		data := map[string]interface{}{}
+		switch {
+		case strings.Contains(request.Query, "on Discussion "):
+			data["node"] = map[string]interface{}{"comments": map[string]interface{}{
+				"pageInfo": map[string]interface{}{"hasNextPage": false},
+				"nodes":    []map[string]interface{}{{"id": "c2", "body": "second", "replies": map[string]interface{}{"pageInfo": map[string]interface{}{"hasNextPage": false}}}},
+			}}
+		case strings.Contains(request.Query, "on DiscussionComment"):
+			cursor := request.Variables["cursor"]
+			data["node"] = map[string]interface{}{"replies": map[string]interface{}{
+				"pageInfo": map[string]interface{}{"hasNextPage": cursor == "r1", "endCursor": "r2"},
+				"nodes":    []map[string]interface{}{{"body": "reply after " + cursor}},
+			}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer server.Close()
+
+	d := discussion{ID: "d1"}
+	d.Comments.PageInfo = pageInfo{HasNextPage: true, EndCursor: "c1"}
+	first := discussionComment{ID: "c1"}
+	first.Body = "first"
+	first.Replies.PageInfo = pageInfo{HasNextPage: true, EndCursor: "r1"}
+	first.Replies.Nodes = []discussionPost{{Body: "reply"}}
+	d.Comments.Nodes = []discussionComment{first}
+
+	client := &http.Client{Transport: serverTransport{server}}
+	if err := fetchDiscussionComments(client, &d); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range d.Comments.Nodes {
+		got = append(got, c.Body)
+		for _, r := range c.Replies.Nodes {
+			got = append(got, "> "+r.Body)
+		}
+	}
+	if want := "first, > reply, > reply after r1, > reply after r2, second"; strings.Join(got, ", ") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, ", "), want)
+	}
+}
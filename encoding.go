@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	encodingUTF8 = "utf-8"
+	encodingKeep = "keep"
+)
+
+// windows1252 maps the bytes 0x80-0x9f of Windows-1252, the usual superset
+// of Latin-1 in legacy text files. The rest of the range is Latin-1.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// toUTF8 converts text with a BOM, UTF-16 or Windows-1252 content to UTF-8
+// without a BOM. It returns the detected encoding, empty when the content
+// already was plain UTF-8.
+func toUTF8(content []byte) ([]byte, string) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xef, 0xbb, 0xbf}):
+		return content[3:], "utf-8 with BOM"
+	case bytes.HasPrefix(content, []byte{0xff, 0xfe}):
+		return decodeUTF16(content[2:], binary.LittleEndian), "utf-16le"
+	case bytes.HasPrefix(content, []byte{0xfe, 0xff}):
+		return decodeUTF16(content[2:], binary.BigEndian), "utf-16be"
+	}
+	if order := guessUTF16(content); order != nil {
+		return decodeUTF16(content, order), "utf-16"
+	}
+	if utf8.Valid(content) {
+		return content, ""
+	}
+
+	var buf bytes.Buffer
+	for _, b := range content {
+		switch {
+		case b < 0x80:
+			buf.WriteByte(b)
+		case b < 0xa0:
+			buf.WriteRune(windows1252[b-0x80])
+		default:
+			buf.WriteRune(rune(b))
+		}
+	}
+	return buf.Bytes(), "windows-1252"
+}
+
+// guessUTF16 detects UTF-16 without a BOM by the zero bytes ASCII text has
+// in every other position.
+func guessUTF16(content []byte) binary.ByteOrder {
+	if len(content) < 4 || len(content)%2 != 0 {
+		return nil
+	}
+	sample := content
+	if len(sample) > 1024 {
+		sample = sample[:1024]
+	}
+	even, odd := 0, 0
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			even++
+		}
+		if sample[i+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case odd*10 >= pairs*4 && even == 0:
+		return binary.LittleEndian
+	case even*10 >= pairs*4 && odd == 0:
+		return binary.BigEndian
+	}
+	return nil
+}
+
+func decodeUTF16(content []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[2*i:])
+	}
+	var buf bytes.Buffer
+	for _, r := range utf16.Decode(units) {
+		buf.WriteRune(r)
+	}
+	return buf.Bytes()
+}
+
+// normalizeEncoding converts text files to UTF-8 unless --encoding keep.
+func normalizeEncoding(filePath string, content []byte) []byte {
+	if cfg.Encoding == encodingKeep {
+		return content
+	}
+	converted, from := toUTF8(content)
+	if from != "" {
+		log.Infof("Converted %s from %s to UTF-8\n", filePath, from)
+	}
+	return converted
+}
+
+const (
+	eolLF     = "lf"
+	eolCRLF   = "crlf"
+	eolNative = "native"
+)
+
+// normalizeEOL converts the line endings of text files to --eol, mixed
+// endings included. Without --eol they are kept.
+func normalizeEOL(content []byte) []byte {
+	eol := cfg.EOL
+	if eol == eolNative {
+		eol = eolLF
+		if runtime.GOOS == "windows" {
+			eol = eolCRLF
+		}
+	}
+	switch eol {
+	case eolLF:
+		return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	case eolCRLF:
+		lf := bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+	}
+	return content
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      []byte
+		want         string
+		wantEncoding string
+	}{
+		{"utf-8", []byte("héllo"), "héllo", ""},
+		{"utf-8 with BOM", []byte("\xef\xbb\xbfhéllo"), "héllo", "utf-8 with BOM"},
+		{"utf-16le with BOM", []byte("\xff\xfeh\x00\xe9\x00"), "hé", "utf-16le"},
+		{"utf-16be with BOM", []byte("\xfe\xff\x00h\x00\xe9"), "hé", "utf-16be"},
+		{"utf-16le without BOM", []byte("#\x00 \x00T\x00i\x00"), "# Ti", "utf-16"},
+		{"windows-1252", []byte("caf\xe9 \x93quoted\x94"), "café “quoted”", "windows-1252"},
+		{"empty", nil, "", ""},
+	}
+	for _, tt := range tests {
+		got, encoding := toUTF8(tt.content)
+		if string(got) != tt.want || encoding != tt.wantEncoding {
+			t.Errorf("%s: toUTF8 = %q, %q, want %q, %q", tt.name, got, encoding, tt.want, tt.wantEncoding)
+		}
+	}
+}
+
+func TestGuessUTF16(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    binary.ByteOrder
+	}{
+		{"little endian", []byte("a\x00b\x00c\x00d\x00"), binary.LittleEndian},
+		{"big endian", []byte("\x00a\x00b\x00c\x00d"), binary.BigEndian},
+		{"ascii", []byte("abcdefgh"), nil},
+		{"odd length", []byte("a\x00b\x00c"), nil},
+		{"too short", []byte("a\x00"), nil},
+		{"zeros on both sides", []byte("a\x00\x00b"), nil},
+		{"binary", bytes.Repeat([]byte{0, 0, 1, 2}, 8), nil},
+	}
+	for _, tt := range tests {
+		if got := guessUTF16(tt.content); got != tt.want {
+			t.Errorf("%s: guessUTF16 = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
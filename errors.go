@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type errorKind string
+
+const (
+	errAuth       errorKind = "auth"
+	errRateLimit  errorKind = "rate limit"
+	errFilesystem errorKind = "filesystem"
+	errNetwork    errorKind = "network"
+	errNotFound   errorKind = "not found"
+	errDecode     errorKind = "decode"
+	errValidation errorKind = "validation"
+	errOther      errorKind = "other"
+)
+
+// Exit codes of a sync run, documented in the readme. When several kinds of
+// errors happened, the first one in errorKinds wins.
+const (
+	exitOK     = 0
+	exitUsage  = 2
+	exitLocked = 9
+	// exitLint is used by lint --fail when it found problems.
+	exitLint = 11
+)
+
+var errorKinds = []errorKind{errAuth, errRateLimit, errFilesystem, errNetwork, errNotFound, errDecode, errValidation, errOther}
+
+var exitCodes = map[errorKind]int{
+	errAuth:       3,
+	errRateLimit:  4,
+	errFilesystem: 5,
+	errNetwork:    6,
+	errNotFound:   7,
+	errDecode:     8,
+	errValidation: 10,
+	errOther:      1,
+}
+
+// apiError is a failed HTTP response.
+type apiError struct {
+	Kind   errorKind
+	Status string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Status)
+}
+
+func httpStatusError(resp *http.Response) error {
+	kind := errOther
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		kind = errAuth
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		kind = errAuth
+		if resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "" {
+			kind = errRateLimit
+		}
+	case http.StatusNotFound:
+		kind = errNotFound
+	}
+	return &apiError{Kind: kind, Status: resp.Status}
+}
+
+func classifyError(err error) errorKind {
+	var apiErr *apiError
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var base64Err base64.CorruptInputError
+	var validationErr *validationError
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.Kind
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return errFilesystem
+	case errors.As(err, &netErr):
+		return errNetwork
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.As(err, &base64Err):
+		return errDecode
+	case errors.As(err, &validationErr):
+		return errValidation
+	}
+	return errOther
+}
+
+var runErrors = struct {
+	sync.Mutex
+	counts map[errorKind]int
+}{counts: make(map[errorKind]int)}
+
+// recordError counts a failure of the current run for the summary and the
+// exit code.
+func recordError(err error) {
+	if err == nil {
+		return
+	}
+	runErrors.Lock()
+	defer runErrors.Unlock()
+	runErrors.counts[classifyError(err)]++
+}
+
+// snapshotErrors and restoreErrors let a retried operation drop the errors
+// of attempts that were retried.
+func snapshotErrors() map[errorKind]int {
+	runErrors.Lock()
+	defer runErrors.Unlock()
+	counts := make(map[errorKind]int)
+	for kind, count := range runErrors.counts {
+		counts[kind] = count
+	}
+	return counts
+}
+
+func restoreErrors(counts map[errorKind]int) {
+	runErrors.Lock()
+	defer runErrors.Unlock()
+	runErrors.counts = counts
+}
+
+// reportErrors logs how many errors of each kind the run had and returns the
+// exit code for them.
+func reportErrors() int {
+	runErrors.Lock()
+	defer runErrors.Unlock()
+
+	if len(runErrors.counts) == 0 {
+		return exitOK
+	}
+
+	log.Errorf("Sync finished with errors: %s\n", errorSummary(runErrors.counts))
+
+	for _, kind := range errorKinds {
+		if runErrors.counts[kind] > 0 {
+			return exitCodes[kind]
+		}
+	}
+	return exitOK
+}
+
+// errorSummary lists the counts like "2 network, 1 not found".
+func errorSummary(counts map[errorKind]int) string {
+	var summary []string
+	for kind, count := range counts {
+		summary = append(summary, fmt.Sprintf("%d %s", count, kind))
+	}
+	sort.Strings(summary)
+	return strings.Join(summary, ", ")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+)
+
+var (
+	filterProgram *vm.Program
+	placeProgram  *vm.Program
+	// filterNeedsContent is set when --filter reads the front matter, the
+	// file then has to be downloaded before it is decided on.
+	filterNeedsContent bool
+)
+
+// fileEnv is what --filter and --place expressions see of a file. The front
+// matter is empty until the file is downloaded.
+func fileEnv(repo string, item treeItem, content []byte) map[string]interface{} {
+	frontMatter := parseFrontMatter(content)
+	if frontMatter == nil {
+		frontMatter = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"repo":        repo,
+		"path":        item.Path,
+		"name":        path.Base(item.Path),
+		"dir":         path.Dir(item.Path),
+		"ext":         path.Ext(item.Path),
+		"size":        item.Size,
+		"frontmatter": frontMatter,
+		"lang":        detectLanguage(content),
+	}
+}
+
+func compileFilters() error {
+	env := expr.Env(fileEnv("", treeItem{}, nil))
+	filterProgram, placeProgram, filterNeedsContent = nil, nil, false
+	if cfg.Filter != "" {
+		program, err := expr.Compile(cfg.Filter, env, expr.AsBool())
+		if err != nil {
+			return fmt.Errorf("invalid --filter: %s", err)
+		}
+		filterProgram = program
+		filterNeedsContent = usesIdentifier(cfg.Filter, "frontmatter") || usesIdentifier(cfg.Filter, "lang")
+	}
+	if cfg.Place != "" {
+		program, err := expr.Compile(cfg.Place, env, expr.AsKind(reflect.String))
+		if err != nil {
+			return fmt.Errorf("invalid --place: %s", err)
+		}
+		placeProgram = program
+	}
+	return nil
+}
+
+type identifierFinder struct {
+	name  string
+	found bool
+}
+
+func (f *identifierFinder) Visit(node *ast.Node) {
+	if id, ok := (*node).(*ast.IdentifierNode); ok && id.Value == f.name {
+		f.found = true
+	}
+}
+
+func usesIdentifier(input, name string) bool {
+	tree, err := parser.Parse(input)
+	if err != nil {
+		return true
+	}
+	finder := &identifierFinder{name: name}
+	ast.Walk(&tree.Node, finder)
+	return finder.found
+}
+
+// filterFile runs --filter for a file, files it fails on are kept.
+func filterFile(repo string, item treeItem, content []byte) bool {
+	if filterProgram == nil {
+		return true
+	}
+	result, err := expr.Run(filterProgram, fileEnv(repo, item, content))
+	if err != nil {
+		log.Warnf("Failed to run --filter on %s: %s\n", item.Path, err)
+		return true
+	}
+	return result.(bool)
+}
+
+// placeFile runs --place for a file and returns the path below the
+// repository's directory it is written to, empty to keep its own path.
+func placeFile(repo, filePath string, content []byte) string {
+	if placeProgram == nil {
+		return ""
+	}
+	result, err := expr.Run(placeProgram, fileEnv(repo, treeItem{Path: filePath, Size: len(content)}, content))
+	if err != nil {
+		log.Warnf("Failed to run --place on %s: %s\n", filePath, err)
+		return ""
+	}
+	return routeDir(result.(string))
+}
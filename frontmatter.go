@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseFrontMatter returns the fields of a document's YAML front matter, nil
+// when it has none or it can't be parsed.
+func parseFrontMatter(content []byte) map[string]interface{} {
+	end := frontMatterEnd(content)
+	if end == 0 {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	// Skip the opening and closing --- lines.
+	if err := yaml.Unmarshal(content[4:end-4], &fields); err != nil {
+		log.Debugf("Failed to parse front matter: %s\n", err)
+		return nil
+	}
+	return fields
+}
+
+// frontMatterStrings returns a front matter field as a list of strings, a
+// single value becomes a list of one.
+func frontMatterStrings(fields map[string]interface{}, key string) []string {
+	switch value := fields[key].(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
+
+// outputPath returns where a file is written, from its content as it was
+// downloaded. --place decides first, then with --route-by the value of that
+// front matter field becomes the top directory, e.g. a document with
+// "category: guides" goes to <output>/guides/<repo>/<path>, below the
+// language's directory with --route-language. Documents converted to HTML
+// get an .html extension.
+func outputPath(repo, filePath string, content []byte) string {
+	dest := routedPath(repo, filePath, content)
+	if isMarkdown(filePath) && isMarkdown(dest) && hasStep(repo, stepConvertHTML) {
+		dest = strings.TrimSuffix(dest, filepath.Ext(dest)) + ".html"
+	}
+	return dest
+}
+
+func routedPath(repo, filePath string, content []byte) string {
+	if placed := placeFile(repo, filePath, content); placed != "" {
+		return filepath.Join(cfg.Output, repoName(repo), placed)
+	}
+	if (cfg.RouteBy == "" && !cfg.RouteLanguage) || !isMarkdown(filePath) {
+		return localPath(repo, filePath)
+	}
+
+	var route string
+	if cfg.RouteLanguage {
+		route = routeDir(detectLanguage(content))
+	}
+	if values := frontMatterStrings(parseFrontMatter(content), cfg.RouteBy); cfg.RouteBy != "" && len(values) > 0 {
+		route = filepath.Join(route, routeDir(values[0]))
+	}
+	if route == "" {
+		return localPath(repo, filePath)
+	}
+	return filepath.Join(cfg.Output, route, repoName(repo), filePath)
+}
+
+// routeDir turns a front matter value into a directory name that can't
+// escape the output directory.
+func routeDir(value string) string {
+	var segments []string
+	for _, segment := range strings.Split(value, "/") {
+		segment = strings.TrimSpace(segment)
+		if segment != "" && segment != "." && segment != ".." {
+			segments = append(segments, segment)
+		}
+	}
+	return filepath.Join(segments...)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const gcpSecretsPrefix = "gcp-sm:"
+
+var (
+	gcpSecretManagerURL = "https://secretmanager.googleapis.com/v1/"
+	gcpMetadataURL      = "http://metadata.google.internal/computeMetadata/v1/"
+)
+
+// gcpSecret reads a version of a secret of GCP Secret Manager, referenced
+// as gcp-sm:<project>/<secret>, gcp-sm:<project>/<secret>/<version> or by
+// its full resource name. A plain gcp-sm:<secret> is looked up in
+// GOOGLE_CLOUD_PROJECT or the project md-downloader runs in. The latest
+// version is used unless one is given.
+func gcpSecret(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, gcpSecretsPrefix)
+	if !strings.HasPrefix(name, "projects/") {
+		parts := strings.Split(name, "/")
+		if len(parts) == 1 {
+			project, err := gcpProject()
+			if err != nil {
+				return "", err
+			}
+			parts = append([]string{project}, parts...)
+		}
+		if len(parts) == 2 {
+			parts = append(parts, "latest")
+		}
+		if len(parts) != 3 {
+			return "", fmt.Errorf("invalid secret %s, expected gcp-sm:<project>/<secret>/<version>", ref)
+		}
+		name = fmt.Sprintf("projects/%s/secrets/%s/versions/%s", parts[0], parts[1], parts[2])
+	} else if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	token, err := gcpAccessToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to authenticate to GCP: %s", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, gcpSecretManagerURL+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Cache-Control", "no-store")
+	var secret struct {
+		Payload struct {
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err := doGCPRequest(req, &secret); err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %s", name, err)
+	}
+	return strings.TrimSpace(string(secret.Payload.Data)), nil
+}
+
+func gcpProject() (string, error) {
+	for _, name := range []string{"GOOGLE_CLOUD_PROJECT", "CLOUDSDK_CORE_PROJECT"} {
+		if project := os.Getenv(name); project != "" {
+			return project, nil
+		}
+	}
+	project, err := gcpMetadata("project/project-id")
+	if err != nil {
+		return "", fmt.Errorf("no project, set GOOGLE_CLOUD_PROJECT or reference the secret as <project>/<secret>")
+	}
+	return project, nil
+}
+
+// gcpAccessToken returns GOOGLE_OAUTH_ACCESS_TOKEN, exchanges the service
+// account key of GOOGLE_APPLICATION_CREDENTIALS for a token, or asks the
+// metadata server for the token of the attached service account, which is
+// the workload identity on GKE and the service identity on Cloud Run.
+func gcpAccessToken() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	if file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); file != "" {
+		return gcpKeyFileToken(file)
+	}
+	data, err := gcpMetadata("instance/service-accounts/default/token")
+	if err != nil {
+		return "", fmt.Errorf("not running on GCP, set GOOGLE_APPLICATION_CREDENTIALS: %s", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+func gcpMetadata(path string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, gcpMetadataURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	req.Header.Set("Cache-Control", "no-store")
+	client := &http.Client{Transport: httpClient().Transport, Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", httpStatusError(resp)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	return strings.TrimSpace(string(data)), err
+}
+
+// gcpKeyFileToken signs a JWT with the key of a service account and trades
+// it for an access token, as the OAuth 2.0 JWT bearer flow of Google does.
+func gcpKeyFileToken(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("%s: %s", file, err)
+	}
+	if key.Type != "service_account" {
+		return "", fmt.Errorf("%s isn't a service account key", file)
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("%s has no private key", file)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", file, err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("%s: not an RSA key", file)
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/cloud-platform",
+		"aud":   key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	assertion := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequest(http.MethodPost, key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doGCPRequest(req, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+func doGCPRequest(req *http.Request, result interface{}) error {
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var gcpErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&gcpErr) == nil && gcpErr.Error.Message != "" {
+			return fmt.Errorf("%w: %s", httpStatusError(resp), gcpErr.Error.Message)
+		}
+		return httpStatusError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
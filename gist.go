@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const gistPrefix = "gist:"
+
+type gistFile struct {
+	Filename  string `json:"filename"`
+	RawURL    string `json:"raw_url"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated"`
+	Content   string `json:"content"`
+}
+
+type gist struct {
+	ID      string              `json:"id"`
+	Files   map[string]gistFile `json:"files"`
+	History []struct {
+		Version string `json:"version"`
+	} `json:"history"`
+}
+
+func isGist(repo string) bool {
+	return strings.HasPrefix(repo, gistPrefix)
+}
+
+// gistProvider syncs the files of a single gist, given as gist:<id>. Gists
+// have no directories and only one revision is listed, the latest.
+type gistProvider struct {
+	client *http.Client
+	id     string
+	gist   *gist
+}
+
+func (p *gistProvider) load() (*gist, error) {
+	if p.gist == nil {
+		var g gist
+		if err := getJSON(p.client, fmt.Sprintf("%s/gists/%s", apiURL, p.id), &g); err != nil {
+			return nil, err
+		}
+		p.gist = &g
+	}
+	return p.gist, nil
+}
+
+func (p *gistProvider) ResolveRef(ref string) (string, error) {
+	g, err := p.load()
+	if err != nil {
+		return "", err
+	}
+	if len(g.History) == 0 {
+		return "", fmt.Errorf("gist %s has no revisions", p.id)
+	}
+	return g.History[0].Version, nil
+}
+
+func (p *gistProvider) ListFiles(commit, dir string) ([]treeItem, error) {
+	g, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []treeItem
+	for _, file := range g.Files {
+		if dir != "" {
+			continue
+		}
+		content, err := p.content(file)
+		if err != nil {
+			return nil, err
+		}
+		// The API doesn't return blob SHAs, so they are computed.
+		items = append(items, treeItem{
+			Path: file.Filename,
+			Mode: "100644",
+			Type: "blob",
+			Sha:  gitBlobSha(content),
+			Size: file.Size,
+			Url:  file.RawURL,
+		})
+	}
+	return items, nil
+}
+
+func (p *gistProvider) FetchFile(item treeItem) ([]byte, error) {
+	g, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	return p.content(g.Files[item.Path])
+}
+
+// content returns a gist file, downloading it when the API truncated it.
+func (p *gistProvider) content(file gistFile) ([]byte, error) {
+	if !file.Truncated {
+		return []byte(file.Content), nil
+	}
+
+	resp, err := p.client.Do(newAPIRequest(file.RawURL))
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := httpStatusError(resp)
+		log.Errorf("Failed to download %s: %s\n", file.Filename, err)
+		return nil, err
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// expandGists adds the gists of the --gists users that contain markdown to
+// the repositories.
+func expandGists() error {
+	client := httpClient()
+	// A reload expands the gists again.
+	known := make(map[string]bool)
+	for _, repo := range cfg.Repos {
+		known[repo] = true
+	}
+	for _, user := range cfg.Gists {
+		for page := 1; ; page++ {
+			var gists []gist
+			if err := getJSON(client, fmt.Sprintf("%s/users/%s/gists?per_page=100&page=%d", apiURL, user, page), &gists); err != nil {
+				return fmt.Errorf("failed to list gists of %s: %s", user, err)
+			}
+			for _, g := range gists {
+				for name := range g.Files {
+					if isDocFile(name) {
+						if !known[gistPrefix+g.ID] {
+							cfg.Repos = append(cfg.Repos, gistPrefix+g.ID)
+						}
+						break
+					}
+				}
+			}
+			if len(gists) < 100 {
+				break
+			}
+		}
+	}
+	return nil
+}
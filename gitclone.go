@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var cloneURLFormat = "https://github.com/%s.git"
+
+// ensureClone keeps a shallow, blobless clone of the repository in the cache
+// directory and fetches the latest commit of ref into it, or of the default
+// branch when the repository has no such branch. It returns the branch that
+// was fetched. Only trees are downloaded up front, blobs are fetched on
+// demand.
+func ensureClone(repo, ref string) (string, string, error) {
+	dir := filepath.Join(cfg.CacheDir, "clones", repo)
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		if cfg.Offline {
+			branch, err := runGit(dir, nil, "symbolic-ref", "--short", "HEAD")
+			return dir, strings.TrimSpace(branch), err
+		}
+		branch, err := fetchBranch(dir, ref)
+		if err != nil {
+			log.Errorf("Failed to fetch %s: %s\n", repo, err)
+			return "", "", err
+		}
+		return dir, branch, nil
+	}
+
+	if cfg.Offline {
+		log.Errorf("No clone of %s in the cache and --offline is set\n", repo)
+		return "", "", fmt.Errorf("%s is not cached", repo)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), os.ModePerm); err != nil {
+		log.Errorf("Failed to create directory: %s\n", dir)
+		return "", "", err
+	}
+
+	log.Infof("Cloning repository: %s\n", repo)
+	cloneURL := fmt.Sprintf(cloneURLFormat, repo)
+	args := []string{"clone", "--quiet", "--depth", "1", "--filter=blob:none", "--no-checkout"}
+	if _, err := runGit("", nil, append(args, "--branch", ref, cloneURL, dir)...); err != nil {
+		os.RemoveAll(dir)
+		log.Infof("No branch %s in %s, cloning the default branch\n", ref, repo)
+		if _, err := runGit("", nil, append(args, cloneURL, dir)...); err != nil {
+			log.Errorf("Failed to clone %s: %s\n", repo, err)
+			os.RemoveAll(dir)
+			return "", "", err
+		}
+	}
+	branch, err := runGit(dir, nil, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		log.Errorf("Failed to read the branch of %s: %s\n", repo, err)
+		return "", "", err
+	}
+	return dir, strings.TrimSpace(branch), nil
+}
+
+// fetchBranch fetches ref into a clone, or the default branch of the remote
+// when it has no such branch, and returns the branch fetched.
+func fetchBranch(dir, ref string) (string, error) {
+	branch := ref
+	if _, err := runGit(dir, nil, "ls-remote", "--exit-code", "--heads", "origin", ref); err != nil {
+		symref, err := runGit(dir, nil, "ls-remote", "--symref", "origin", "HEAD")
+		if err != nil {
+			return "", err
+		}
+		// ref: refs/heads/main<TAB>HEAD
+		fields := strings.Fields(strings.SplitN(symref, "\n", 2)[0])
+		if len(fields) < 2 || fields[0] != "ref:" {
+			return "", fmt.Errorf("no branch %s and no default branch", ref)
+		}
+		branch = strings.TrimPrefix(fields[1], "refs/heads/")
+	}
+	refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch)
+	if _, err := runGit(dir, nil, "fetch", "--quiet", "--depth", "1", "--filter=blob:none", "origin", refspec); err != nil {
+		return "", err
+	}
+	return branch, nil
+}
+
+type gitCloneProvider struct {
+	dir string
+	// branch is the branch fetched, the default branch of the repository
+	// when the requested ref doesn't exist.
+	branch string
+}
+
+func (p *gitCloneProvider) ResolveRef(ref string) (string, error) {
+	if _, err := runGit(p.dir, nil, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+ref); err != nil {
+		ref = p.branch
+	}
+	commit, err := runGit(p.dir, nil, "rev-parse", "refs/remotes/origin/"+ref)
+	if err != nil {
+		log.Errorf("Failed to resolve %s: %s\n", ref, err)
+		return "", err
+	}
+	return strings.TrimSpace(commit), nil
+}
+
+func (p *gitCloneProvider) ListFiles(commit, dir string) ([]treeItem, error) {
+	args := []string{"ls-tree", "-r", "-z", "--full-tree", commit}
+	if dir != "" {
+		args = append(args, "--", dir+"/")
+	}
+	output, err := runGit(p.dir, nil, args...)
+	if err != nil {
+		log.Errorf("Failed to list tree: %s\n", err)
+		return nil, err
+	}
+
+	var items []treeItem
+	for _, line := range strings.Split(output, "\x00") {
+		// <mode> SP <type> SP <sha> TAB <path>
+		split := strings.SplitN(line, "\t", 2)
+		if len(split) < 2 {
+			continue
+		}
+		fields := strings.Fields(split[0])
+		if len(fields) < 3 {
+			continue
+		}
+		items = append(items, treeItem{
+			Path: split[1],
+			Mode: fields[0],
+			Type: fields[1],
+			Sha:  fields[2],
+		})
+	}
+
+	return items, nil
+}
+
+// Prefetch downloads the given blobs in a single batch by sparsely checking
+// them out, instead of letting git fetch each one lazily.
+func (p *gitCloneProvider) Prefetch(commit string, items []treeItem) {
+	// Checking out would fetch the missing blobs.
+	if len(items) == 0 || commit == "" || cfg.Offline {
+		return
+	}
+
+	var patterns strings.Builder
+	for _, item := range items {
+		patterns.WriteString("/" + item.Path + "\n")
+	}
+
+	if _, err := runGit(p.dir, strings.NewReader(patterns.String()), "sparse-checkout", "set", "--no-cone", "--stdin"); err != nil {
+		log.Warnf("Failed to prefetch files, fetching them one by one: %s\n", err)
+		return
+	}
+	if _, err := runGit(p.dir, nil, "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+		log.Warnf("Failed to prefetch files, fetching them one by one: %s\n", err)
+	}
+}
+
+func (p *gitCloneProvider) FetchFile(item treeItem) ([]byte, error) {
+	content, err := runGit(p.dir, nil, "cat-file", "blob", item.Sha)
+	if err != nil {
+		log.Errorf("Failed to read blob %s: %s\n", item.Sha, err)
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+func runGit(dir string, stdin *strings.Reader, args ...string) (string, error) {
+	name := args[0]
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	// Pass the token through the environment so it doesn't end up in the
+	// clone's config or in the process list.
+	var extraHeaders []string
+	if token := tokenFor("github.com"); token != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		extraHeaders = append(extraHeaders, "Authorization: Basic "+credentials)
+	}
+	for name, values := range cfg.Headers {
+		for _, value := range values {
+			extraHeaders = append(extraHeaders, name+": "+value)
+		}
+	}
+
+	var config [][2]string
+	for _, header := range extraHeaders {
+		config = append(config, [2]string{"http.extraHeader", header})
+	}
+	if cfg.Proxy != "" {
+		config = append(config, [2]string{"http.proxy", cfg.Proxy})
+	}
+
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_HTTP_USER_AGENT="+cfg.UserAgent, fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(config)))
+	if cfg.Offline {
+		// Refuse every remote protocol, including lazy fetches of blobs
+		// missing from the blobless clone.
+		cmd.Env = append(cmd.Env, "GIT_ALLOW_PROTOCOL=file", "GIT_NO_LAZY_FETCH=1")
+	}
+	for i, pair := range config {
+		cmd.Env = append(cmd.Env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, pair[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, pair[1]),
+		)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
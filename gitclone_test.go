@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRemote creates a bare repository at <dir>/octo/docs.git with a commit
+// on each branch and returns the commits by branch.
+func testRemote(t *testing.T, dir, defaultBranch string, branches ...string) map[string]string {
+	t.Helper()
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	bare := filepath.Join(dir, "octo", "docs.git")
+	work := filepath.Join(dir, "work")
+	exec.Command("git", "init", "--quiet", "--bare", bare).Run()
+	git(bare, "symbolic-ref", "HEAD", "refs/heads/"+defaultBranch)
+	exec.Command("git", "init", "--quiet", work).Run()
+	commits := make(map[string]string)
+	for _, branch := range branches {
+		git(work, "checkout", "--quiet", "-B", branch)
+		git(work, "commit", "--quiet", "--allow-empty", "-m", branch)
+		git(work, "push", "--quiet", bare, branch)
+		commits[branch] = git(work, "rev-parse", "HEAD")
+	}
+	return commits
+}
+
+func TestEnsureClone(t *testing.T) {
+	tests := []struct {
+		name       string
+		branches   []string
+		ref        string
+		wantBranch string
+	}{
+		{"requested branch", []string{"main", "master"}, "master", "master"},
+		{"default branch without the requested one", []string{"main"}, "master", "main"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConfig(t)
+			remote := t.TempDir()
+			commits := testRemote(t, remote, "main", tt.branches...)
+			saved := cloneURLFormat
+			cloneURLFormat = "file://" + filepath.ToSlash(remote) + "/%s.git"
+			defer func() { cloneURLFormat = saved }()
+
+			// The second call fetches into the existing clone.
+			for i := 0; i < 2; i++ {
+				dir, branch, err := ensureClone("octo/docs", tt.ref)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if branch != tt.wantBranch {
+					t.Errorf("fetched %s, want %s", branch, tt.wantBranch)
+				}
+				provider := &gitCloneProvider{dir: dir, branch: branch}
+				commit, err := provider.ResolveRef(tt.ref)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if commit != commits[tt.wantBranch] {
+					t.Errorf("resolved %s to %s, want %s", tt.ref, commit, commits[tt.wantBranch])
+				}
+			}
+		})
+	}
+}
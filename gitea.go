@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func giteaRepoURL(remote remoteRepo) string {
+	return fmt.Sprintf("https://%s/api/v1/repos/%s", remote.Host, remote.Path)
+}
+
+type giteaProvider struct {
+	client *http.Client
+	remote remoteRepo
+}
+
+func (p *giteaProvider) ResolveRef(ref string) (string, error) {
+	var branch struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	if err := getJSON(p.client, giteaRepoURL(p.remote)+"/branches/"+url.PathEscape(ref), &branch); err != nil {
+		return "", err
+	}
+	return branch.Commit.ID, nil
+}
+
+// ListFiles lists the recursive tree, which Gitea returns in pages. The API
+// can't list a subtree, so dir is left to the include filter.
+func (p *giteaProvider) ListFiles(commit, dir string) ([]treeItem, error) {
+	var items []treeItem
+	for page := 1; ; page++ {
+		var tree struct {
+			Tree      []treeItem `json:"tree"`
+			Truncated bool       `json:"truncated"`
+		}
+		if err := getJSON(p.client, fmt.Sprintf("%s/git/trees/%s?recursive=true&per_page=1000&page=%d", giteaRepoURL(p.remote), commit, page), &tree); err != nil {
+			return nil, err
+		}
+		items = append(items, tree.Tree...)
+		if !tree.Truncated || len(tree.Tree) == 0 {
+			break
+		}
+	}
+	return items, nil
+}
+
+// FetchFile downloads a blob, Gitea returns base64 content like GitHub does.
+func (p *giteaProvider) FetchFile(item treeItem) ([]byte, error) {
+	return fetchBytes(item, p.FetchFileTo)
+}
+
+func (p *giteaProvider) FetchFileTo(item treeItem, w io.Writer) error {
+	return fetchBlob(p.client, item, w)
+}
+
+func (p *giteaProvider) ChangedSince(commit string, since time.Time) (map[string]bool, error) {
+	changed := make(map[string]bool)
+	for page := 1; ; page++ {
+		commitsURL := fmt.Sprintf("%s/commits?sha=%s&since=%s&limit=50&page=%d", giteaRepoURL(p.remote), commit, url.QueryEscape(since.UTC().Format(time.RFC3339)), page)
+
+		var list []struct {
+			Files []struct {
+				Filename string `json:"filename"`
+			} `json:"files"`
+		}
+		if err := getJSON(p.client, commitsURL, &list); err != nil {
+			return nil, err
+		}
+		for _, commit := range list {
+			for _, file := range commit.Files {
+				changed[file.Filename] = true
+			}
+		}
+		if len(list) < 50 {
+			break
+		}
+	}
+	return changed, nil
+}
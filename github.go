@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+type githubProvider struct {
+	client *http.Client
+	repo   string
+	// commit is the last listed commit, oversized files are downloaded from
+	// it.
+	commit string
+}
+
+func (p *githubProvider) ResolveRef(ref string) (string, error) {
+	commitURL := fmt.Sprintf("%s/repos/%s/commits/%s", apiURL, p.repo, ref)
+
+	req := newAPIRequest(commitURL)
+	req.Header.Set("Accept", "application/vnd.github.sha")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Errorf("Failed to read response body: %s\n", err)
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := httpStatusError(resp)
+		log.Errorf("Failed to resolve %s of %s: %s\n", ref, p.repo, err)
+		return "", err
+	}
+
+	return strings.TrimSpace(string(bodyBytes)), nil
+}
+
+// ListFiles lists the tree of a commit recursively. When dir is set only that
+// subtree is listed, walking down to it one level at a time so the full
+// recursive tree of huge repositories is never requested.
+func (p *githubProvider) ListFiles(commit, dir string) ([]treeItem, error) {
+	p.commit = commit
+	sha := commit
+	if dir != "" {
+		for _, segment := range strings.Split(dir, "/") {
+			entries, err := p.getTree(sha, false)
+			if err != nil {
+				return nil, err
+			}
+			found := false
+			for _, entry := range entries {
+				if entry.Type == "tree" && entry.Path == segment {
+					sha = entry.Sha
+					found = true
+					break
+				}
+			}
+			if !found {
+				log.Warnf("Path %s not found in %s\n", dir, p.repo)
+				return nil, nil
+			}
+		}
+	}
+
+	tree, err := p.getTree(sha, true)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		for i := range tree {
+			tree[i].Path = dir + "/" + tree[i].Path
+		}
+	}
+
+	return tree, nil
+}
+
+func (p *githubProvider) getTree(sha string, recursive bool) ([]treeItem, error) {
+	contentsURL := fmt.Sprintf("%s/repos/%s/git/trees/%s", apiURL, p.repo, sha)
+	if recursive {
+		contentsURL += "?recursive=1"
+	}
+
+	req := newAPIRequest(contentsURL)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := httpStatusError(resp)
+		log.Errorf("Failed to list tree of %s: %s\n", p.repo, err)
+		return nil, err
+	}
+
+	var contents struct {
+		Tree []treeItem `json:"tree"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&contents); err != nil {
+		log.Errorf("Failed to decode response JSON: %s\n", err)
+		return nil, err
+	}
+
+	return contents.Tree, nil
+}
+
+func (p *githubProvider) FetchFile(item treeItem) ([]byte, error) {
+	return fetchBytes(item, p.FetchFileTo)
+}
+
+func (p *githubProvider) FetchFileTo(item treeItem, w io.Writer) error {
+	if item.Size > blobSizeLimit && p.commit != "" {
+		return fetchRanged(p.client, rawFileURL(p.repo, p.commit, item.Path), item, w)
+	}
+	return fetchBlob(p.client, item, w)
+}
+
+// fetchBlob downloads a blob as raw bytes to w. Hosts that ignore the raw
+// media type, like Gitea, answer with JSON and base64 content instead.
+func fetchBlob(client *http.Client, item treeItem, w io.Writer) error {
+	req := newAPIRequest(item.Url)
+	req.Header.Set("Accept", "application/vnd.github.raw+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := httpStatusError(resp)
+		log.Errorf("Failed to download %s: %s\n", item.Path, err)
+		return err
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "application/json" {
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			log.Errorf("Failed to read response body: %s\n", err)
+			return err
+		}
+		return nil
+	}
+
+	// The base64 content is decoded while it is downloaded.
+	encoded, err := jsonStringField(resp.Body, "content")
+	if err != nil {
+		log.Errorf("Failed to decode response JSON: %s\n", err)
+		return err
+	}
+	if _, err := io.Copy(w, base64.NewDecoder(base64.StdEncoding, encoded)); err != nil {
+		log.Errorf("Failed to decode base64 content: %s\n", err)
+		return err
+	}
+	return nil
+}
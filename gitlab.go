@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func gitlabProjectURL(remote remoteRepo) string {
+	return fmt.Sprintf("https://%s/api/v4/projects/%s", remote.Host, url.PathEscape(remote.Path))
+}
+
+type gitlabProvider struct {
+	client *http.Client
+	remote remoteRepo
+}
+
+func (p *gitlabProvider) ResolveRef(ref string) (string, error) {
+	var branch struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	if err := getJSON(p.client, gitlabProjectURL(p.remote)+"/repository/branches/"+url.PathEscape(ref), &branch); err != nil {
+		return "", err
+	}
+	return branch.Commit.ID, nil
+}
+
+func (p *gitlabProvider) ListFiles(commit, dir string) ([]treeItem, error) {
+	var items []treeItem
+	for page := 1; ; page++ {
+		treeURL := fmt.Sprintf("%s/repository/tree?ref=%s&recursive=true&per_page=100&page=%d", gitlabProjectURL(p.remote), commit, page)
+		if dir != "" {
+			treeURL += "&path=" + url.QueryEscape(dir)
+		}
+
+		var entries []struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Path string `json:"path"`
+			Mode string `json:"mode"`
+		}
+		if err := getJSON(p.client, treeURL, &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			items = append(items, treeItem{
+				Path: entry.Path,
+				Mode: entry.Mode,
+				Type: entry.Type,
+				Sha:  entry.ID,
+				Url:  fmt.Sprintf("%s/repository/blobs/%s/raw", gitlabProjectURL(p.remote), entry.ID),
+			})
+		}
+		if len(entries) < 100 {
+			break
+		}
+	}
+	return items, nil
+}
+
+func (p *gitlabProvider) FetchFile(item treeItem) ([]byte, error) {
+	return fetchRawBlob(p.client, item)
+}
+
+func fetchRawBlob(client *http.Client, item treeItem) ([]byte, error) {
+	resp, err := client.Do(newAPIRequest(item.Url))
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := httpStatusError(resp)
+		log.Errorf("Failed to download %s: %s\n", item.Path, err)
+		return nil, err
+	}
+
+	var content bytes.Buffer
+	content.Grow(item.Size)
+	if _, err := io.Copy(&content, resp.Body); err != nil {
+		log.Errorf("Failed to read response body: %s\n", err)
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
+
+func (p *gitlabProvider) ChangedSince(commit string, since time.Time) (map[string]bool, error) {
+	var commits []string
+	for page := 1; ; page++ {
+		commitsURL := fmt.Sprintf("%s/repository/commits?ref_name=%s&since=%s&per_page=100&page=%d", gitlabProjectURL(p.remote), commit, url.QueryEscape(since.UTC().Format(time.RFC3339)), page)
+
+		var list []struct {
+			ID string `json:"id"`
+		}
+		if err := getJSON(p.client, commitsURL, &list); err != nil {
+			return nil, err
+		}
+		for _, commit := range list {
+			commits = append(commits, commit.ID)
+		}
+		if len(list) < 100 {
+			break
+		}
+	}
+
+	changed := make(map[string]bool)
+	for _, id := range commits {
+		for page := 1; ; page++ {
+			var diffs []struct {
+				NewPath     string `json:"new_path"`
+				DeletedFile bool   `json:"deleted_file"`
+			}
+			if err := getJSON(p.client, fmt.Sprintf("%s/repository/commits/%s/diff?per_page=100&page=%d", gitlabProjectURL(p.remote), id, page), &diffs); err != nil {
+				return nil, err
+			}
+			for _, diff := range diffs {
+				if !diff.DeletedFile {
+					changed[diff.NewPath] = true
+				}
+			}
+			if len(diffs) < 100 {
+				break
+			}
+		}
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// commitOutput records the state of the output directory after a sync as a
+// commit, initializing the repository on the first run.
+func commitOutput() {
+	if _, err := os.Stat(filepath.Join(cfg.Output, ".git")); os.IsNotExist(err) {
+		if _, err := runGit(cfg.Output, nil, "init", "--quiet"); err != nil {
+			log.Errorf("Failed to initialize git repository in %s: %s\n", cfg.Output, err)
+			return
+		}
+	}
+	if _, err := runGit(cfg.Output, nil, "add", "--all"); err != nil {
+		log.Errorf("Failed to stage changes in %s: %s\n", cfg.Output, err)
+		return
+	}
+	status, err := runGit(cfg.Output, nil, "status", "--porcelain", "-z")
+	if err != nil {
+		log.Errorf("Failed to read status of %s: %s\n", cfg.Output, err)
+		return
+	}
+	message := commitMessage(status)
+	if message == "" {
+		log.Infof("No changes to commit in %s\n", cfg.Output)
+		return
+	}
+
+	args := []string{"commit", "--quiet", "--message", message}
+	// Commit as md-downloader unless an identity is configured.
+	if email, _ := runGit(cfg.Output, nil, "config", "user.email"); strings.TrimSpace(email) == "" {
+		args = append([]string{"-c", "user.name=md-downloader", "-c", "user.email=md-downloader@localhost"}, args...)
+	}
+	if _, err := runGit(cfg.Output, nil, args...); err != nil {
+		log.Errorf("Failed to commit changes in %s: %s\n", cfg.Output, err)
+		return
+	}
+	log.Infof("Committed changes in %s\n", cfg.Output)
+}
+
+// commitMessage summarizes git status --porcelain -z output: totals in the
+// subject and the counts per top level directory, usually a repository, in
+// the body.
+func commitMessage(status string) string {
+	type counts struct{ added, modified, deleted int }
+	total := counts{}
+	dirs := make(map[string]*counts)
+
+	entries := strings.Split(status, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		code, path := entry[:2], entry[3:]
+		if code[0] == 'R' || code[0] == 'C' {
+			// The source path follows as the next entry.
+			i++
+		}
+
+		dir := "."
+		if slash := strings.Index(path, "/"); slash >= 0 {
+			dir = path[:slash]
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = &counts{}
+		}
+		switch code[0] {
+		case 'A':
+			dirs[dir].added++
+			total.added++
+		case 'D':
+			dirs[dir].deleted++
+			total.deleted++
+		default:
+			dirs[dir].modified++
+			total.modified++
+		}
+	}
+	if len(dirs) == 0 {
+		return ""
+	}
+
+	var names []string
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+	sort.Strings(names)
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "Sync %s: %d added, %d modified, %d deleted\n\n", time.Now().UTC().Format(time.RFC3339), total.added, total.modified, total.deleted)
+	for _, dir := range names {
+		c := dirs[dir]
+		fmt.Fprintf(&message, "%s: %d added, %d modified, %d deleted\n", dir, c.added, c.modified, c.deleted)
+	}
+	return message.String()
+}
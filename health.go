@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// syncHealth tracks the syncs of watch, serve --watch and webhook for the
+// /healthz and /readyz endpoints.
+var syncHealth = struct {
+	sync.Mutex
+	started     time.Time
+	syncingAt   time.Time
+	lastSync    time.Time
+	lastSuccess time.Time
+	syncs       int
+	failed      int
+	errors      map[errorKind]int
+	lastErrors  map[errorKind]int
+	before      map[errorKind]int
+}{started: time.Now(), errors: make(map[errorKind]int)}
+
+// stuckAfter is how long a sync may run before /healthz reports the syncer
+// as wedged.
+var stuckAfter = 30 * time.Minute
+
+type healthStatus struct {
+	Status       string         `json:"status"`
+	Started      time.Time      `json:"started"`
+	SyncingSince *time.Time     `json:"syncing_since,omitempty"`
+	LastSync     *time.Time     `json:"last_sync,omitempty"`
+	LastSuccess  *time.Time     `json:"last_success,omitempty"`
+	Syncs        int            `json:"syncs"`
+	FailedSyncs  int            `json:"failed_syncs"`
+	Errors       map[string]int `json:"errors"`
+	LastErrors   map[string]int `json:"last_errors,omitempty"`
+}
+
+func beginSync() {
+	traceSyncStart()
+	resetRequestLog()
+	resetRejections()
+	resetChanges()
+	before := snapshotErrors()
+	syncHealth.Lock()
+	defer syncHealth.Unlock()
+	syncHealth.syncingAt = time.Now()
+	syncHealth.before = before
+}
+
+// endSync counts the errors recorded since beginSync, a sync without any is
+// a success.
+func endSync() {
+	defer traceSyncEnd()
+	after := snapshotErrors()
+	syncHealth.Lock()
+	defer syncHealth.Unlock()
+
+	now := time.Now()
+	syncHealth.syncingAt = time.Time{}
+	syncHealth.lastSync = now
+	syncHealth.syncs++
+	syncHealth.lastErrors = make(map[errorKind]int)
+	for kind, count := range after {
+		if count > syncHealth.before[kind] {
+			syncHealth.lastErrors[kind] = count - syncHealth.before[kind]
+			syncHealth.errors[kind] += count - syncHealth.before[kind]
+		}
+	}
+	if cfg.Report != "" {
+		writeReport(syncHealth.lastErrors)
+	}
+	if len(syncHealth.lastErrors) == 0 {
+		if syncHealth.lastSuccess.IsZero() && readyFile != "" {
+			writeReadyFile()
+		}
+		syncHealth.lastSuccess = now
+	} else {
+		syncHealth.failed++
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func errorCounts(counts map[errorKind]int) map[string]int {
+	named := make(map[string]int)
+	for kind, count := range counts {
+		named[string(kind)] = count
+	}
+	return named
+}
+
+// currentHealth reports whether the syncer is alive, i.e. no sync is stuck,
+// and whether it is ready, i.e. a sync succeeded since the start. Without
+// syncs to wait for, like serve without --watch, it is ready right away.
+func currentHealth(syncing bool) (status healthStatus, alive, ready bool) {
+	syncHealth.Lock()
+	defer syncHealth.Unlock()
+
+	status = healthStatus{
+		Status:       "ok",
+		Started:      syncHealth.started,
+		SyncingSince: optionalTime(syncHealth.syncingAt),
+		LastSync:     optionalTime(syncHealth.lastSync),
+		LastSuccess:  optionalTime(syncHealth.lastSuccess),
+		Syncs:        syncHealth.syncs,
+		FailedSyncs:  syncHealth.failed,
+		Errors:       errorCounts(syncHealth.errors),
+	}
+	if len(syncHealth.lastErrors) > 0 {
+		status.LastErrors = errorCounts(syncHealth.lastErrors)
+	}
+	alive = syncHealth.syncingAt.IsZero() || time.Since(syncHealth.syncingAt) < stuckAfter
+	ready = !syncing || !syncHealth.lastSuccess.IsZero()
+	return status, alive, ready
+}
+
+// handleHealth adds /healthz and /readyz to mux. syncing tells whether the
+// command syncs by itself, /readyz then waits for the first successful sync.
+func handleHealth(mux *http.ServeMux, syncing bool) {
+	respond := func(w http.ResponseWriter, status healthStatus, ok bool, reason string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !ok {
+			status.Status = reason
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status, alive, _ := currentHealth(syncing)
+		respond(w, status, alive, "stuck")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		status, alive, ready := currentHealth(syncing)
+		reason := "not ready"
+		if !alive {
+			reason = "stuck"
+		}
+		respond(w, status, alive && ready, reason)
+	})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// historyVersion is the schema version written by this build. Older files
+// are upgraded by running historyMigrations[v] for every version v from the
+// file's version up to historyVersion-1.
+const historyVersion = 2
+
+const (
+	statusOK    = "ok"
+	statusError = "error"
+	// statusSkipped files were downloaded but aren't documentation or not
+	// in one of the --languages, they are checked again when they change or
+	// --languages allows their language.
+	statusSkipped = "skipped"
+	// statusRejected files failed a --validate check or were quarantined by
+	// --secret-scan, they are checked again when they change.
+	statusRejected = "rejected"
+	// statusRemoved files no longer exist upstream, their output is kept.
+	// They are downloaded again when they come back.
+	statusRemoved = "removed"
+)
+
+type History struct {
+	Version int                     `json:"version"`
+	Files   map[string]HistoryEntry `json:"files"`
+	Commits map[string]string       `json:"commits,omitempty"`
+}
+
+type HistoryEntry struct {
+	Sha          string    `json:"sha"`
+	Size         int       `json:"size"`
+	Status       string    `json:"status"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+	// Language is set for files skipped by --languages.
+	Language string `json:"language,omitempty"`
+}
+
+// historyTooNew is set when the history file was written by a newer build,
+// it is then left untouched instead of being downgraded.
+var historyTooNew bool
+
+type historyMigration func(raw map[string]json.RawMessage) error
+
+var historyMigrations = map[int]historyMigration{
+	// Files written before the schema was versioned have no version field
+	// but are otherwise identical to version 1.
+	0: func(raw map[string]json.RawMessage) error {
+		return nil
+	},
+	// Version 2 replaced the sha (or "ERROR") of every file by an entry
+	// with size, status and download time. Those weren't recorded before.
+	1: func(raw map[string]json.RawMessage) error {
+		if raw["files"] == nil {
+			return nil
+		}
+		var files map[string]string
+		if err := json.Unmarshal(raw["files"], &files); err != nil {
+			return err
+		}
+
+		entries := make(map[string]HistoryEntry)
+		for path, sha := range files {
+			if sha == "ERROR" {
+				entries[path] = HistoryEntry{Status: statusError}
+			} else {
+				entries[path] = HistoryEntry{Sha: sha, Status: statusOK}
+			}
+		}
+
+		var err error
+		raw["files"], err = json.Marshal(entries)
+		return err
+	},
+}
+
+func loadHistory() History {
+	history := History{
+		Version: historyVersion,
+		Files:   make(map[string]HistoryEntry),
+		Commits: make(map[string]string),
+	}
+
+	data, err := readStateFile(cfg.History)
+	if err != nil {
+		log.Warnf("Failed to open history file: %s\n", err)
+		return history
+	}
+
+	data, err = migrateHistory(data)
+	if err == nil {
+		err = json.Unmarshal(data, &history)
+	}
+	if err != nil {
+		log.Warnf("Failed to parse history file: %s\n", cfg.History)
+	}
+	if history.Files == nil {
+		history.Files = make(map[string]HistoryEntry)
+	}
+	if history.Commits == nil {
+		history.Commits = make(map[string]string)
+	}
+
+	return history
+}
+
+func migrateHistory(data []byte) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, err
+		}
+	}
+	if version > historyVersion {
+		historyTooNew = true
+		log.Warnf("History file %s has version %d, newer than the supported %d, it won't be updated\n", cfg.History, version, historyVersion)
+		return data, nil
+	}
+	if version == historyVersion {
+		return data, nil
+	}
+
+	for ; version < historyVersion; version++ {
+		log.Infof("Migrating history file %s from version %d to %d\n", cfg.History, version, version+1)
+		if err := historyMigrations[version](raw); err != nil {
+			return nil, err
+		}
+	}
+	raw["version"], _ = json.Marshal(historyVersion)
+
+	return json.Marshal(raw)
+}
+
+func saveHistory(history History) {
+	if historyTooNew {
+		return
+	}
+	history.Version = historyVersion
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "    ")
+	err := encoder.Encode(history)
+	if err == nil {
+		err = writeStateFile(cfg.History, buf.Bytes())
+	}
+	if err != nil {
+		log.Errorf("Failed to save history file %s: %s\n", cfg.History, err)
+	}
+}
+
+func newHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Query the download history",
+	}
+
+	var changedSince, staleFor, status string
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List files in the history, e.g. the ones changed in the last week",
+		Run: func(cmd *cobra.Command, args []string) {
+			var after, before time.Time
+			if changedSince != "" {
+				t, err := parseSince(changedSince)
+				if err != nil {
+					log.Errorf("%s\n", err)
+					return
+				}
+				after = t
+			}
+			if staleFor != "" {
+				t, err := parseSince(staleFor)
+				if err != nil {
+					log.Errorf("%s\n", err)
+					return
+				}
+				before = t
+			}
+
+			history := loadHistory()
+			paths := make([]string, 0, len(history.Files))
+			for path := range history.Files {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+
+			for _, path := range paths {
+				entry := history.Files[path]
+				if !after.IsZero() && entry.DownloadedAt.Before(after) {
+					continue
+				}
+				if !before.IsZero() && !entry.DownloadedAt.Before(before) {
+					continue
+				}
+				if status != "" && entry.Status != status {
+					continue
+				}
+
+				downloaded := "-"
+				if !entry.DownloadedAt.IsZero() {
+					downloaded = entry.DownloadedAt.Format(time.RFC3339)
+				}
+				fmt.Printf("%-25s %-5s %8d  %s\n", downloaded, entry.Status, entry.Size, path)
+			}
+		},
+	}
+	list.Flags().StringVar(&changedSince, "changed-since", "", "Only files downloaded since a date or duration (e.g. 7d)")
+	list.Flags().StringVar(&staleFor, "stale-for", "", "Only files not updated since a date or duration (e.g. 90d)")
+	list.Flags().StringVar(&status, "status", "", "Only files with this status (ok, error, skipped, rejected or removed)")
+	list.Flags().SetAnnotation("status", schemaEnum, []string{statusOK, statusError, statusSkipped, statusRejected, statusRemoved})
+
+	cmd.AddCommand(list, newHistoryExportCmd(), newHistoryImportCmd())
+	return cmd
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// The archive of history export holds the history as plain JSON, encrypted
+// histories are decrypted so the archive can be imported with another key.
+const exportHistory = "history.json"
+
+func newHistoryExportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "export <archive.tar.gz>",
+		Short: "Write the history and the output directory to an archive another machine can import",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportState(args[0]); err != nil {
+				log.Errorf("Failed to export history to %s: %s\n", args[0], err)
+				os.Exit(exitCodes[classifyError(err)])
+			}
+			log.Infof("Exported history and %s to %s\n", cfg.Output, args[0])
+		},
+	}
+}
+
+func newHistoryImportCmd() *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "import <archive.tar.gz>",
+		Short: "Seed the history and the output directory from an exported archive",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, err := os.Stat(cfg.History); err == nil && !force {
+				log.Errorf("History file %s already exists, use --force to replace it\n", cfg.History)
+				os.Exit(exitUsage)
+			}
+			if err := importState(args[0]); err != nil {
+				log.Errorf("Failed to import %s: %s\n", args[0], err)
+				os.Exit(exitCodes[classifyError(err)])
+			}
+			log.Infof("Imported %s into %s and %s\n", args[0], cfg.History, cfg.Output)
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Replace an existing history file")
+	return cmd
+}
+
+func exportState(archive string) error {
+	data, err := readStateFile(cfg.History)
+	if err != nil {
+		return err
+	}
+	if data, err = migrateHistory(data); err != nil {
+		return err
+	}
+	files, err := outputFiles()
+	if err != nil {
+		return err
+	}
+
+	tmp := archive + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = writeTarFile(tw, exportHistory, data)
+	if err == nil {
+		// Links to the blob cache are stored as files, the cache isn't part
+		// of the archive.
+		err = writeOutputFiles(tw, files, true)
+	}
+	for _, c := range []io.Closer{tw, gz, f} {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, archive)
+}
+
+// importState writes the files of an exported archive over the output
+// directory and replaces the history with the archived one.
+func importState(archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	var history *History
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case header.Name == exportHistory:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if data, err = migrateHistory(data); err != nil {
+				return err
+			}
+			if historyTooNew {
+				return fmt.Errorf("the history was exported by a newer version")
+			}
+			history = &History{}
+			if err := json.Unmarshal(data, history); err != nil {
+				return err
+			}
+		case strings.HasPrefix(header.Name, snapshotOutput):
+			// Exports dereference links, an archive with one wasn't made by
+			// history export.
+			if err := restoreOutputFile(header, tr, false); err != nil {
+				return err
+			}
+		}
+	}
+	if history == nil {
+		return fmt.Errorf("%s has no %s, not a history export", archive, exportHistory)
+	}
+
+	saveHistory(*history)
+	return nil
+}
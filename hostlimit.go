@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimit caps the requests sent to one host at rps per second.
+type hostLimit struct {
+	RPS float64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+var hostLimits map[string]*hostLimit
+
+// parseHostLimits reads --host-limit github.com=rps:5 into hostLimits.
+func parseHostLimits() error {
+	hostLimits = make(map[string]*hostLimit)
+	for _, l := range limits {
+		split := strings.SplitN(l, "=", 2)
+		if len(split) < 2 || split[0] == "" {
+			return fmt.Errorf("invalid host limit, expected host=rps:N: %s", l)
+		}
+
+		limit := &hostLimit{}
+		for _, option := range strings.Split(split[1], ",") {
+			kv := strings.SplitN(option, ":", 2)
+			if len(kv) < 2 {
+				return fmt.Errorf("invalid host limit: %s", l)
+			}
+			var err error
+			switch strings.TrimSpace(kv[0]) {
+			case "rps":
+				limit.RPS, err = strconv.ParseFloat(kv[1], 64)
+				if err == nil && limit.RPS <= 0 {
+					err = fmt.Errorf("must be positive")
+				}
+			default:
+				err = fmt.Errorf("unknown option %s", kv[0])
+			}
+			if err != nil {
+				return fmt.Errorf("invalid host limit %s: %s", l, err)
+			}
+		}
+		hostLimits[split[0]] = limit
+	}
+	return nil
+}
+
+func limitFor(host string) *hostLimit {
+	if host == "api.github.com" {
+		host = "github.com"
+	}
+	return hostLimits[host]
+}
+
+// wait waits for the next request allowed by the rate.
+func (l *hostLimit) wait() {
+	if l.RPS <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(time.Second) / l.RPS))
+	l.mu.Unlock()
+	time.Sleep(wait)
+}
+
+// limitTransport applies the --host-limit of the request's host. It sits
+// below the cache, cached responses don't count.
+type limitTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if limit := limitFor(req.URL.Host); limit != nil {
+		limit.wait()
+	}
+	return t.transport.RoundTrip(req)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// ignoreRule is one gitignore pattern: patterns without a slash match at any
+// depth, a trailing slash only matches directories and ! re-includes paths
+// an earlier pattern ignored.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	anchored := strings.Contains(line, "/")
+	rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	// A trailing ** matches what is inside the directory, not the
+	// directory itself, so its files can be re-included.
+	if n := len(rule.segments); n > 1 && rule.segments[n-1] == "**" {
+		rule.segments = append(rule.segments[:n-1], "*", "**")
+	}
+	return rule, true
+}
+
+// readIgnoreFile reads the patterns of a gitignore style file.
+func readIgnoreFile(file string) ([]ignoreRule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// ignoredBy applies rules like git does: the last matching rule decides, and
+// files in an ignored directory can't be re-included.
+func ignoredBy(rules []ignoreRule, filePath string) bool {
+	segments := strings.Split(filePath, "/")
+	for i := 1; i < len(segments); i++ {
+		if lastMatch(rules, segments[:i], true) {
+			return true
+		}
+	}
+	return lastMatch(rules, segments, false)
+}
+
+func lastMatch(rules []ignoreRule, segments []string, dir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !dir {
+			continue
+		}
+		if matchSegments(rule.segments, segments) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnoredBy(t *testing.T) {
+	tests := []struct {
+		patterns string
+		path     string
+		want     bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide.md", true},
+		{"/*.md", "docs/guide.md", false},
+		{"docs/", "docs/guide.md", true},
+		{"docs/", "docs.md", false},
+		{"guide.md/", "guide.md", false},
+		{"docs/*.md", "docs/a/guide.md", false},
+		{"docs/**/*.md", "docs/a/b/guide.md", true},
+		{"**/node_modules/", "a/node_modules/x/README.md", true},
+		{"*.md\n!README.md", "README.md", false},
+		{"*.md\n!README.md", "docs/guide.md", true},
+		{"drafts/\n!drafts/keep.md", "drafts/keep.md", true},
+		{"drafts/**\n!drafts/keep.md", "drafts/keep.md", false},
+		{"# comment\n\\#notes.md", "#notes.md", true},
+		{"# comment", "# comment", false},
+	}
+	for _, tt := range tests {
+		var rules []ignoreRule
+		for _, line := range strings.Split(tt.patterns, "\n") {
+			if rule, ok := parseIgnoreRule(line); ok {
+				rules = append(rules, rule)
+			}
+		}
+		if got := ignoredBy(rules, tt.path); got != tt.want {
+			t.Errorf("ignoredBy(%q, %s) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
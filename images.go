@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var htmlImage = regexp.MustCompile(`(?i)<img\s[^>]*src\s*=\s*["']([^"']+)["']`)
+
+type imageReference struct {
+	Line int
+	Path string
+}
+
+func newDeadImagesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "dead-images",
+		Short: "Report image references pointing to files that don't exist upstream or locally",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !setup() {
+				return
+			}
+
+			dead := 0
+			for _, repo := range cfg.Repos {
+				upstream, err := upstreamFiles(repo)
+				if err != nil {
+					continue
+				}
+
+				root := filepath.Join(cfg.Output, repoName(repo))
+				walkMarkdown(root, func(file, rel string, content []byte) {
+					dir := path.Dir(filepath.ToSlash(rel))
+					for _, image := range imageReferences(content) {
+						target, ok := repoImagePath(dir, image.Path)
+						if !ok || upstream[target] {
+							continue
+						}
+						if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(target))); err == nil {
+							continue
+						}
+						fmt.Printf("%s:%d: %s\n", file, image.Line, image.Path)
+						dead++
+					}
+				})
+			}
+			log.Infof("Found %d dead image references\n", dead)
+		},
+	}
+}
+
+func upstreamFiles(repo string) (map[string]bool, error) {
+	provider, repo, err := newProvider(httpClient(), repo)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := provider.ResolveRef(repoRef(repo))
+	if err != nil {
+		return nil, err
+	}
+	tree, err := provider.ListFiles(commit, "")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool)
+	for _, item := range tree {
+		files[item.Path] = true
+	}
+	return files, nil
+}
+
+// imageReferences returns the markdown and HTML images of a document.
+func imageReferences(content []byte) []imageReference {
+	var images []imageReference
+	doc := markdown.Parser().Parse(text.NewReader(content))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Image:
+			images = append(images, imageReference{Line: inlineLine(content, n), Path: string(n.Destination)})
+		case *ast.HTMLBlock, *ast.RawHTML:
+			var lines *text.Segments
+			if block, ok := n.(*ast.HTMLBlock); ok {
+				lines = block.Lines()
+			} else {
+				lines = n.(*ast.RawHTML).Segments
+			}
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				for _, match := range htmlImage.FindAllSubmatch(segment.Value(content), -1) {
+					images = append(images, imageReference{Line: lineAt(content, segment.Start), Path: string(match[1])})
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return images
+}
+
+// repoImagePath resolves an image reference of a document in dir to a path in
+// the repository. External images aren't checked.
+func repoImagePath(dir, reference string) (string, bool) {
+	u, err := url.Parse(reference)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	target := u.Path
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(path.Clean(target), "/"), true
+	}
+	return path.Clean(path.Join(dir, target)), true
+}
+
+// inlineLine returns the line of an inline node from its first text.
+func inlineLine(content []byte, n ast.Node) int {
+	for child := n.FirstChild(); child != nil; child = child.FirstChild() {
+		if textNode, ok := child.(*ast.Text); ok {
+			return lineAt(content, textNode.Segment.Start)
+		}
+	}
+	if paragraph := n.Parent(); paragraph != nil && paragraph.Type() == ast.TypeBlock {
+		return lineOf(content, paragraph)
+	}
+	return 0
+}
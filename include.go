@@ -0,0 +1,145 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+func isIncluded(filePath string) bool {
+	if len(cfg.Include) == 0 {
+		return true
+	}
+	for _, pattern := range cfg.Include {
+		if matchGlob(pattern, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTraversed applies --max-depth and --include-hidden: a file is synced when
+// it is at most that many directories deep and, unless hidden paths are
+// included, no directory it is in starts with a dot.
+func isTraversed(filePath string) bool {
+	dirs := strings.Split(filePath, "/")
+	dirs = dirs[:len(dirs)-1]
+	if cfg.MaxDepth >= 0 && len(dirs) > cfg.MaxDepth {
+		return false
+	}
+	if !cfg.IncludeHidden {
+		for _, dir := range dirs {
+			if strings.HasPrefix(dir, ".") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isMarkdown reports whether a file has one of the --markdown-extensions,
+// in any case.
+func isMarkdown(filePath string) bool {
+	ext := path.Ext(filePath)
+	for _, markdown := range cfg.Extensions {
+		if strings.EqualFold(ext, "."+strings.TrimPrefix(markdown, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAsset reports whether a non-markdown file should be mirrored. Patterns
+// without a slash match the file name in any directory.
+func isAsset(filePath string) bool {
+	for _, pattern := range cfg.Assets {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(filePath)); ok {
+				return true
+			}
+			continue
+		}
+		if matchGlob(pattern, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// governanceFiles are the license and community files mirrored with
+// --governance, whatever their extension.
+var governanceFiles = []string{"LICENSE", "LICENCE", "COPYING", "NOTICE", "CODE_OF_CONDUCT", "CONTRIBUTING", "SECURITY", "GOVERNANCE", "SUPPORT", "CODEOWNERS", "AUTHORS", "MAINTAINERS"}
+
+// isGovernanceFile reports whether a file is a governance file in one of the
+// places GitHub looks for them: the root, docs/ and .github/.
+func isGovernanceFile(filePath string) bool {
+	if !cfg.Governance {
+		return false
+	}
+	if dir := path.Dir(filePath); dir != "." && dir != "docs" && dir != ".github" {
+		return false
+	}
+
+	name := strings.ToUpper(path.Base(filePath))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	for _, governance := range governanceFiles {
+		if name == governance || strings.HasPrefix(name, governance+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// includePrefix returns the deepest directory shared by every include
+// pattern, the part of the tree that has to be listed to find all matches.
+func includePrefix() string {
+	var prefix []string
+	for i, pattern := range cfg.Include {
+		segments := strings.Split(strings.Trim(pattern, "/"), "/")
+		var literal []string
+		for _, segment := range segments[:len(segments)-1] {
+			if strings.ContainsAny(segment, "*?[") {
+				break
+			}
+			literal = append(literal, segment)
+		}
+
+		if i == 0 {
+			prefix = literal
+			continue
+		}
+		n := 0
+		for n < len(prefix) && n < len(literal) && prefix[n] == literal[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return strings.Join(prefix, "/")
+}
+
+// matchGlob matches a slash separated path against a pattern where "**"
+// matches any number of directories and other segments use path.Match.
+func matchGlob(pattern, filePath string) bool {
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(filePath, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+	return len(segments) == 0
+}
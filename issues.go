@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const issuesPerPage = 100
+
+type issueUser struct {
+	Login string `json:"login"`
+}
+
+type issue struct {
+	Number      int       `json:"number"`
+	Title       string    `json:"title"`
+	State       string    `json:"state"`
+	Body        string    `json:"body"`
+	HTMLURL     string    `json:"html_url"`
+	User        issueUser `json:"user"`
+	Comments    int       `json:"comments"`
+	CommentsURL string    `json:"comments_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Labels      []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+type issueComment struct {
+	User      issueUser `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// syncIssues saves the GitHub issues of a repository with their comments as
+// issues/<number>.md, with --issues. Only issues updated since they were last
+// saved are fetched again.
+func syncIssues(client *http.Client, repo string, history History) {
+	if isLocalRepo(repo) || isGist(repo) {
+		return
+	}
+	if remote, err := parseRemoteRepo(repo); err != nil || remote.Provider != providerGitHub {
+		log.Warnf("Issues are only supported for GitHub repositories: %s\n", repo)
+		return
+	}
+
+	query := url.Values{}
+	query.Set("state", "all")
+	query.Set("per_page", fmt.Sprint(issuesPerPage))
+	if len(cfg.IssueLabels) > 0 {
+		query.Set("labels", strings.Join(cfg.IssueLabels, ","))
+	}
+
+	for page := 1; ; page++ {
+		query.Set("page", fmt.Sprint(page))
+		var issues []issue
+		if err := getJSON(client, fmt.Sprintf("%s/repos/%s/issues?%s", apiURL, repo, query.Encode()), &issues); err != nil {
+			return
+		}
+
+		for _, i := range issues {
+			// The issues API also returns pull requests.
+			if i.PullRequest != nil {
+				continue
+			}
+			filePath := fmt.Sprintf("issues/%d.md", i.Number)
+			if entry, ok := history.Files[filePath]; ok && entry.Status == statusOK && entry.DownloadedAt.After(i.UpdatedAt) {
+				continue
+			}
+
+			var comments []issueComment
+			if i.Comments > 0 {
+				var err error
+				if comments, err = fetchIssueComments(client, i.CommentsURL); err != nil {
+					history.Files[filePath] = HistoryEntry{Status: statusError, DownloadedAt: time.Now()}
+					continue
+				}
+			}
+
+			content := []byte(issueMarkdown(i, comments))
+			saveGenerated(repo, filePath, content, history)
+		}
+
+		if len(issues) < issuesPerPage {
+			return
+		}
+	}
+}
+
+// fetchIssueComments follows the Link headers of the comments of an issue,
+// they come in pages of at most 100.
+func fetchIssueComments(client *http.Client, commentsURL string) ([]issueComment, error) {
+	var comments []issueComment
+	next := fmt.Sprintf("%s?per_page=%d", commentsURL, issuesPerPage)
+	for next != "" {
+		var page []issueComment
+		var err error
+		if next, err = getJSONPage(client, next, &page); err != nil {
+			return nil, err
+		}
+		comments = append(comments, page...)
+	}
+	return comments, nil
+}
+
+// yamlString quotes a string for front matter. It is written as JSON, which
+// YAML reads as well.
+func yamlString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// issueMarkdown renders an issue with its metadata as YAML front matter.
+func issueMarkdown(i issue, comments []issueComment) string {
+	var labels []string
+	for _, label := range i.Labels {
+		labels = append(labels, yamlString(label.Name))
+	}
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(i.Title))
+	fmt.Fprintf(&b, "number: %d\n", i.Number)
+	fmt.Fprintf(&b, "state: %s\n", i.State)
+	fmt.Fprintf(&b, "author: %s\n", yamlString(i.User.Login))
+	fmt.Fprintf(&b, "labels: [%s]\n", strings.Join(labels, ", "))
+	fmt.Fprintf(&b, "created_at: %s\n", i.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated_at: %s\n", i.UpdatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "url: %s\n", i.HTMLURL)
+	b.WriteString("---\n\n")
+	fmt.Fprintf(&b, "# %s\n", i.Title)
+	if body := strings.TrimSpace(i.Body); body != "" {
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+
+	for _, c := range comments {
+		fmt.Fprintf(&b, "\n---\n\n**%s** commented on %s:\n\n%s\n", c.User.Login, c.CreatedAt.Format("2006-01-02"), strings.TrimSpace(c.Body))
+	}
+	return b.String()
+}
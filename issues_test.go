@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestFetchIssueComments(t *testing.T) {
+	testConfig(t)
+	const total = 250
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		var comments []issueComment
+		for n := (page - 1) * 100; n < page*100 && n < total; n++ {
+			comments = append(comments, issueComment{Body: fmt.Sprint(n)})
+		}
+		if page*100 < total {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/comments?per_page=100&page=%d>; rel="next", <%s/comments?per_page=100&page=3>; rel="last"`, server.URL, page+1, server.URL))
+		}
+		json.NewEncoder(w).Encode(comments)
+	}))
+	defer server.Close()
+
+	comments, err := fetchIssueComments(server.Client(), server.URL+"/comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != total {
+		t.Fatalf("got %d comments, want %d", len(comments), total)
+	}
+	for n, c := range comments {
+		if c.Body != fmt.Sprint(n) {
+			t.Fatalf("comment %d is %q", n, c.Body)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultTerminationLog is where Kubernetes reads the termination message of
+// a container from.
+const defaultTerminationLog = "/dev/termination-log"
+
+// readyFile is created in the output directory after the first successful
+// sync, so the containers of a pod can wait for the docs. Only the k8s
+// commands set it.
+var readyFile string
+
+var terminationLog string
+
+func newK8sCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "k8s",
+		Short: "Sync into a volume shared with the other containers of a Kubernetes pod",
+	}
+	var ready string
+	cmd.PersistentFlags().StringVar(&ready, "ready-file", ".ready", "File created in the output directory after the first successful sync, empty to skip")
+	cmd.PersistentFlags().StringVar(&terminationLog, "termination-log", defaultTerminationLog, "File the outcome is written to when the container stops, shown by kubectl describe pod")
+
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Sync once as an init container, the exit code tells the kind of error",
+		Run: func(cmd *cobra.Command, args []string) {
+			readyFile = ready
+			if !setup() {
+				writeTerminationLog("invalid configuration, see the container log")
+				os.Exit(exitUsage)
+			}
+			unlock := lockOrExit()
+			beginSync()
+			for _, repo := range cfg.Repos {
+				listMdFiles(repo)
+			}
+			finishSync()
+			endSync()
+			unlock()
+
+			counts := snapshotErrors()
+			code := reportErrors()
+			if code == exitOK {
+				writeTerminationLog(fmt.Sprintf("synced %d repositories to %s", len(cfg.Repos), cfg.Output))
+			} else {
+				writeTerminationLog("sync failed: " + errorSummary(counts))
+			}
+			os.Exit(code)
+		},
+	}
+
+	var interval time.Duration
+	var healthAddr string
+	sidecarCmd := &cobra.Command{
+		Use:   "sidecar",
+		Short: "Keep the volume in sync next to the containers serving it",
+		Run: func(cmd *cobra.Command, args []string) {
+			readyFile = ready
+			if !setup() {
+				writeTerminationLog("invalid configuration, see the container log")
+				os.Exit(exitUsage)
+			}
+			if healthAddr != "" {
+				mux := http.NewServeMux()
+				handleHealth(mux, true)
+				go func() {
+					if err := http.ListenAndServe(healthAddr, mux); err != nil {
+						log.Errorf("Failed to serve health checks: %s\n", err)
+						writeTerminationLog("failed to serve health checks: " + err.Error())
+						os.Exit(1)
+					}
+				}()
+			}
+			watchRepos(interval)
+		},
+	}
+	sidecarCmd.Flags().DurationVar(&interval, "interval", 5*time.Minute, "Time between syncs")
+	sidecarCmd.Flags().StringVar(&healthAddr, "health-addr", ":8081", "Serve /healthz and /readyz for the probes on this address, empty to disable")
+	sidecarCmd.Flags().DurationVar(&stuckAfter, "stuck-after", 30*time.Minute, "How long a sync may run before /healthz fails")
+
+	cmd.AddCommand(initCmd, sidecarCmd)
+	return cmd
+}
+
+func writeReadyFile() {
+	file := filepath.Join(cfg.Output, readyFile)
+	if err := ioutil.WriteFile(file, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		log.Warnf("Failed to write ready file %s: %s\n", file, err)
+	}
+}
+
+// writeTerminationLog leaves a message for Kubernetes, which creates the
+// file in containers. Outside of them the default path doesn't exist and
+// nothing is written.
+func writeTerminationLog(message string) {
+	if terminationLog == "" {
+		return
+	}
+	if _, err := os.Stat(terminationLog); err != nil && terminationLog == defaultTerminationLog {
+		return
+	}
+	if err := ioutil.WriteFile(terminationLog, []byte(message+"\n"), 0644); err != nil {
+		log.Warnf("Failed to write termination log: %s\n", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// The language of a markdown file is the lang, language or locale field of
+// its front matter, otherwise it is guessed from its prose: by the script
+// for languages that have their own, by the most common words for those
+// written in Latin letters. --languages keeps only files in some languages,
+// --route-language writes them to <output>/<lang>/<repo>/<path>.
+var languageFields = []string{"lang", "language", "locale"}
+
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "this", "you", "are", "be", "on", "as", "not", "or", "can", "if"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "eine", "zu", "sie", "auf", "für", "sich", "dem", "auch", "es", "wird", "oder"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "pour", "dans", "que", "pas", "sur", "du", "avec", "il", "vous", "ce", "qui", "au"},
+	"es": {"el", "la", "los", "las", "que", "de", "y", "en", "un", "una", "es", "por", "para", "con", "no", "se", "del", "al", "como", "su"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "non", "sono", "del", "della", "con", "come", "si", "gli", "le", "questo", "è", "al"},
+	"pt": {"o", "a", "os", "as", "que", "de", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "por", "se", "mais", "como", "dos"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "voor", "met", "zijn", "je", "ook", "als", "er", "aan", "bij", "wordt"},
+	"pl": {"i", "w", "nie", "się", "na", "z", "do", "jest", "to", "że", "jak", "o", "dla", "po", "czy", "ale", "od", "przez", "tym", "są"},
+}
+
+// stopwordLanguages fixes the order in which ties are decided.
+var stopwordLanguages = []string{"en", "de", "fr", "es", "it", "pt", "nl", "pl"}
+
+var scripts = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"ru", unicode.Cyrillic},
+	{"ar", unicode.Arabic},
+	{"el", unicode.Greek},
+	{"he", unicode.Hebrew},
+	{"hi", unicode.Devanagari},
+	{"th", unicode.Thai},
+}
+
+var inlineNoise = regexp.MustCompile("`[^`]*`|<[^>\n]+>|\\]\\([^)]*\\)|https?://\\S+")
+
+// normalizeLanguage turns en_US and EN-us into en-us.
+func normalizeLanguage(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
+
+// detectLanguage returns the language of a markdown file, --default-lang
+// when it can't be told.
+func detectLanguage(content []byte) string {
+	fields := parseFrontMatter(content)
+	for _, field := range languageFields {
+		if values := frontMatterStrings(fields, field); len(values) > 0 && strings.TrimSpace(values[0]) != "" {
+			return normalizeLanguage(values[0])
+		}
+	}
+	if lang := guessLanguage(prose(content)); lang != "" {
+		return lang
+	}
+	return normalizeLanguage(cfg.DefaultLang)
+}
+
+// prose returns the text of a markdown file without front matter, code and
+// URLs.
+func prose(content []byte) string {
+	var text strings.Builder
+	fence := ""
+	for _, line := range strings.Split(string(content[frontMatterEnd(content):]), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case strings.HasPrefix(line, "    "), strings.HasPrefix(line, "\t"):
+		default:
+			text.WriteString(inlineNoise.ReplaceAllString(line, " "))
+			text.WriteString("\n")
+		}
+	}
+	return text.String()
+}
+
+func guessLanguage(text string) string {
+	letters := 0
+	counts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[s.lang]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// Japanese mixes kana with kanji, any kana makes Han text Japanese.
+	if counts["ja"] > 0 && counts["zh"] > 0 {
+		counts["ja"] += counts["zh"]
+		counts["zh"] = 0
+	}
+	best, bestCount := "", 0
+	for _, s := range scripts {
+		if counts[s.lang] > bestCount {
+			best, bestCount = s.lang, counts[s.lang]
+		}
+	}
+	if bestCount*3 > letters {
+		return best
+	}
+
+	hits := make(map[string]int)
+	for _, word := range wordPattern.FindAllString(strings.ToLower(text), -1) {
+		for _, lang := range stopwordLanguages {
+			for _, stopword := range stopwords[lang] {
+				if word == stopword {
+					hits[lang]++
+					break
+				}
+			}
+		}
+	}
+	best, bestCount = "", 0
+	for _, lang := range stopwordLanguages {
+		if hits[lang] > bestCount {
+			best, bestCount = lang, hits[lang]
+		}
+	}
+	// A handful of common words isn't enough to tell.
+	if bestCount < 3 {
+		return ""
+	}
+	return best
+}
+
+// languageMatches tells whether a language is one of the list, en matching
+// en-us too.
+func languageMatches(lang string, list []string) bool {
+	for _, l := range list {
+		l = normalizeLanguage(l)
+		if lang == l || strings.HasPrefix(lang, l+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// languageAllowed applies --languages to a markdown file. Files whose
+// language can't be told are kept.
+func languageAllowed(filePath string, content []byte) (bool, string) {
+	if len(cfg.Languages) == 0 || !isMarkdown(filePath) {
+		return true, ""
+	}
+	lang := detectLanguage(content)
+	return lang == "" || languageMatches(lang, cfg.Languages), lang
+}
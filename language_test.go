@@ -0,0 +1,96 @@
+package main
+
+import "testing"
+
+func TestGuessLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"no letters", "1234 -- !!", ""},
+		{"english", "This is the guide to the tool and it is meant for you.", "en"},
+		{"german", "Das ist die Anleitung und sie ist nicht mit dem Werkzeug.", "de"},
+		{"french", "Le guide est pour vous et les outils sont dans la page.", "fr"},
+		{"polish", "To jest przewodnik i nie jest dla tych, którzy się spieszą.", "pl"},
+		{"too few common words", "Kubernetes operator the Helm chart.", ""},
+		{"japanese kana with kanji", "これは日本語の文書です。", "ja"},
+		{"chinese", "这是中文文档。", "zh"},
+		{"russian", "Это документация на русском языке.", "ru"},
+		{"script in a minority", "Install the tool and run it, this is the way: 设置", "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guessLanguage(tt.text); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	testConfig(t)
+	cfg.DefaultLang = "EN_us"
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"front matter lang", "---\nlang: de_DE\n---\nThis is the guide to the tool and it is for you.\n", "de-de"},
+		{"front matter locale", "---\nlocale: fr\n---\n# Title\n", "fr"},
+		{"guessed from prose", "# Titel\n\nDas ist die Anleitung und sie ist nicht mit dem Werkzeug.\n", "de"},
+		{"code is ignored", "# Guide\n\n```\nthe and of to is in that it for with\n```\n", "en-us"},
+		{"default", "# Guide\n", "en-us"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage([]byte(tt.content)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguageMatches(t *testing.T) {
+	tests := []struct {
+		lang string
+		list []string
+		want bool
+	}{
+		{"en-us", []string{"en"}, true},
+		{"en", []string{"EN"}, true},
+		{"en", []string{"en-us"}, false},
+		{"eng", []string{"en"}, false},
+		{"pt-br", []string{"de", "pt_BR"}, true},
+	}
+	for _, tt := range tests {
+		if got := languageMatches(tt.lang, tt.list); got != tt.want {
+			t.Errorf("languageMatches(%q, %v) = %v, want %v", tt.lang, tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestSyncFileLanguageSkipped(t *testing.T) {
+	testConfig(t)
+	content := "This is the guide, and it is written in English for the readers of the docs.\n"
+	provider := &fakeProvider{files: map[string]string{"guide.md": content}}
+	item := provider.item("guide.md", content)
+	history := History{Version: historyVersion, Files: make(map[string]HistoryEntry)}
+
+	cfg.Languages = []string{"de"}
+	syncFile(testRepo, "commit", item, history, provider, nil)
+	if entry := history.Files["guide.md"]; entry.Status != statusSkipped || entry.Sha != item.Sha || entry.Language != "en" {
+		t.Fatalf("got history %+v", entry)
+	}
+	syncFile(testRepo, "commit", item, history, provider, nil)
+	if len(provider.fetched) != 1 {
+		t.Errorf("a skipped file was downloaded again: %v", provider.fetched)
+	}
+
+	cfg.Languages = []string{"de", "en"}
+	syncFile(testRepo, "commit", item, history, provider, nil)
+	if history.Files["guide.md"].Status != statusOK || readOutput(t, "guide.md") != content {
+		t.Errorf("got history %+v once English is allowed", history.Files["guide.md"])
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	linkCopy     = "copy"
+	linkHardlink = "hardlink"
+	linkSymlink  = "symlink"
+)
+
+// linkedBlobs remembers the first output path of every blob written during
+// this run, used as the link target.
+var linkedBlobs = struct {
+	sync.Mutex
+	paths map[string]string
+}{paths: make(map[string]string)}
+
+// linkFile creates the output file as a hard or symbolic link to another
+// output file with the same blob instead of writing the bytes again. Links
+// stay within the output, symbolic ones are relative so the output can be
+// moved. It fails when there is no copy to link to yet, the caller then
+// writes the file.
+func linkFile(path, sha string, content []byte) error {
+	linkedBlobs.Lock()
+	target := linkedBlobs.paths[sha]
+	linkedBlobs.Unlock()
+	if target == "" || target == path {
+		return fmt.Errorf("no copy of %s to link to", sha)
+	}
+	if _, err := os.Stat(target); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		log.Errorf("Failed to create directory: %s\n", path)
+		return err
+	}
+	keepVersion(path, content)
+	os.Remove(path)
+
+	var err error
+	if cfg.Link == linkSymlink {
+		var rel string
+		if rel, err = filepath.Rel(filepath.Dir(path), target); err == nil {
+			err = os.Symlink(rel, path)
+		}
+	} else {
+		err = os.Link(target, path)
+	}
+	if err != nil {
+		log.Debugf("Failed to link %s to %s, copying instead: %s\n", path, target, err)
+		return err
+	}
+
+	log.Infof("File linked: %s -> %s\n", path, target)
+	return nil
+}
+
+func rememberLinkTarget(path, sha string) {
+	linkedBlobs.Lock()
+	defer linkedBlobs.Unlock()
+	if _, ok := linkedBlobs.paths[sha]; !ok {
+		linkedBlobs.paths[sha] = path
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkFile(t *testing.T) {
+	for _, mode := range []string{linkHardlink, linkSymlink} {
+		t.Run(mode, func(t *testing.T) {
+			testConfig(t)
+			cfg.Link = mode
+			linkedBlobs.paths = make(map[string]string)
+			content := []byte("# Shared\n")
+			first := filepath.Join(cfg.Output, "docs", "a.md")
+			second := filepath.Join(cfg.Output, "docs", "sub", "b.md")
+
+			if err := linkFile(second, "abc", content); err == nil {
+				t.Fatal("linked without a copy to link to")
+			}
+			os.MkdirAll(filepath.Dir(first), os.ModePerm)
+			if err := ioutil.WriteFile(first, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			rememberLinkTarget(first, "abc")
+			if err := linkFile(second, "abc", content); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := ioutil.ReadFile(second); err != nil || string(got) != string(content) {
+				t.Fatalf("got %q, %v", got, err)
+			}
+			if mode == linkSymlink {
+				target, err := os.Readlink(second)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := filepath.Join("..", "a.md"); target != want {
+					t.Errorf("symlink to %s, want %s", target, want)
+				}
+			}
+		})
+	}
+}
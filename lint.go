@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var referenceDefinition = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:\s*\S`)
+
+type lintProblem struct {
+	File    string
+	Line    int
+	Rule    string
+	Message string
+}
+
+func (p lintProblem) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", p.File, p.Line, p.Rule, p.Message)
+}
+
+func newLintCmd() *cobra.Command {
+	var fail bool
+	var maxLineLength int
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Report markdown problems in the downloaded files",
+		Run: func(cmd *cobra.Command, args []string) {
+			var problems []lintProblem
+			walkMarkdown(cfg.Output, func(file, rel string, content []byte) {
+				problems = append(problems, lintMarkdown(filepath.ToSlash(rel), content, maxLineLength)...)
+			})
+			sort.SliceStable(problems, func(i, j int) bool {
+				return problems[i].File < problems[j].File
+			})
+
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			log.Infof("Found %d problems\n", len(problems))
+			if fail && len(problems) > 0 {
+				os.Exit(exitLint)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&fail, "fail", false, "Exit with status 11 when problems are found")
+	cmd.Flags().IntVar(&maxLineLength, "max-line-length", 120, "Report lines longer than this, 0 to disable")
+
+	return cmd
+}
+
+func lintMarkdown(file string, content []byte, maxLineLength int) []lintProblem {
+	var problems []lintProblem
+	problems = append(problems, lintHeadings(file, content)...)
+	problems = append(problems, lintReferences(file, content)...)
+	if maxLineLength > 0 {
+		problems = append(problems, lintLineLength(file, content, maxLineLength)...)
+	}
+	return problems
+}
+
+// lintHeadings reports headings that skip a level, e.g. a ### below a #.
+func lintHeadings(file string, content []byte) []lintProblem {
+	var problems []lintProblem
+	doc := markdown.Parser().Parse(text.NewReader(content))
+
+	previous := 0
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if previous > 0 && heading.Level > previous+1 {
+			problems = append(problems, lintProblem{
+				File:    file,
+				Line:    lineOf(content, heading),
+				Rule:    "heading-increment",
+				Message: fmt.Sprintf("heading level %d follows level %d", heading.Level, previous),
+			})
+		}
+		previous = heading.Level
+		return ast.WalkSkipChildren, nil
+	})
+	return problems
+}
+
+// lintReferences reports link reference definitions that no link uses.
+// Fenced code blocks neither define nor use references.
+func lintReferences(file string, content []byte) []lintProblem {
+	var problems []lintProblem
+	lines := strings.Split(string(content), "\n")
+
+	var usage strings.Builder
+	definitions := make(map[int]string)
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			continue
+		}
+		if match := referenceDefinition.FindStringSubmatch(line); match != nil {
+			definitions[i] = match[1]
+			continue
+		}
+		usage.WriteString(strings.ToLower(line) + "\n")
+	}
+
+	for i, label := range definitions {
+		if !strings.Contains(usage.String(), "["+strings.ToLower(label)+"]") {
+			problems = append(problems, lintProblem{
+				File:    file,
+				Line:    i + 1,
+				Rule:    "unused-reference",
+				Message: fmt.Sprintf("reference [%s] is never used", label),
+			})
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// lintLineLength reports long lines outside code blocks and tables. Lines with
+// a URL are left alone, they can't be wrapped.
+func lintLineLength(file string, content []byte, max int) []lintProblem {
+	var problems []lintProblem
+	fenced := false
+	for i, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		if fenced || strings.HasPrefix(trimmed, "|") || strings.Contains(line, "://") {
+			continue
+		}
+		if length := utf8.RuneCountInString(line); length > max {
+			problems = append(problems, lintProblem{
+				File:    file,
+				Line:    i + 1,
+				Rule:    "line-length",
+				Message: fmt.Sprintf("line is %d characters long, the limit is %d", length, max),
+			})
+		}
+	}
+	return problems
+}
+
+func lineOf(content []byte, n ast.Node) int {
+	if n.Lines().Len() == 0 {
+		return 0
+	}
+	return lineAt(content, n.Lines().At(0).Start)
+}
+
+func lineAt(content []byte, offset int) int {
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
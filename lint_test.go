@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestLintReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []int
+	}{
+		{"used", "See [docs].\n\n[docs]: https://example.com\n", nil},
+		{"unused", "Text.\n\n[docs]: https://example.com\n", []int{3}},
+		{"case insensitive", "See [Docs].\n\n[docs]: https://example.com\n", nil},
+		{"definition in a code block", "```\n[docs]: https://example.com\n```\n", nil},
+		{"use in a code block", "~~~md\nSee [docs].\n~~~\n\n[docs]: https://example.com\n", []int{5}},
+		{"unclosed fence", "```\n[docs]: https://example.com\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, problem := range lintReferences("a.md", []byte(tt.content)) {
+				got = append(got, problem.Line)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+				t.Errorf("got problems on lines %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
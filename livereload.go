@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const reloadPath = "/_reload"
+
+// reloader polls the output directory and tells connected browsers which
+// files changed, pages showing one of them reload themselves.
+type reloader struct {
+	mu      sync.Mutex
+	clients map[chan string]bool
+	// onChange is called once for every poll that found changes.
+	onChange func()
+}
+
+func newReloader() *reloader {
+	return &reloader{clients: make(map[chan string]bool)}
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events := make(chan string, 16)
+	rl.mu.Lock()
+	rl.clients[events] = true
+	rl.mu.Unlock()
+	defer func() {
+		rl.mu.Lock()
+		delete(rl.clients, events)
+		rl.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	for {
+		select {
+		case urlPath := <-events:
+			fmt.Fprintf(w, "data: %s\n\n", urlPath)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (rl *reloader) broadcast(urlPath string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for events := range rl.clients {
+		select {
+		case events <- urlPath:
+		default:
+			// A client that doesn't keep up misses the event rather than
+			// blocking the others.
+		}
+	}
+}
+
+func (rl *reloader) watch(root string, interval time.Duration) {
+	modified := scanModTimes(root)
+	for {
+		time.Sleep(interval)
+		current := scanModTimes(root)
+		var changed []string
+		for file, modTime := range current {
+			if old, ok := modified[file]; !ok || !old.Equal(modTime) {
+				changed = append(changed, file)
+			}
+		}
+		for file := range modified {
+			if _, ok := current[file]; !ok {
+				changed = append(changed, file)
+			}
+		}
+		modified = current
+
+		if len(changed) > 0 && rl.onChange != nil {
+			rl.onChange()
+		}
+		for _, file := range changed {
+			rl.broadcast(file)
+		}
+	}
+}
+
+// scanModTimes returns the modification time of every file below root, keyed
+// by its URL path.
+func scanModTimes(root string) map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, file); err == nil {
+			modTimes["/"+filepath.ToSlash(rel)] = info.ModTime()
+		}
+		return nil
+	})
+	return modTimes
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const localPrefix = "file://"
+
+func isLocalRepo(repo string) bool {
+	return strings.HasPrefix(repo, localPrefix)
+}
+
+// parseLocalRepo splits file:///path/to/clone@branch into the path and the
+// revision, an empty revision means the clone's HEAD.
+func parseLocalRepo(repo string) (string, string) {
+	path := strings.TrimPrefix(repo, localPrefix)
+	if i := strings.LastIndex(path, "@"); i > strings.LastIndex(path, "/") {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+func openLocalRepo(repo string) (*git.Repository, error) {
+	path, _ := parseLocalRepo(repo)
+
+	r, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		log.Errorf("Failed to open local repository %s: %s\n", path, err)
+		return nil, err
+	}
+	return r, nil
+}
+
+type localProvider struct {
+	r *git.Repository
+}
+
+func (p *localProvider) ResolveRef(ref string) (string, error) {
+	resolved, err := p.r.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		log.Errorf("Failed to resolve %s: %s\n", ref, err)
+		return "", err
+	}
+	return resolved.String(), nil
+}
+
+func (p *localProvider) ListFiles(commit, dir string) ([]treeItem, error) {
+	c, err := p.r.CommitObject(plumbing.NewHash(commit))
+	if err != nil {
+		log.Errorf("Failed to read commit %s: %s\n", commit, err)
+		return nil, err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		log.Errorf("Failed to read tree of %s: %s\n", commit, err)
+		return nil, err
+	}
+
+	prefix := dir
+	if prefix != "" {
+		tree, err = tree.Tree(prefix)
+		if err != nil {
+			log.Warnf("Path %s not found in %s\n", prefix, commit)
+			return nil, nil
+		}
+		prefix += "/"
+	}
+
+	var items []treeItem
+	err = tree.Files().ForEach(func(f *object.File) error {
+		items = append(items, treeItem{
+			Path: prefix + f.Name,
+			Mode: f.Mode.String(),
+			Type: "blob",
+			Sha:  f.Hash.String(),
+			Size: int(f.Size),
+		})
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Failed to list tree of %s: %s\n", commit, err)
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (p *localProvider) FetchFile(item treeItem) ([]byte, error) {
+	blob, err := p.r.BlobObject(plumbing.NewHash(item.Sha))
+	if err != nil {
+		log.Errorf("Failed to read blob %s: %s\n", item.Sha, err)
+		return nil, err
+	}
+
+	reader, err := blob.Reader()
+	if err != nil {
+		log.Errorf("Failed to read blob %s: %s\n", item.Sha, err)
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
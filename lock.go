@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errLocked = errors.New("locked by another sync")
+
+// lockOutput takes the lock of the output directory, a <output>.lock file
+// next to it, so overlapping runs don't write the same files and history.
+// The lock is released when the returned function is called or the process
+// exits. Another run holding it is waited for up to --lock-timeout.
+func lockOutput() (func(), error) {
+	path := filepath.Clean(cfg.Output) + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(cfg.LockTimeout)
+	waiting := false
+	for {
+		err = tryLock(f)
+		if err != errLocked || !time.Now().Before(deadline) {
+			break
+		}
+		if !waiting {
+			log.Infof("Waiting for the sync holding %s%s\n", path, lockHolder(path))
+			waiting = true
+		}
+		time.Sleep(time.Second)
+	}
+	if err == errLocked {
+		holder := lockHolder(path)
+		f.Close()
+		return nil, fmt.Errorf("%s is %w%s", cfg.Output, errLocked, holder)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// The PID is only informational, the lock itself is the flock.
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return func() {
+		f.Truncate(0)
+		unlock(f)
+		f.Close()
+	}, nil
+}
+
+// lockOrExit takes the output lock for a one-off sync, exiting with
+// exitLocked when another sync holds it.
+func lockOrExit() func() {
+	unlock, err := lockOutput()
+	if err == nil {
+		return unlock
+	}
+	log.Errorf("%s\n", err)
+	if errors.Is(err, errLocked) {
+		os.Exit(exitLocked)
+	}
+	os.Exit(exitCodes[classifyError(err)])
+	return nil
+}
+
+func lockHolder(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if pid := strings.TrimSpace(string(data)); err == nil && pid != "" {
+		return " (pid " + pid + ")"
+	}
+	return ""
+}
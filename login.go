@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+func newLoginCmd() *cobra.Command {
+	var host string
+
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Save an access token in the OS keyring",
+		Run: func(cmd *cobra.Command, args []string) {
+			token := cfg.AccessToken
+			if token == "" {
+				var err error
+				if token, err = readToken(host); err != nil {
+					log.Errorf("Failed to read token: %s\n", err)
+					return
+				}
+			}
+			if token == "" {
+				log.Errorf("No token given\n")
+				return
+			}
+
+			if err := keyring.Set(keyringService, host, token); err != nil {
+				log.Errorf("Failed to save token in keyring: %s\n", err)
+				return
+			}
+			log.Infof("Token for %s saved in keyring\n", host)
+		},
+	}
+	cmd.Flags().StringVar(&host, "host", "github.com", "Host the token is used for")
+
+	return cmd
+}
+
+func newLogoutCmd() *cobra.Command {
+	var host string
+
+	cmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Remove an access token from the OS keyring",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := keyring.Delete(keyringService, host); err != nil && err != keyring.ErrNotFound {
+				log.Errorf("Failed to remove token from keyring: %s\n", err)
+				return
+			}
+			log.Infof("Token for %s removed from keyring\n", host)
+		},
+	}
+	cmd.Flags().StringVar(&host, "host", "github.com", "Host the token is used for")
+
+	return cmd
+}
+
+func readToken(host string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "Token for %s: ", host)
+		token, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimSpace(string(token)), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
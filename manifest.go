@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const manifestFile = "manifest.json"
+
+type manifestEntry struct {
+	Repo         string     `json:"repo,omitempty"`
+	Path         string     `json:"path"`
+	SourcePath   string     `json:"source_path,omitempty"`
+	Sha          string     `json:"sha,omitempty"`
+	Size         int64      `json:"size"`
+	Title        string     `json:"title,omitempty"`
+	DownloadedAt *time.Time `json:"downloaded_at,omitempty"`
+	ModifiedAt   time.Time  `json:"modified_at"`
+}
+
+// writeManifest lists every file of the output directory in manifest.json.
+// Files are matched to their repository by the repository's directory, which
+// may be nested below a --route-by directory. Generated files have no repo.
+func writeManifest() {
+	history := loadHistory()
+	repos := make(map[string]string)
+	for _, repo := range cfg.Repos {
+		repos[repoName(repo)] = repo
+	}
+
+	var entries []manifestEntry
+	filepath.Walk(cfg.Output, func(file string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(cfg.Output, file)
+		if err != nil || rel == manifestFile {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		entry := manifestEntry{Path: rel, Size: info.Size(), ModifiedAt: info.ModTime()}
+		segments := strings.Split(rel, "/")
+		for i := 0; i < len(segments)-1; i++ {
+			repo, ok := repos[segments[i]]
+			if !ok {
+				continue
+			}
+			sourcePath := strings.Join(segments[i+1:], "/")
+			if h, ok := history.Files[sourcePath]; ok {
+				entry.Repo, entry.SourcePath, entry.Sha = repo, sourcePath, h.Sha
+				if !h.DownloadedAt.IsZero() {
+					entry.DownloadedAt = &h.DownloadedAt
+				}
+				break
+			}
+		}
+		if isMarkdown(rel) {
+			if content, err := ioutil.ReadFile(file); err == nil {
+				entry.Title = documentTitle(content, path.Base(rel))
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		log.Errorf("Failed to encode manifest: %s\n", err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(cfg.Output, manifestFile), data, 0644); err != nil {
+		log.Errorf("Failed to write manifest: %s\n", err)
+	}
+}
@@ -1,33 +1,113 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 type Config struct {
-	AccessToken string
-	Repos       []string
-	Output      string
-	History     string
-	Ignore      map[string][]string
+	AccessToken      string
+	Repos            []string
+	Output           string
+	History          string
+	Progress         string
+	Ignore           map[string][]ignoreRule
+	Extensions       []string
+	Sniff            bool
+	Encoding         string
+	EOL              string
+	MaxDepth         int
+	IncludeHidden    bool
+	Filter           string
+	Place            string
+	WasmPlugins      []string
+	Transforms       map[string][]string
+	Resolve          map[string]string
+	DNSServer        string
+	Proxy            string
+	LockTimeout      time.Duration
+	PIDFile          string
+	ConfigMaps       string
+	ConfigMapPrefix  string
+	Namespace        string
+	KubeAPI          string
+	OTLPEndpoint     string
+	Report           string
+	SecretScan       string
+	QuarantineDir    string
+	Translate        []string
+	Translator       string
+	TranslatorKey    string
+	SourceLang       string
+	Languages        []string
+	RouteLanguage    bool
+	DefaultLang      string
+	GlobalIgnore     []ignoreRule
+	CacheDir         string
+	NoCache          bool
+	FullSync         bool
+	Transport        string
+	Include          []string
+	Assets           []string
+	Headers          http.Header
+	UserAgent        string
+	APIVersion       string
+	Since            time.Time
+	Providers        map[string]string
+	Tokens           map[string]string
+	CredentialHelper string
+	KeyFile          string
+	NoBlobCache      bool
+	Link             string
+	Offline          bool
+	TOC              []string
+	Governance       bool
+	ReadmeOnly       bool
+	Releases         bool
+	Issues           bool
+	IssueLabels      []string
+	Discussions      bool
+	Gists            []string
+	Sidecar          string
+	AuditLog         string
+	Snippets         bool
+	RouteBy          string
+	TagIndex         string
+	Diff             bool
+	Verbose          bool
+	KeepVersions     int
+	GitCommit        bool
+	Changes          bool
+	SitemapBaseURL   string
+	Theme            string
+	HighlightStyle   string
+	PlantUMLServer   string
 }
 
-type History struct {
-	Files map[string]string `json:"files"`
-}
+const apiURL = "https://api.github.com"
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
 
 var cfg Config
 var ignore []string
+var headers []string
+var since string
+var providers []string
+var tokens []string
+var limits []string
+var transforms []string
+var ignoreFiles []string
+var globalIgnore []string
 var log *logrus.Logger
 
 func main() {
@@ -37,144 +117,635 @@ func main() {
 	})
 
 	var rootCmd = &cobra.Command{
-		Use:   "md-reader",
-		Short: "MD Reader is a tool for downloading .md files from repositories",
-		Long:  `MD Reader is a tool for downloading .md files from repositories`,
+		Use:              "md-reader",
+		Version:          version,
+		Short:            "MD Reader is a tool for downloading .md files from repositories",
+		Long:             `MD Reader is a tool for downloading .md files from repositories`,
+		PersistentPreRun: loadConfig,
 		Run: func(cmd *cobra.Command, args []string) {
-			parseIgnorePaths()
+			if !setup() {
+				os.Exit(exitUsage)
+			}
+			unlock := lockOrExit()
+			beginSync()
 			for _, repo := range cfg.Repos {
 				listMdFiles(repo)
 			}
+			finishSync()
+			endSync()
+			unlock()
+			if code := reportErrors(); code != exitOK {
+				os.Exit(code)
+			}
 		},
 	}
 
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "YAML file with flag values (flag names as keys), flags given on the command line win")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Profile of the config file to use, its keys replace the top level ones")
 	rootCmd.PersistentFlags().StringVar(&cfg.AccessToken, "access-token", "", "Github Access Token")
-	rootCmd.PersistentFlags().StringSliceVar(&cfg.Repos, "repo", []string{}, "Github Repositories")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Repos, "repo", []string{}, "Repositories (GitHub, GitLab or Gitea URLs)")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Gists, "gists", []string{}, "Also sync the gists of these GitHub users that contain markdown")
+	rootCmd.PersistentFlags().StringArrayVar(&tokens, "token", []string{}, "Access token for another host (host=TOKEN), can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&limits, "host-limit", []string{}, "Limit the requests per second to a host (host=rps:N), can be repeated")
+	rootCmd.PersistentFlags().StringVar(&cfg.CredentialHelper, "credential-helper", "", "Command that prints tokens using git's credential helper protocol")
+	rootCmd.PersistentFlags().StringSliceVar(&providers, "provider", []string{}, "Provider of a self-hosted instance (host=github|gitlab|gitea)")
 	rootCmd.PersistentFlags().StringVar(&cfg.Output, "output", "docs", "Output Directory")
 	rootCmd.PersistentFlags().StringVar(&cfg.History, "history", "history.json", "History File")
-	rootCmd.PersistentFlags().StringSliceVar(&ignore, "ignore", []string{}, "Ignore paths")
+	rootCmd.PersistentFlags().StringVar(&cfg.KeyFile, "key-file", "", "Encrypt the history and progress files with this key file (or set MD_DOWNLOADER_PASSPHRASE)")
+	rootCmd.PersistentFlags().StringVar(&cfg.AuditLog, "audit-log", "", "Append every sync decision to this file as JSON lines")
+	rootCmd.PersistentFlags().DurationVar(&cfg.LockTimeout, "lock-timeout", 0, "How long to wait for another sync of the same output directory to finish, 0 to fail at once")
+	rootCmd.PersistentFlags().StringVar(&cfg.PIDFile, "pid-file", "", "Write the process ID of watch or serve to this file, SIGHUP then reloads the config file")
+	rootCmd.PersistentFlags().StringVar(&cfg.ConfigMaps, "configmaps", "", "Also write the output directory to Kubernetes ConfigMaps, one per repository (repo) or per file (file)")
+	rootCmd.PersistentFlags().StringVar(&cfg.ConfigMapPrefix, "configmap-prefix", "md-docs", "Name prefix of the ConfigMaps, ConfigMaps with it that a sync didn't write are deleted")
+	rootCmd.PersistentFlags().StringVar(&cfg.Namespace, "namespace", "", "Namespace of the ConfigMaps, the one of the pod by default")
+	rootCmd.PersistentFlags().StringVar(&cfg.KubeAPI, "kube-api", "", "Kubernetes API server URL outside of a cluster, authenticated with --token host=TOKEN")
+	rootCmd.PersistentFlags().StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", "", "Export OpenTelemetry traces of the syncs to this OTLP/HTTP collector, e.g. http://localhost:4318 (or set OTEL_EXPORTER_OTLP_ENDPOINT)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Report, "report", "", "Write a JSON report of each sync with its errors and the retries, latency and failure of every HTTP request to this file")
+	rootCmd.PersistentFlags().StringArrayVar(&validations, "validate", []string{}, "Check every file before writing it (marker:TEXT, regex:EXPR, max-size:BYTES or command:CMD), can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&redactions, "redact", []string{}, "Replace matches of a regular expression in every file before writing it (EXPR=>REPLACEMENT, $1 for groups), can be repeated")
+	rootCmd.PersistentFlags().StringVar(&cfg.SecretScan, "secret-scan", secretScanOff, "Look for credentials in every file before writing it and warn, redact them or quarantine the file (off, warn, redact or quarantine)")
+	rootCmd.PersistentFlags().StringArrayVar(&secretAllow, "secret-allow", []string{}, "Ignore possible secrets matching this regular expression, e.g. EXAMPLE, can be repeated")
+	rootCmd.PersistentFlags().StringVar(&cfg.QuarantineDir, "quarantine-dir", "", "Copy files quarantined by --secret-scan to this directory for review")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Translate, "translate", []string{}, "Also write translations of the markdown files into these languages to <output>/<lang>/ (e.g. de,fr)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Translator, "translator", translatorDeepL, "Translation service: deepl, google or the URL of a LibreTranslate compatible endpoint")
+	rootCmd.PersistentFlags().StringVar(&cfg.TranslatorKey, "translator-key", "", "API key of the translation service (or set DEEPL_AUTH_KEY), can reference a secret like vault:path#field")
+	rootCmd.PersistentFlags().StringVar(&cfg.SourceLang, "source-lang", "", "Language of the synced docs, detected by the translation service by default")
+	rootCmd.PersistentFlags().StringVar(&cfg.Progress, "progress", "progress.json", "Progress File used to resume interrupted runs")
+	rootCmd.PersistentFlags().BoolVar(&cfg.FullSync, "full", false, "List the whole tree instead of only the changes since the last sync")
+	rootCmd.PersistentFlags().StringVar(&cfg.Transport, "transport", "api", "Transport used to fetch repositories (api or git)")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Include, "include", []string{}, "Only sync paths matching these globs (e.g. docs/**)")
+	rootCmd.PersistentFlags().StringArrayVar(&cfg.WasmPlugins, "wasm-plugin", []string{}, "WASI module transforming each markdown file from stdin to stdout, can be repeated")
+	rootCmd.PersistentFlags().StringVar(&cfg.Filter, "filter", "", "Expression deciding whether a file is synced, e.g. size < 100000 && frontmatter.draft != true")
+	rootCmd.PersistentFlags().StringVar(&cfg.Place, "place", "", "Expression returning the path a file is written to below its repository's directory, e.g. dir + \"/\" + lower(name)")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxDepth, "max-depth", -1, "Only sync files at most this many directories deep, 0 for the root only")
+	rootCmd.PersistentFlags().BoolVar(&cfg.IncludeHidden, "include-hidden", true, "Sync files in directories starting with a dot, like .github/")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Extensions, "markdown-extensions", []string{".md", ".markdown", ".mdown"}, "Extensions of markdown files, matched in any case")
+	rootCmd.PersistentFlags().StringVar(&cfg.Encoding, "encoding", encodingUTF8, "Convert markdown with a BOM, in UTF-16 or Latin-1 to UTF-8 (utf-8) or leave it as it is (keep)")
+	rootCmd.PersistentFlags().StringVar(&cfg.EOL, "eol", "", "Convert the line endings of markdown files to lf, crlf or native, kept as they are by default")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Sniff, "sniff", false, "Also download files without an extension (README, INSTALL) whose content looks like markdown")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Assets, "include-assets", []string{}, "Also mirror non-markdown files matching these patterns (e.g. *.png,*.svg)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.ReadmeOnly, "readme-only", false, "Only download the README of each repository")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Releases, "releases", false, "Also save the notes of GitHub releases as releases/<tag>.md")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Issues, "issues", false, "Also save GitHub issues with their comments as issues/<number>.md")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IssueLabels, "issue-label", []string{}, "Only save issues with all of these labels (e.g. documentation)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Discussions, "discussions", false, "Also save GitHub Discussions as discussions/<number>.md (needs a token)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Governance, "governance", false, "Also mirror LICENSE, NOTICE, CODE_OF_CONDUCT and similar files")
+	rootCmd.PersistentFlags().StringVar(&since, "since", "", "Only download files changed since a date (2024-01-01) or duration (7d)")
+	rootCmd.PersistentFlags().StringSliceVar(&ignore, "ignore", []string{}, "Ignore files of a repository matching gitignore patterns (repo:pattern,pattern)")
+	rootCmd.PersistentFlags().StringSliceVar(&globalIgnore, "ignore-global", []string{}, "Ignore files of every repository matching these gitignore patterns (e.g. **/node_modules/)")
+	rootCmd.PersistentFlags().StringArrayVar(&ignoreFiles, "ignore-file", []string{}, "Ignore files matching the patterns of a gitignore style file, of one repository with repo=FILE")
+	rootCmd.PersistentFlags().StringVar(&cfg.UserAgent, "user-agent", "md-downloader/"+version, "User-Agent sent with every request")
+	rootCmd.PersistentFlags().StringVar(&cfg.APIVersion, "api-version", "2022-11-28", "GitHub REST API version (X-GitHub-Api-Version)")
+	rootCmd.PersistentFlags().StringArrayVar(&headers, "header", []string{}, "Extra HTTP header sent with every request (\"Name: value\"), can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&resolves, "resolve", []string{}, "Connect to this address for a host instead of looking it up (host:ip), can be repeated")
+	rootCmd.PersistentFlags().StringVar(&cfg.DNSServer, "dns-server", "", "DNS server to look up hosts with instead of the system resolver (ip[:port])")
+	rootCmd.PersistentFlags().StringVar(&cfg.Proxy, "proxy", "", "Send requests through this proxy (http://, https://, socks5:// or socks5h://host:port) instead of the one of HTTPS_PROXY")
+	rootCmd.PersistentFlags().StringVar(&cfg.CacheDir, "cache-dir", defaultCacheDir(), "HTTP Cache Directory")
+	rootCmd.PersistentFlags().BoolVar(&cfg.NoCache, "no-cache", false, "Disable the HTTP cache")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Offline, "offline", false, "Answer everything from the local cache and history without network access")
+	rootCmd.PersistentFlags().StringVar(&cfg.TagIndex, "tag-index", "", "Front matter field with tags to build tags/<tag>.md index pages from (e.g. tags)")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Languages, "languages", []string{}, "Only sync markdown files in these languages (e.g. en), from the lang front matter field or detected from the text")
+	rootCmd.PersistentFlags().BoolVar(&cfg.RouteLanguage, "route-language", false, "Write markdown files to <output>/<lang>/<repo>/ by their language")
+	rootCmd.PersistentFlags().StringVar(&cfg.DefaultLang, "default-lang", "", "Language of markdown files whose language can't be detected")
+	rootCmd.PersistentFlags().StringVar(&cfg.RouteBy, "route-by", "", "Front matter field whose value becomes the top output directory (e.g. category)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Sidecar, "sidecar", "", "Write a metadata file (yaml or json) next to each downloaded file")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Snippets, "snippets", false, "Extract fenced code blocks into files under snippets/")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.TOC, "toc", []string{}, "Inject a table of contents into the files of these repositories (* for all)")
+	rootCmd.PersistentFlags().StringArrayVar(&transforms, "transforms", []string{}, "Ordered transform steps (strip-frontmatter, rewrite-links, inject-toc, convert-html) of a repository (repo=step,step), can be repeated")
+	rootCmd.PersistentFlags().StringVar(&cfg.Link, "link", linkCopy, "How files with the same content are written (copy, hardlink or symlink)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Diff, "diff", false, "Print how many lines of each changed file were added and removed")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Verbose, "verbose", false, "Print the changed lines with --diff")
+	rootCmd.PersistentFlags().IntVar(&cfg.KeepVersions, "keep-versions", 0, "Keep this many previous versions of each overwritten file as file.~N~")
+	rootCmd.PersistentFlags().StringVar(&cfg.SitemapBaseURL, "sitemap-base-url", "", "Public URL of the output used in the sitemap.xml written for documents converted to HTML")
+	rootCmd.PersistentFlags().StringVar(&cfg.Theme, "theme", "", "Directory with HTML templates and assets overriding the default look of serve and convert-html")
+	rootCmd.PersistentFlags().StringVar(&cfg.HighlightStyle, "highlight-style", "github", "Chroma style used to highlight code blocks, none to disable")
+	rootCmd.PersistentFlags().StringVar(&cfg.PlantUMLServer, "plantuml-server", "", "PlantUML server rendering plantuml code blocks, e.g. https://www.plantuml.com/plantuml; they are shown as code without one")
+	rootCmd.PersistentFlags().StringVar(&mermaidScript, "mermaid-script", defaultMermaidScript, "URL of the mermaid.js module drawing mermaid code blocks, empty to show them as code")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Changes, "changes", false, "Describe the files each sync added, updated and moved in CHANGES.md")
+	rootCmd.PersistentFlags().BoolVar(&cfg.GitCommit, "git-commit", false, "Keep the output directory in a git repository with a commit per sync")
+	rootCmd.PersistentFlags().BoolVar(&cfg.NoBlobCache, "no-blob-cache", false, "Disable the content-addressed blob cache")
+
+	rootCmd.AddCommand(newRateLimitCmd())
+	rootCmd.AddCommand(newWebhookCmd())
+	rootCmd.AddCommand(newHistoryCmd())
+	rootCmd.AddCommand(newLoginCmd())
+	rootCmd.AddCommand(newLogoutCmd())
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newWatchCmd())
+	rootCmd.AddCommand(newDaemonCmd())
+	rootCmd.AddCommand(newK8sCmd())
+	rootCmd.AddCommand(newSearchCmd())
+	rootCmd.AddCommand(newLintCmd())
+	rootCmd.AddCommand(newSpellcheckCmd())
+	rootCmd.AddCommand(newDeadImagesCmd())
+	rootCmd.AddCommand(newChangelogCmd())
+	rootCmd.AddCommand(newCatalogCmd())
+	rootCmd.AddCommand(newRetryCmd())
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newDiscoverCmd())
+	rootCmd.AddCommand(newSnapshotCmd())
 
 	rootCmd.Execute()
 }
 
+func setup() bool {
+	if cfg.Transport != "api" && cfg.Transport != "git" {
+		log.Errorf("Invalid transport: %s\n", cfg.Transport)
+		return false
+	}
+	if cfg.Link != linkCopy && cfg.Link != linkHardlink && cfg.Link != linkSymlink {
+		log.Errorf("Invalid link mode: %s\n", cfg.Link)
+		return false
+	}
+	if cfg.Encoding != encodingUTF8 && cfg.Encoding != encodingKeep {
+		log.Errorf("Invalid encoding: %s\n", cfg.Encoding)
+		return false
+	}
+	if cfg.EOL != "" && cfg.EOL != eolLF && cfg.EOL != eolCRLF && cfg.EOL != eolNative {
+		log.Errorf("Invalid line ending: %s\n", cfg.EOL)
+		return false
+	}
+	if cfg.Sidecar != "" && cfg.Sidecar != "yaml" && cfg.Sidecar != "json" {
+		log.Errorf("Invalid sidecar format: %s\n", cfg.Sidecar)
+		return false
+	}
+	if cfg.Offline && cfg.NoCache {
+		log.Errorf("--offline needs the HTTP cache, it can't be used with --no-cache\n")
+		return false
+	}
+	parseIgnorePaths()
+	// The network settings come first, secret references in tokens are
+	// resolved with the shared client, which captures them when it's built.
+	for _, parse := range []func() error{parseIgnoreFiles, parseHeaders, parseHostLimits, parseResolves, parseProxy, parseProviders, parseTokens, parseTransforms, parseRedactions, parseValidations, parseSecretScan, parseTranslator, parseRendering, checkConfigMaps, compileFilters, loadWasmPlugins} {
+		if err := parse(); err != nil {
+			log.Errorf("%s\n", err)
+			return false
+		}
+	}
+	if since != "" {
+		t, err := parseSince(since)
+		if err != nil {
+			log.Errorf("%s\n", err)
+			return false
+		}
+		cfg.Since = t
+	}
+	if len(cfg.Gists) > 0 {
+		if err := expandGists(); err != nil {
+			log.Errorf("%s\n", err)
+			return false
+		}
+	}
+	return true
+}
+
 func parseIgnorePaths() {
-	cfg.Ignore = make(map[string][]string)
+	cfg.Ignore = make(map[string][]ignoreRule)
+	cfg.GlobalIgnore = nil
+	for _, pattern := range globalIgnore {
+		if rule, ok := parseIgnoreRule(pattern); ok {
+			cfg.GlobalIgnore = append(cfg.GlobalIgnore, rule)
+		}
+	}
 	for _, i := range ignore {
-		split := strings.SplitN(i, ":", 2)
-		if len(split) < 2 {
+		// Split on the last colon, repositories like file:///path contain one
+		split := strings.LastIndex(i, ":")
+		if split < 0 {
 			log.Errorf("Invalid ignore path: %s\n", i)
 			continue
 		}
-		repo := split[0]
-		paths := strings.Split(split[1], ",")
-		cfg.Ignore[repo] = paths
+		repo := i[:split]
+		for _, pattern := range strings.Split(i[split+1:], ",") {
+			if rule, ok := parseIgnoreRule(pattern); ok {
+				cfg.Ignore[repo] = append(cfg.Ignore[repo], rule)
+			}
+		}
 	}
 }
 
-func listMdFiles(repo string) {
-	apiURL := "https://api.github.com"
-	repo = strings.TrimPrefix(repo, "https://github.com/")
-	contentsURL := fmt.Sprintf("%s/repos/%s/git/trees/master?recursive=1", apiURL, repo)
+// parseIgnoreFiles adds the patterns of --ignore-file repo=FILE after the
+// --ignore ones, files without a repo apply to every repository.
+func parseIgnoreFiles() error {
+	for _, i := range ignoreFiles {
+		repo, file := "", i
+		if split := strings.SplitN(i, "=", 2); len(split) == 2 {
+			repo, file = split[0], split[1]
+		}
+		rules, err := readIgnoreFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read ignore file: %s", err)
+		}
+		if repo == "" {
+			cfg.GlobalIgnore = append(cfg.GlobalIgnore, rules...)
+		} else {
+			cfg.Ignore[repo] = append(cfg.Ignore[repo], rules...)
+		}
+	}
+	return nil
+}
+
+func parseHeaders() error {
+	cfg.Headers = make(http.Header)
+	for _, h := range headers {
+		split := strings.SplitN(h, ":", 2)
+		if len(split) < 2 || strings.TrimSpace(split[0]) == "" {
+			return fmt.Errorf("invalid header: %s", h)
+		}
+		cfg.Headers.Add(strings.TrimSpace(split[0]), strings.TrimSpace(split[1]))
+	}
+	return nil
+}
+
+type treeItem struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	// Type is "removed" for the files ListChanges reports as deleted.
+	Type string `json:"type"`
+	Sha  string `json:"sha"`
+	Size int    `json:"size"`
+	Url  string `json:"url"`
+	// PreviousPath is set for files the provider reported as renamed.
+	PreviousPath string `json:"previous_path,omitempty"`
+}
 
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", contentsURL, nil)
-	req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+// finishSync writes the files built from the whole output directory, once
+// every repository is synced.
+func finishSync() {
+	if cfg.TagIndex != "" {
+		writeTagIndex()
+	}
+	if cfg.Changes {
+		writeChanges()
+	}
+	writeSitemap()
+	writeManifest()
+	if cfg.GitCommit {
+		commitOutput()
+	}
+	if cfg.ConfigMaps != "" {
+		writeConfigMaps()
+	}
+}
 
-	resp, err := client.Do(req)
+func listMdFiles(repo string) {
+	defer endTraceRepo(traceRepo(repo))
+	client := httpClient()
+
+	provider, repo, err := newProvider(client, repo)
 	if err != nil {
-		log.Errorf("Failed to send request: %s\n", err)
+		recordError(err)
 		return
 	}
-	defer resp.Body.Close()
+	ref := repoRef(repo)
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Errorf("Failed to read response body: %s\n", err)
+	history := loadHistory()
+	if cfg.ReadmeOnly {
+		syncReadme(repo, ref, provider, history)
+		saveHistory(history)
 		return
 	}
-	bodyString := string(bodyBytes)
-	log.Debugf("Response body: %s\n", bodyString)
+	progress := loadProgress()
+
+	repoProgress, resuming := progress.Repos[repo]
+	if resuming {
+		log.Infof("Resuming interrupted sync of %s (%d of %d files done)\n", repo, len(repoProgress.Completed), len(repoProgress.Queued))
+		for path, entry := range repoProgress.Completed {
+			if entry.Status != "" {
+				history.Files[path] = entry
+			}
+		}
+	} else {
+		// One cheap call for the branch head skips repositories without
+		// new commits entirely.
+		if lastCommit, ok := history.Commits[repo]; ok && !cfg.FullSync && cfg.Since.IsZero() {
+			if head, err := provider.ResolveRef(ref); err == nil && head == lastCommit {
+				log.Infof("Skipping %s (no new commits since %s)\n", repo, lastCommit)
+				syncExtras(client, repo, history)
+				saveHistory(history)
+				return
+			}
+		}
+
+		repoProgress = &RepoProgress{
+			Completed: make(map[string]HistoryEntry),
+		}
+
+		var changes []treeItem
+		delta := false
+		if lister, ok := provider.(changeLister); ok && !cfg.FullSync {
+			if lastCommit, ok := history.Commits[repo]; ok {
+				changes, repoProgress.Commit, delta = lister.ListChanges(lastCommit, ref)
+			}
+		}
+
+		if delta {
+			log.Infof("Syncing %d changed files of %s since %s\n", len(changes), repo, history.Commits[repo])
+			repoProgress.Queued = filterDocFiles(changes)
+			repoProgress.Renames = detectRenames(repo, repoProgress.Queued, nil, history)
+			for _, item := range changes {
+				if item.Type == "removed" {
+					repoProgress.Removed = append(repoProgress.Removed, item.Path)
+				}
+			}
+		} else {
+			commit, err := provider.ResolveRef(ref)
+			if err != nil {
+				recordError(err)
+				return
+			}
+			tree, err := provider.ListFiles(commit, includePrefix())
+			if err != nil {
+				recordError(err)
+				return
+			}
+			repoProgress.Commit = commit
+			repoProgress.Queued = filterDocFiles(tree)
+
+			current := make(map[string]bool)
+			for _, item := range tree {
+				current[item.Path] = true
+			}
+			repoProgress.Renames = detectRenames(repo, repoProgress.Queued, current, history)
+			repoProgress.Removed = vanishedFiles(repo, current, history)
+		}
+
+		if !cfg.Since.IsZero() {
+			lister, ok := provider.(changedSinceLister)
+			if !ok {
+				log.Errorf("--since is not supported for %s\n", repo)
+				return
+			}
+			changed, err := lister.ChangedSince(repoProgress.Commit, cfg.Since)
+			if err != nil {
+				recordError(err)
+				return
+			}
+			repoProgress.Queued = filterSince(repoProgress.Queued, changed)
+		}
+		progress.Repos[repo] = repoProgress
+		saveProgress(progress)
+	}
+
+	if p, ok := provider.(prefetcher); ok {
+		var pending []treeItem
+		for _, item := range repoProgress.Queued {
+			if _, done := repoProgress.Completed[item.Path]; !done && shouldDownload(item.Path, item.Sha, history) && !isIgnored(repo, item.Path) {
+				pending = append(pending, item)
+			}
+		}
+		p.Prefetch(repoProgress.Commit, pending)
+	}
 
-	var contents struct {
-		Tree []struct {
-			Path string `json:"path"`
-			Mode string `json:"mode"`
-			Type string `json:"type"`
-			Sha  string `json:"sha"`
-			Size int    `json:"size"`
-			Url  string `json:"url"`
-		} `json:"tree"`
+	for _, item := range repoProgress.Queued {
+		if _, done := repoProgress.Completed[item.Path]; done {
+			continue
+		}
+		// The progress is kept, the next sync resumes from this file.
+		if stopping() {
+			log.Infof("Stopping the sync of %s\n", repo)
+			saveHistory(history)
+			return
+		}
+
+		fileSpan := traceFile(item)
+		syncFile(repo, repoProgress.Commit, item, history, provider, repoProgress.Renames)
+		endTraceFile(fileSpan)
+
+		repoProgress.Completed[item.Path] = history.Files[item.Path]
+		saveProgress(progress)
 	}
 
-	if err := json.Unmarshal(bodyBytes, &contents); err != nil {
-		log.Errorf("Failed to decode response JSON: %s\n", err)
+	// Renamed files left the history in syncFile, what is left was removed.
+	for _, path := range repoProgress.Removed {
+		if entry, ok := history.Files[path]; ok && entry.Status == statusOK && isDocFile(path) {
+			log.Infof("File removed upstream: %s\n", path)
+			entry.Status = statusRemoved
+			history.Files[path] = entry
+			audit(auditRemove, repo, path, entry.Sha, "removed upstream, kept in the output")
+		}
+	}
+
+	syncExtras(client, repo, history)
+
+	// A --since run skips older files, so it must not move the delta sync base.
+	if repoProgress.Commit != "" && cfg.Since.IsZero() {
+		history.Commits[repo] = repoProgress.Commit
+	}
+	saveHistory(history)
+
+	delete(progress.Repos, repo)
+	saveProgress(progress)
+}
+
+// syncExtras saves the releases, issues and discussions, they change
+// without new commits.
+func syncExtras(client *http.Client, repo string, history History) {
+	if cfg.Releases {
+		syncReleases(client, repo, history)
+	}
+	if cfg.Issues {
+		syncIssues(client, repo, history)
+	}
+	if cfg.Discussions {
+		syncDiscussions(client, repo, history)
+	}
+}
+
+func filterDocFiles(items []treeItem) []treeItem {
+	var docFiles []treeItem
+	for _, item := range items {
+		if item.Type == "blob" && isDocFile(item.Path) {
+			docFiles = append(docFiles, item)
+		}
+	}
+	return docFiles
+}
+
+func isDocFile(filePath string) bool {
+	return (isMarkdown(filePath) || isAsset(filePath) || isGovernanceFile(filePath) || isSniffCandidate(filePath)) && isTraversed(filePath) && isIncluded(filePath)
+}
+
+func syncFile(repo, commit string, item treeItem, history History, provider Provider, renames map[string]string) {
+	if !shouldDownload(item.Path, item.Sha, history) {
+		log.Infof("Skipping file: %s (already up to date)\n", item.Path)
+		audit(auditSkip, repo, item.Path, item.Sha, "up to date")
+		return
+	}
+	if isIgnored(repo, item.Path) {
+		log.Infof("Ignoring file: %s\n", item.Path)
+		audit(auditSkip, repo, item.Path, item.Sha, "ignored")
+		return
+	}
+	if !filterNeedsContent && !filterFile(repo, item, nil) {
+		log.Infof("Skipping file: %s (filtered)\n", item.Path)
+		audit(auditSkip, repo, item.Path, item.Sha, "filtered")
 		return
 	}
 
-	history := loadHistory()
+	action, reason := auditCreate, "new file"
+	if previous, ok := history.Files[item.Path]; ok {
+		action, reason = auditUpdate, "changed from "+previous.Sha
+		if previous.Status == statusError {
+			reason = "previous download failed"
+		}
+	}
 
-	for _, item := range contents.Tree {
-		if item.Type == "blob" && filepath.Ext(item.Path) == ".md" {
-			if shouldDownload(item.Path, item.Sha, history) {
-				if isIgnored(repo, item.Path) {
-					log.Infof("Ignoring file: %s\n", item.Path)
-				} else {
-					log.Infof("Downloading file: %s\n", item.Path)
-					// Get the file content through GitHub API
-					req, _ = http.NewRequest("GET", item.Url, nil)
-					req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
-					resp, err := client.Do(req)
-					if err != nil {
-						log.Errorf("Failed to send request: %s\n", err)
-						history.Files[item.Path] = "ERROR"
-						saveHistory(history)
-						continue
-					}
-					defer resp.Body.Close()
-
-					var fileContentResponse struct {
-						Content string `json:"content"`
-					}
-					if err := json.NewDecoder(resp.Body).Decode(&fileContentResponse); err != nil {
-						log.Errorf("Failed to decode response JSON: %s\n", err)
-						history.Files[item.Path] = "ERROR"
-						saveHistory(history)
-						continue
-					}
-					decodedContent, err := base64.StdEncoding.DecodeString(fileContentResponse.Content)
-					if err != nil {
-						log.Errorf("Failed to decode base64 content: %s\n", err)
-						history.Files[item.Path] = "ERROR"
-						saveHistory(history)
-						continue
-					}
-
-					if err := saveFile(repo, item.Path, string(decodedContent)); err != nil {
-						history.Files[item.Path] = item.Sha
-						saveHistory(history)
-						continue
-					}
-					history.Files[item.Path] = item.Sha
-				}
-			} else {
-				log.Infof("Skipping file: %s (already up to date)\n", item.Path)
+	// Streamed files are only read into memory when they must be converted
+	// to UTF-8.
+	var content []byte
+	if streamable(repo, item, provider, renames[item.Path] != "") {
+		var done bool
+		if content, done = syncStreamed(repo, commit, item, history, provider, action, reason); done {
+			return
+		}
+	} else if cached, ok := readCachedBlob(item.Sha); ok {
+		log.Infof("Copying file from blob cache: %s\n", item.Path)
+		content = cached
+	} else {
+		log.Infof("Downloading file: %s\n", item.Path)
+		var err error
+		content, err = provider.FetchFile(item)
+		if err != nil {
+			recordError(err)
+			audit(auditError, repo, item.Path, item.Sha, err.Error())
+			history.Files[item.Path] = HistoryEntry{Sha: item.Sha, Status: statusError, DownloadedAt: time.Now()}
+			saveHistory(history)
+			return
+		}
+		cacheBlob(item.Sha, content)
+	}
+	// Filtered files aren't recorded, they are decided on again from the
+	// blob cache when the filter changes.
+	if filterNeedsContent && !filterFile(repo, item, content) {
+		log.Infof("Skipping file: %s (filtered)\n", item.Path)
+		audit(auditSkip, repo, item.Path, item.Sha, "filtered")
+		return
+	}
+	if ok, lang := languageAllowed(item.Path, content); !ok {
+		log.Infof("Skipping file: %s (language %s)\n", item.Path, lang)
+		audit(auditSkip, repo, item.Path, item.Sha, "language "+lang)
+		history.Files[item.Path] = HistoryEntry{Sha: item.Sha, Size: len(content), Status: statusSkipped, DownloadedAt: time.Now(), Language: lang}
+		return
+	}
+	if isSniffCandidate(item.Path) && !looksLikeMarkdown(sniffContent(content)) {
+		log.Infof("Skipping file: %s (not markdown)\n", item.Path)
+		audit(auditSkip, repo, item.Path, item.Sha, "not markdown")
+		history.Files[item.Path] = HistoryEntry{Sha: item.Sha, Size: len(content), Status: statusSkipped, DownloadedAt: time.Now()}
+		return
+	}
+
+	entry := HistoryEntry{Sha: item.Sha, Size: len(content), Status: statusOK, DownloadedAt: time.Now()}
+	output, err := checkFile(repo, item.Path, transformContent(repo, item.Path, content))
+	if err != nil {
+		rejectFile(repo, item.Path, item.Sha, len(content), history, err)
+		// The blob of a quarantined file isn't kept either.
+		if isSecretRejection(err) {
+			os.Remove(blobCachePath(item.Sha))
+		}
+		return
+	}
+	// Transformed files no longer match the blob, they can't be linked.
+	canLink := cfg.Link != linkCopy && bytes.Equal(output, content)
+	dest := outputPath(repo, item.Path, content)
+	if oldPath, ok := renames[item.Path]; ok {
+		// The old file was written from the same blob, it is in the layout
+		// of the same content.
+		from := outputPath(repo, oldPath, content)
+		if _, err := os.Stat(from); err != nil {
+			from = localPath(repo, oldPath)
+		}
+		if err := moveFile(from, dest); err == nil {
+			log.Infof("Moved file: %s -> %s\n", oldPath, item.Path)
+			audit(auditMove, repo, item.Path, item.Sha, "renamed from "+oldPath)
+			audit(auditDelete, repo, oldPath, item.Sha, "renamed to "+item.Path)
+			removeSidecar(from)
+			writeSidecar(repo, commit, item, dest)
+			moved := history.Files[oldPath]
+			moved.Sha = item.Sha
+			history.Files[item.Path] = moved
+			delete(history.Files, oldPath)
+			// Steps depending on the path, like rewritten links, change
+			// the content, it is written again below.
+			if current, err := ioutil.ReadFile(dest); err == nil && bytes.Equal(current, output) {
+				return
 			}
+			action, reason = auditUpdate, "renamed from "+oldPath
 		}
 	}
+	// A failed translation is retried by the next sync.
+	if err := translateFile(item.Path, dest, output); err != nil {
+		log.Errorf("Failed to translate %s: %s\n", item.Path, err)
+		recordError(err)
+		audit(auditError, repo, item.Path, item.Sha, err.Error())
+		entry.Status = statusError
+	}
+	if cfg.Diff && action == auditUpdate {
+		printDiff(item.Path, dest, output)
+	}
+	if canLink && linkFile(dest, item.Sha, output) == nil {
+		audit(action, repo, item.Path, item.Sha, reason+", linked")
+		writeSidecar(repo, commit, item, dest)
+		history.Files[item.Path] = entry
+		return
+	}
+	if err := saveFile(dest, output); err != nil {
+		recordError(err)
+		audit(auditError, repo, item.Path, item.Sha, err.Error())
+		history.Files[item.Path] = entry
+		saveHistory(history)
+		return
+	}
+	if canLink {
+		rememberLinkTarget(dest, item.Sha)
+	}
+	audit(action, repo, item.Path, item.Sha, reason)
+	writeSidecar(repo, commit, item, dest)
+	history.Files[item.Path] = entry
+}
 
-	saveHistory(history)
+func newAPIRequest(url string) *http.Request {
+	req, _ := http.NewRequest("GET", url, nil)
+	host := req.URL.Host
+	provider := providerForHost(host)
+
+	if token := tokenFor(host); token != "" {
+		if provider == providerGitea {
+			req.Header.Set("Authorization", "token "+token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	if provider == providerGitHub {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", cfg.APIVersion)
+	}
+	for name, values := range cfg.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return req
 }
 
-func saveFile(repo, filePath, content string) error {
-	fileDir := filepath.Join(cfg.Output, filepath.Base(repo)) // Use only the repository name, skip the username
-	filePath = filepath.Join(fileDir, filePath)
+func localPath(repo, filePath string) string {
+	fileDir := filepath.Join(cfg.Output, repoName(repo)) // Use only the repository name, skip the username
+	return filepath.Join(fileDir, filePath)
+}
 
+// saveFile writes an output file, filePath comes from outputPath.
+func saveFile(filePath string, content []byte) error {
 	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
 	if err != nil {
 		log.Errorf("Failed to create directory: %s\n", filePath)
 		return err
 	}
 
+	// Remove the old file first, it may be a link shared with other paths
+	// that must not be overwritten.
+	keepVersion(filePath, content)
+	os.Remove(filePath)
+
 	out, err := os.Create(filePath)
 	if err != nil {
 		log.Errorf("Failed to create file: %s\n", filePath)
@@ -182,7 +753,7 @@ func saveFile(repo, filePath, content string) error {
 	}
 	defer out.Close()
 
-	_, err = out.WriteString(content)
+	_, err = out.Write(content)
 	if err != nil {
 		log.Errorf("Failed to save file: %s\n", filePath)
 		return err
@@ -192,57 +763,57 @@ func saveFile(repo, filePath, content string) error {
 	return nil
 }
 
-func shouldDownload(filePath, sha string, history History) bool {
-	if lastSha, ok := history.Files[filePath]; !ok || lastSha == "ERROR" {
-		return true
+// saveGenerated writes a file md-downloader generated from API responses,
+// like an issue or a release, through the same redaction and checks as the
+// files of repositories.
+func saveGenerated(repo, filePath string, content []byte, history History) {
+	sha := gitBlobSha(content)
+	output, err := checkFile(repo, filePath, redactContent(content))
+	if err != nil {
+		rejectFile(repo, filePath, sha, len(content), history, err)
+		return
 	}
-
-	return history.Files[filePath] != sha
-}
-
-func isIgnored(repo, filePath string) bool {
-	if ignorePaths, ok := cfg.Ignore[repo]; ok {
-		for _, path := range ignorePaths {
-			if path == filePath {
-				return true
-			}
-		}
+	entry := HistoryEntry{Sha: sha, Size: len(content), Status: statusOK, DownloadedAt: time.Now()}
+	_, exists := history.Files[filePath]
+	if err := saveFile(outputPath(repo, filePath, content), output); err != nil {
+		entry.Status = statusError
+		audit(auditError, repo, filePath, entry.Sha, err.Error())
+	} else if exists {
+		audit(auditUpdate, repo, filePath, entry.Sha, "changed upstream")
+	} else {
+		audit(auditCreate, repo, filePath, entry.Sha, "new file")
 	}
-	return false
+	history.Files[filePath] = entry
 }
 
-func loadHistory() History {
-	history := History{
-		Files: make(map[string]string),
+func repoName(repo string) string {
+	if isLocalRepo(repo) {
+		path, _ := parseLocalRepo(repo)
+		return filepath.Base(path)
 	}
-
-	file, err := os.Open(cfg.History)
-	if err != nil {
-		log.Warnf("Failed to open history file: %s\n", err)
-		return history
+	if isGist(repo) {
+		return "gist-" + strings.TrimPrefix(repo, gistPrefix)
 	}
-	defer file.Close()
+	return filepath.Base(repo)
+}
 
-	err = json.NewDecoder(file).Decode(&history)
-	if err != nil {
-		log.Warnf("Failed to parse history file: %s\n", cfg.History)
+func shouldDownload(filePath, sha string, history History) bool {
+	entry, ok := history.Files[filePath]
+	if !ok || entry.Status == statusError || entry.Status == statusRemoved {
+		return true
+	}
+	// Files skipped for their language are synced once --languages allows
+	// it.
+	if entry.Language != "" && (len(cfg.Languages) == 0 || languageMatches(entry.Language, cfg.Languages)) {
+		return true
 	}
 
-	return history
+	return entry.Sha != sha
 }
 
-func saveHistory(history History) {
-	file, err := os.Create(cfg.History)
-	if err != nil {
-		log.Errorf("Failed to create history file: %s\n", cfg.History)
-		return
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "    ")
-	err = encoder.Encode(history)
-	if err != nil {
-		log.Errorf("Failed to save history file: %s\n", cfg.History)
-	}
+// isIgnored applies the global rules first, a repository's own rules can
+// re-include what they ignore.
+func isIgnored(repo, filePath string) bool {
+	rules := append(append([]ignoreRule{}, cfg.GlobalIgnore...), cfg.Ignore[repo]...)
+	return ignoredBy(rules, filePath)
 }
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	log = logrus.New()
+	log.SetLevel(logrus.WarnLevel)
+	os.Exit(m.Run())
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// offlineResponse answers a request in --offline mode from the HTTP cache,
+// whether or not the cached entry is still fresh.
+func (t *cacheTransport) offlineResponse(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet {
+		if entry, body, ok := t.load(cacheKey(req)); ok {
+			log.Debugf("Serving from cache (offline): %s\n", req.URL)
+			return entry.response(req, body)
+		}
+	}
+	return nil, fmt.Errorf("%s %s is not cached and --offline is set", req.Method, req.URL)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	stepStripFrontMatter = "strip-frontmatter"
+	stepRewriteLinks     = "rewrite-links"
+	stepInjectTOC        = "inject-toc"
+	stepConvertHTML      = "convert-html"
+)
+
+var transformSteps = map[string]func(repo, filePath string, content []byte) []byte{
+	stepStripFrontMatter: func(repo, filePath string, content []byte) []byte {
+		return content[frontMatterEnd(content):]
+	},
+	stepRewriteLinks: rewriteLinks,
+	stepInjectTOC: func(repo, filePath string, content []byte) []byte {
+		return injectTOC(content)
+	},
+	stepConvertHTML: convertHTML,
+}
+
+var inlineLink = regexp.MustCompile(`\]\(\s*<?([^)\s>]+)>?`)
+
+// parseTransforms reads the --transforms pipelines: repo=step,step sets the
+// steps of one repository, steps without a repository apply to all others.
+func parseTransforms() error {
+	cfg.Transforms = make(map[string][]string)
+	for _, t := range transforms {
+		repo, steps := "*", t
+		if split := strings.SplitN(t, "=", 2); len(split) == 2 {
+			repo, steps = split[0], split[1]
+		}
+		for _, step := range strings.Split(steps, ",") {
+			step = strings.TrimSpace(step)
+			if step == "" {
+				continue
+			}
+			if _, ok := transformSteps[step]; !ok {
+				return fmt.Errorf("unknown transform step: %s", step)
+			}
+			cfg.Transforms[repo] = append(cfg.Transforms[repo], step)
+		}
+	}
+	return nil
+}
+
+// pipeline returns the transform steps of a repository. Without
+// --transforms the files of the --toc repositories get a table of contents.
+func pipeline(repo string) []string {
+	if steps, ok := cfg.Transforms[repo]; ok {
+		return steps
+	}
+	if steps, ok := cfg.Transforms["*"]; ok {
+		return steps
+	}
+	if tocEnabled(repo) {
+		return []string{stepInjectTOC}
+	}
+	return nil
+}
+
+func hasStep(repo, step string) bool {
+	for _, s := range pipeline(repo) {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+func runPipeline(repo, filePath string, content []byte) []byte {
+	for _, step := range pipeline(repo) {
+		content = transformSteps[step](repo, filePath, content)
+	}
+	return content
+}
+
+// rewriteLinks points relative links to files that aren't mirrored at the
+// upstream repository, and links to documents at their .html page when the
+// pipeline converts them.
+func rewriteLinks(repo, filePath string, content []byte) []byte {
+	links := make(map[string]string)
+	dir := path.Dir(filePath)
+	doc := markdown.Parser().Parse(text.NewReader(content))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*ast.Link); ok && entering {
+			destination := string(link.Destination)
+			if rewritten := rewriteLink(repo, dir, destination); rewritten != destination {
+				links[destination] = rewritten
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(links) == 0 {
+		return content
+	}
+
+	return inlineLink.ReplaceAllFunc(content, func(match []byte) []byte {
+		destination := string(inlineLink.FindSubmatch(match)[1])
+		if rewritten, ok := links[destination]; ok {
+			return bytes.Replace(match, []byte(destination), []byte(rewritten), 1)
+		}
+		return match
+	})
+}
+
+func rewriteLink(repo, dir, destination string) string {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return destination
+	}
+	target, _ := repoImagePath(dir, u.Path)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return destination
+	}
+	if !isDocFile(target) || isIgnored(repo, target) {
+		if source := sourceURL(repo, "", target); source != "" {
+			if u.Fragment != "" {
+				source += "#" + u.Fragment
+			}
+			return source
+		}
+		return destination
+	}
+	if isMarkdown(target) && hasStep(repo, stepConvertHTML) {
+		u.Path = htmlPath(u.Path)
+		return u.String()
+	}
+	return destination
+}
+
+// convertHTML renders a document to a standalone HTML page, it is saved
+// with an .html extension instead of the markdown one.
+func convertHTML(repo, filePath string, content []byte) []byte {
+	body, err := renderMarkdown(content)
+	if err != nil {
+		log.Warnf("Failed to convert %s to HTML: %s\n", filePath, err)
+		return content
+	}
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "static", page{Title: path.Base(filePath), Body: body}); err != nil {
+		log.Warnf("Failed to convert %s to HTML: %s\n", filePath, err)
+		return content
+	}
+	return buf.Bytes()
+}
+
+func htmlPath(filePath string) string {
+	return strings.TrimSuffix(filePath, path.Ext(filePath)) + ".html"
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputPathConvertHTML(t *testing.T) {
+	testConfig(t)
+	cfg.RouteBy = "category"
+	cfg.Transforms = map[string][]string{"*": {stepStripFrontMatter, stepConvertHTML}}
+	content := []byte("---\ncategory: guides\n---\n# Guide\n")
+
+	// The route comes from the downloaded file, not the converted page
+	// without front matter.
+	want := filepath.Join(cfg.Output, "guides", "docs", "intro.html")
+	if got := outputPath(testRepo, "intro.md", content); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := outputPath(testRepo, "logo.png", nil), filepath.Join(cfg.Output, "docs", "logo.png"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestConvertHTMLSettings(t *testing.T) {
+	testConfig(t)
+	defer func() {
+		markdown = newMarkdown("github", "")
+		templates = newTemplates()
+	}()
+	cfg.Theme = t.TempDir()
+	cfg.HighlightStyle = "none"
+	cfg.PlantUMLServer = "https://plantuml.example/"
+	theme := `{{define "footer"}}<footer>Brand</footer>{{end}}`
+	if err := ioutil.WriteFile(filepath.Join(cfg.Theme, "footer.html"), []byte(theme), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseRendering(); err != nil {
+		t.Fatal(err)
+	}
+
+	source := []byte("# Diagrams\n\n```plantuml\nA -> B\n```\n\n```mermaid\ngraph TD; A-->B\n```\n")
+	page := string(convertHTML(testRepo, "diagrams.md", source))
+	for _, want := range []string{"<footer>Brand</footer>", `<img class="plantuml"`, `<pre class="mermaid">`, "import(" + `"` + defaultMermaidScript + `"` + ")"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("missing %q in %s", want, page)
+		}
+	}
+	if strings.Contains(page, "/_reload") {
+		t.Errorf("static page reloads from the server: %s", page)
+	}
+}
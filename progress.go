@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+// Progress tracks the files queued and completed by runs that have not
+// finished yet, so an interrupted sync can pick up where it stopped.
+type Progress struct {
+	Repos map[string]*RepoProgress `json:"repos"`
+}
+
+type RepoProgress struct {
+	Commit    string                  `json:"commit,omitempty"`
+	Queued    []treeItem              `json:"queued"`
+	Completed map[string]HistoryEntry `json:"completed"`
+	Renames   map[string]string       `json:"renames,omitempty"`
+	Removed   []string                `json:"removed,omitempty"`
+}
+
+func loadProgress() Progress {
+	progress := Progress{
+		Repos: make(map[string]*RepoProgress),
+	}
+
+	data, err := readStateFile(cfg.Progress)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed to open progress file: %s\n", err)
+		}
+		return progress
+	}
+
+	err = json.Unmarshal(data, &progress)
+	if err != nil {
+		log.Warnf("Failed to parse progress file: %s\n", cfg.Progress)
+		progress.Repos = make(map[string]*RepoProgress)
+	}
+	if progress.Repos == nil {
+		progress.Repos = make(map[string]*RepoProgress)
+	}
+
+	return progress
+}
+
+func saveProgress(progress Progress) {
+	if len(progress.Repos) == 0 {
+		if err := os.Remove(cfg.Progress); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Failed to remove progress file: %s\n", cfg.Progress)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "    ")
+	err := encoder.Encode(progress)
+	if err == nil {
+		err = writeStateFile(cfg.Progress, buf.Bytes())
+	}
+	if err != nil {
+		log.Errorf("Failed to save progress file: %s\n", cfg.Progress)
+	}
+}
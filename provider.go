@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider is a source of repository files. The sync engine only talks to
+// providers, so new backends don't have to touch it.
+type Provider interface {
+	// ResolveRef returns the commit a branch, tag or revision points to.
+	ResolveRef(ref string) (string, error)
+	// ListFiles lists the files of a commit, limited to dir when it is set.
+	ListFiles(commit, dir string) ([]treeItem, error)
+	FetchFile(item treeItem) ([]byte, error)
+}
+
+// changeLister is implemented by providers that can list the files changed
+// between two commits without listing the whole tree. It reports false when
+// it can't and the tree has to be listed instead.
+type changeLister interface {
+	ListChanges(base, ref string) ([]treeItem, string, bool)
+}
+
+type changedSinceLister interface {
+	ChangedSince(commit string, since time.Time) (map[string]bool, error)
+}
+
+// streamFetcher is implemented by providers that can write a file as it is
+// downloaded, so it doesn't have to be held in memory.
+type streamFetcher interface {
+	FetchFileTo(item treeItem, w io.Writer) error
+}
+
+// prefetcher is implemented by providers that can download a batch of files
+// more efficiently than one at a time.
+type prefetcher interface {
+	Prefetch(commit string, items []treeItem)
+}
+
+// newProvider picks the provider for a repository and returns it together
+// with the normalized repository name used for history and output.
+func newProvider(client *http.Client, repo string) (Provider, string, error) {
+	if isLocalRepo(repo) {
+		r, err := openLocalRepo(repo)
+		if err != nil {
+			return nil, "", err
+		}
+		return &localProvider{r: r}, repo, nil
+	}
+	if isGist(repo) {
+		return &gistProvider{client: client, id: strings.TrimPrefix(repo, gistPrefix)}, repo, nil
+	}
+
+	remote, err := parseRemoteRepo(repo)
+	if err != nil {
+		log.Errorf("Invalid repository %s: %s\n", repo, err)
+		return nil, "", err
+	}
+	if remote.Provider != providerGitHub && cfg.Transport == "git" {
+		log.Warnf("The git transport only supports GitHub, using the API for %s\n", repo)
+	}
+
+	switch remote.Provider {
+	case providerGitLab:
+		return &gitlabProvider{client: client, remote: remote}, repo, nil
+	case providerGitea:
+		return &giteaProvider{client: client, remote: remote}, repo, nil
+	}
+
+	if remote.Host != "github.com" {
+		err := errUnsupportedHost(remote.Host)
+		log.Errorf("%s\n", err)
+		return nil, "", err
+	}
+	if cfg.Transport == "git" {
+		dir, branch, err := ensureClone(remote.Path, repoRef(remote.Path))
+		if err != nil {
+			return nil, "", err
+		}
+		return &gitCloneProvider{dir: dir, branch: branch}, remote.Path, nil
+	}
+	return &githubProvider{client: client, repo: remote.Path}, remote.Path, nil
+}
+
+// repoRef returns the ref to sync, the revision after @ for local clones and
+// master for everything else.
+func repoRef(repo string) string {
+	if isLocalRepo(repo) {
+		if _, revision := parseLocalRepo(repo); revision != "" {
+			return revision
+		}
+		return "HEAD"
+	}
+	return "master"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	providerGitHub = "github"
+	providerGitLab = "gitlab"
+	providerGitea  = "gitea"
+)
+
+type remoteRepo struct {
+	Provider string
+	Host     string
+	Path     string
+}
+
+// parseRemoteRepo splits a repository URL into its host and path and infers
+// the provider from the host. Plain owner/repo identifiers are GitHub repos.
+func parseRemoteRepo(repo string) (remoteRepo, error) {
+	if !strings.Contains(repo, "://") {
+		return remoteRepo{Provider: providerGitHub, Host: "github.com", Path: repo}, nil
+	}
+
+	u, err := url.Parse(repo)
+	if err != nil {
+		return remoteRepo{}, err
+	}
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if path == "" {
+		return remoteRepo{}, fmt.Errorf("missing repository path in %s", repo)
+	}
+
+	provider := providerForHost(u.Host)
+	if provider == "" {
+		return remoteRepo{}, fmt.Errorf("unknown provider for %s, set it with --provider %s=github|gitlab|gitea", u.Host, u.Host)
+	}
+
+	return remoteRepo{Provider: provider, Host: u.Host, Path: path}, nil
+}
+
+func errUnsupportedHost(host string) error {
+	return fmt.Errorf("GitHub Enterprise hosts are not supported: %s", host)
+}
+
+func providerForHost(host string) string {
+	if provider, ok := cfg.Providers[host]; ok {
+		return provider
+	}
+	switch {
+	case host == "github.com" || host == "api.github.com":
+		return providerGitHub
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		return providerGitLab
+	case host == "gitea.com" || host == "codeberg.org" || strings.HasPrefix(host, "gitea."):
+		return providerGitea
+	}
+	return ""
+}
+
+func parseProviders() error {
+	cfg.Providers = make(map[string]string)
+	for _, p := range providers {
+		split := strings.SplitN(p, "=", 2)
+		if len(split) < 2 {
+			return fmt.Errorf("invalid provider: %s", p)
+		}
+		switch split[1] {
+		case providerGitHub, providerGitLab, providerGitea:
+			cfg.Providers[split[0]] = split[1]
+		default:
+			return fmt.Errorf("invalid provider: %s", p)
+		}
+	}
+	return nil
+}
+
+func parseTokens() error {
+	cfg.Tokens = make(map[string]string)
+	for _, t := range tokens {
+		split := strings.SplitN(t, "=", 2)
+		if len(split) < 2 {
+			return fmt.Errorf("invalid token, expected host=TOKEN")
+		}
+		token, err := resolveSecret(split[1])
+		if err != nil {
+			return fmt.Errorf("failed to read token of %s: %s", split[0], err)
+		}
+		cfg.Tokens[split[0]] = token
+	}
+	token, err := resolveSecret(cfg.AccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to read access token: %s", err)
+	}
+	cfg.AccessToken = token
+	return nil
+}
+
+// tokenFor returns the token for a host. The --access-token is only ever
+// sent to GitHub, other hosts need their own --token. Hosts without a token
+// fall back to the credential helper.
+func tokenFor(host string) string {
+	if host == "api.github.com" || host == rawHost {
+		host = "github.com"
+	}
+	if token, ok := cfg.Tokens[host]; ok {
+		return token
+	}
+	if host == "github.com" && cfg.AccessToken != "" {
+		return cfg.AccessToken
+	}
+	return storedToken(host)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var proxyURL *url.URL
+
+// parseProxy checks the --proxy URL. Without one, the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables are used.
+func parseProxy() error {
+	proxyURL = nil
+	if cfg.Proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.Proxy)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy: %s", cfg.Proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	case "socks5h":
+		// Go's SOCKS5 client always lets the proxy resolve hostnames, which
+		// is what socks5h means to curl and git.
+		u.Scheme = "socks5"
+	default:
+		return fmt.Errorf("unsupported proxy scheme %s, expected http, https, socks5 or socks5h", u.Scheme)
+	}
+	proxyURL = u
+	return nil
+}
+
+func proxyFunc() func(*http.Request) (*url.URL, error) {
+	if proxyURL != nil {
+		return http.ProxyURL(proxyURL)
+	}
+	return http.ProxyFromEnvironment
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// blobSizeLimit is the largest blob the GitHub API returns, bigger files
+	// are downloaded from raw.githubusercontent.com in ranges.
+	blobSizeLimit  = 100 << 20
+	rangeChunkSize = 8 << 20
+	rangeAttempts  = 3
+)
+
+const (
+	rawHost = "raw.githubusercontent.com"
+	rawURL  = "https://" + rawHost
+)
+
+func rawFileURL(repo, commit, filePath string) string {
+	segments := strings.Split(filePath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", rawURL, repo, commit, strings.Join(segments, "/"))
+}
+
+// fetchRanged downloads a file to w in chunks of rangeChunkSize, a chunk
+// that fails is tried again without starting over.
+func fetchRanged(client *http.Client, fileURL string, item treeItem, w io.Writer) error {
+	var written int64
+	for {
+		var err error
+		var done bool
+		for attempt := 1; attempt <= rangeAttempts; attempt++ {
+			var n int64
+			n, done, err = fetchRange(client, fileURL, w, written)
+			written += n
+			if err == nil {
+				break
+			}
+			log.Warnf("Failed to download %s at %d bytes (attempt %d of %d): %s\n", item.Path, written, attempt, rangeAttempts, err)
+		}
+		if err != nil {
+			log.Errorf("Failed to download %s: %s\n", item.Path, err)
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// fetchRange writes the chunk of a file starting at offset to w and returns
+// how many bytes it wrote, done is true when the end of the file was reached.
+func fetchRange(client *http.Client, fileURL string, w io.Writer, offset int64) (int64, bool, error) {
+	// newAPIRequest authenticates with the token of the file's host.
+	req := newAPIRequest(fileURL)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+rangeChunkSize-1))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The server ignored the range and sends the whole file, skip what
+		// was already written.
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			return 0, false, err
+		}
+		n, err := io.Copy(w, resp.Body)
+		return n, err == nil, err
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The previous chunk ended exactly at the end of the file.
+		return 0, true, nil
+	default:
+		return 0, false, httpStatusError(resp)
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		// Keep what arrived, the next attempt continues from there.
+		return n, false, err
+	}
+	total := contentRangeTotal(resp.Header.Get("Content-Range"))
+	return n, n < rangeChunkSize || (total >= 0 && offset+n >= int64(total)), nil
+}
+
+// contentRangeTotal returns the size of the file from a Content-Range header
+// like "bytes 0-99/1234", -1 when it is unknown.
+func contentRangeTotal(contentRange string) int {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1
+	}
+	total, err := strconv.Atoi(contentRange[i+1:])
+	if err != nil {
+		return -1
+	}
+	return total
+}
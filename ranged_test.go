@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestContentRangeTotal(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"bytes 0-99/1234", 1234},
+		{"bytes 0-99/*", -1},
+		{"", -1},
+		{"bytes 0-99", -1},
+	}
+	for _, tt := range tests {
+		if got := contentRangeTotal(tt.header); got != tt.want {
+			t.Errorf("contentRangeTotal(%q) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestFetchRanged(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), (rangeChunkSize*2+1000)/16)
+	tests := []struct {
+		name    string
+		content []byte
+		// failAt fails the first request of the range starting at that
+		// offset, -1 for none.
+		failAt      int
+		ignoreRange bool
+	}{
+		{"several chunks", large, -1, false},
+		{"exactly one chunk", large[:rangeChunkSize], -1, false},
+		{"small file", []byte("# Small\n"), -1, false},
+		{"failed chunk is retried", large, rangeChunkSize, false},
+		{"server ignoring ranges", large, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			failed := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				fail := !failed && tt.failAt >= 0 && strings.HasPrefix(r.Header.Get("Range"), fmt.Sprintf("bytes=%d-", tt.failAt))
+				if fail {
+					failed = true
+				}
+				mu.Unlock()
+				if fail {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				if tt.ignoreRange {
+					r.Header.Del("Range")
+				}
+				http.ServeContent(w, r, "file.md", time.Time{}, bytes.NewReader(tt.content))
+			}))
+			defer server.Close()
+
+			var got bytes.Buffer
+			if err := fetchRanged(server.Client(), server.URL+"/file.md", treeItem{Path: "file.md", Size: len(tt.content)}, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), tt.content) {
+				t.Fatalf("got %d bytes, want %d", got.Len(), len(tt.content))
+			}
+		})
+	}
+}
+
+func TestFetchRangeIgnored(t *testing.T) {
+	content := []byte("0123456789")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	// The part already written is skipped when the server sends the whole
+	// file.
+	var got bytes.Buffer
+	n, done, err := fetchRange(server.Client(), server.URL, &got, 4)
+	if err != nil || !done || n != 6 || got.String() != "456789" {
+		t.Errorf("got %d, %v, %v, %q", n, done, err, got.String())
+	}
+}
+
+func TestFetchRangeToken(t *testing.T) {
+	testConfig(t)
+	cfg.Tokens = map[string]string{"github.com": "github-token", "git.example.com": "example-token"}
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		w.Write([]byte("# Doc\n"))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: serverTransport{server}}
+
+	for fileURL, want := range map[string]string{
+		rawFileURL("octo/docs", "commit", "a.md"):    "Bearer github-token",
+		"https://git.example.com/octo/docs/raw/a.md": "Bearer example-token",
+	} {
+		if _, _, err := fetchRange(client, fileURL, ioutil.Discard, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got Authorization %q, want %q", fileURL, got, want)
+		}
+	}
+}
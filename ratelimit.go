@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type rateLimit struct {
+	Limit     int   `json:"limit"`
+	Used      int   `json:"used"`
+	Remaining int   `json:"remaining"`
+	Reset     int64 `json:"reset"`
+}
+
+func newRateLimitCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ratelimit",
+		Short: "Show the remaining API rate limit of the configured token",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !setup() {
+				return
+			}
+
+			limits, err := fetchRateLimits(httpClient())
+			if err != nil {
+				return
+			}
+			for _, name := range []string{"core", "graphql", "search"} {
+				limit, ok := limits[name]
+				if !ok {
+					continue
+				}
+				fmt.Printf("%-8s %5d/%-5d remaining, resets at %s\n", name, limit.Remaining, limit.Limit, time.Unix(limit.Reset, 0).Format(time.RFC3339))
+			}
+		},
+	}
+}
+
+func fetchRateLimits(client *http.Client) (map[string]rateLimit, error) {
+	req := newAPIRequest(apiURL + "/rate_limit")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := httpStatusError(resp)
+		log.Errorf("Failed to query rate limit: %s\n", err)
+		return nil, err
+	}
+
+	var rateLimits struct {
+		Resources map[string]rateLimit `json:"resources"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rateLimits); err != nil {
+		log.Errorf("Failed to decode response JSON: %s\n", err)
+		return nil, err
+	}
+
+	return rateLimits.Resources, nil
+}
+
+// maxRetryAfterWaits is how often a request is retried after a response
+// asking to wait with Retry-After.
+const maxRetryAfterWaits = 5
+
+// retryAfterTransport waits and resends requests that hit GitHub's secondary
+// rate limit (403 or 429 with Retry-After) instead of failing them, so a
+// burst of requests doesn't mark dozens of files as errors.
+type retryAfterTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	var waited time.Duration
+	done := func(resp *http.Response, err error, attempt int) (*http.Response, error) {
+		recordRequest(req, resp, err, attempt+1, time.Since(start)-waited, waited)
+		return resp, err
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := t.transport.RoundTrip(req)
+		if err != nil || req.Method != http.MethodGet || attempt == maxRetryAfterWaits {
+			return done(resp, err, attempt)
+		}
+		if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+			return done(resp, nil, attempt)
+		}
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil || seconds < 0 {
+			return done(resp, nil, attempt)
+		}
+		resp.Body.Close()
+
+		wait := time.Duration(seconds) * time.Second
+		log.Warnf("Secondary rate limit hit on %s, waiting %s\n", req.URL.Host, wait)
+		time.Sleep(wait)
+		waited += wait
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// readmeFetcher is implemented by providers that can fetch the README of a
+// repository with a single request.
+type readmeFetcher interface {
+	FetchReadme(ref string) (treeItem, []byte, error)
+}
+
+// fetchedFile is a provider whose file was already downloaded.
+type fetchedFile struct {
+	Provider
+	content []byte
+}
+
+func (p *fetchedFile) FetchFile(item treeItem) ([]byte, error) {
+	return p.content, nil
+}
+
+func (p *githubProvider) FetchReadme(ref string) (treeItem, []byte, error) {
+	var readme struct {
+		Path    string `json:"path"`
+		Sha     string `json:"sha"`
+		Size    int    `json:"size"`
+		Content string `json:"content"`
+	}
+	if err := getJSON(p.client, fmt.Sprintf("%s/repos/%s/readme?ref=%s", apiURL, p.repo, ref), &readme); err != nil {
+		return treeItem{}, nil, err
+	}
+	content, err := base64.StdEncoding.DecodeString(readme.Content)
+	if err != nil {
+		log.Errorf("Failed to decode base64 content: %s\n", err)
+		return treeItem{}, nil, err
+	}
+	return treeItem{Path: readme.Path, Type: "blob", Sha: readme.Sha, Size: readme.Size}, content, nil
+}
+
+// syncReadme downloads only the README of a repository, with --readme-only.
+func syncReadme(repo, ref string, provider Provider, history History) {
+	if fetcher, ok := provider.(readmeFetcher); ok {
+		item, content, err := fetcher.FetchReadme(ref)
+		if err != nil {
+			return
+		}
+		syncFile(repo, "", item, history, &fetchedFile{provider, content}, nil)
+		return
+	}
+
+	commit, err := provider.ResolveRef(ref)
+	if err != nil {
+		return
+	}
+	tree, err := provider.ListFiles(commit, "")
+	if err != nil {
+		return
+	}
+	for _, item := range tree {
+		if item.Type == "blob" && isReadme(item.Path) {
+			syncFile(repo, commit, item, history, provider, nil)
+			return
+		}
+	}
+	log.Warnf("No README found in %s\n", repo)
+}
+
+func isReadme(filePath string) bool {
+	return !strings.Contains(filePath, "/") && strings.HasPrefix(strings.ToLower(path.Base(filePath)), "readme")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// redactions rewrite the content of every file before it is written, as
+// EXPR=>REPLACEMENT with $1 or ${name} for the groups of the expression.
+// Without =>, matches are replaced with [REDACTED]. They run in order, so a
+// later rule sees the output of the earlier ones.
+var redactions []string
+
+type redactRule struct {
+	re          *regexp.Regexp
+	replacement []byte
+}
+
+var redactRules []redactRule
+
+func parseRedactions() error {
+	redactRules = nil
+	for _, r := range redactions {
+		expr, replacement := r, "[REDACTED]"
+		if split := strings.SplitN(r, "=>", 2); len(split) == 2 {
+			expr, replacement = split[0], split[1]
+		}
+		if expr == "" {
+			return fmt.Errorf("invalid redaction %s, expected EXPR=>REPLACEMENT", r)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid redaction %s: %s", r, err)
+		}
+		redactRules = append(redactRules, redactRule{re, []byte(replacement)})
+	}
+	return nil
+}
+
+func redactContent(content []byte) []byte {
+	for _, rule := range redactRules {
+		content = rule.re.ReplaceAll(content, rule.replacement)
+	}
+	return content
+}
+
+// redactText redacts the files that aren't markdown, like assets and
+// governance files, when they are text. Binary files are written as they
+// are.
+func redactText(content []byte) []byte {
+	if len(redactRules) == 0 || !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 {
+		return content
+	}
+	return redactContent(content)
+}
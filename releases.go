@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const releasesPerPage = 100
+
+type release struct {
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Body        string    `json:"body"`
+	HTMLURL     string    `json:"html_url"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// syncReleases saves the notes of every GitHub release of a repository as
+// releases/<tag>.md, with --releases.
+func syncReleases(client *http.Client, repo string, history History) {
+	if isLocalRepo(repo) || isGist(repo) {
+		return
+	}
+	if remote, err := parseRemoteRepo(repo); err != nil || remote.Provider != providerGitHub {
+		log.Warnf("Release notes are only supported for GitHub repositories: %s\n", repo)
+		return
+	}
+
+	for page := 1; ; page++ {
+		var releases []release
+		url := fmt.Sprintf("%s/repos/%s/releases?per_page=%d&page=%d", apiURL, repo, releasesPerPage, page)
+		if err := getJSON(client, url, &releases); err != nil {
+			return
+		}
+
+		for _, r := range releases {
+			if r.Draft {
+				continue
+			}
+			filePath := "releases/" + strings.ReplaceAll(r.TagName, "/", "-") + ".md"
+			content := []byte(releaseMarkdown(r))
+			sha := gitBlobSha(content)
+			if !shouldDownload(filePath, sha, history) {
+				continue
+			}
+
+			saveGenerated(repo, filePath, content, history)
+		}
+
+		if len(releases) < releasesPerPage {
+			return
+		}
+	}
+}
+
+func releaseMarkdown(r release) string {
+	title := r.Name
+	if title == "" {
+		title = r.TagName
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "Tag: [%s](%s)", r.TagName, r.HTMLURL)
+	if !r.PublishedAt.IsZero() {
+		fmt.Fprintf(&b, ", published %s", r.PublishedAt.Format("2006-01-02"))
+	}
+	if r.Prerelease {
+		b.WriteString(" (pre-release)")
+	}
+	b.WriteString("\n")
+	if body := strings.TrimSpace(r.Body); body != "" {
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// detectRenames finds queued files whose blob is already mirrored under
+// another path that no longer exists upstream, and returns new path -> old
+// path for them. current is the full upstream tree, nil when only changes
+// are known, in which case just the renames reported by the provider count.
+func detectRenames(repo string, queued []treeItem, current map[string]bool, history History) map[string]string {
+	vanished := make(map[string][]string)
+	if current != nil {
+		for path, entry := range history.Files {
+			if entry.Status == statusOK && entry.Sha != "" && !current[path] {
+				vanished[entry.Sha] = append(vanished[entry.Sha], path)
+			}
+		}
+	}
+
+	renames := make(map[string]string)
+	used := make(map[string]bool)
+	for _, item := range queued {
+		if !shouldDownload(item.Path, item.Sha, history) {
+			continue
+		}
+
+		var candidates []string
+		if item.PreviousPath != "" {
+			candidates = []string{item.PreviousPath}
+		} else {
+			candidates = vanished[item.Sha]
+		}
+
+		for _, oldPath := range candidates {
+			if used[oldPath] || history.Files[oldPath].Sha != item.Sha {
+				continue
+			}
+			// History isn't namespaced per repository, so only trust the
+			// entry if the file actually exists in this repository's output.
+			if mirroredPath(repo, oldPath, item.Sha) == "" {
+				continue
+			}
+			renames[item.Path] = oldPath
+			used[oldPath] = true
+			break
+		}
+	}
+
+	return renames
+}
+
+// vanishedFiles returns the files of the history that are mirrored from repo
+// but no longer in its tree.
+func vanishedFiles(repo string, current map[string]bool, history History) []string {
+	var vanished []string
+	for path, entry := range history.Files {
+		if entry.Status != statusOK || current[path] || !isDocFile(path) {
+			continue
+		}
+		// History isn't namespaced per repository, see detectRenames.
+		if mirroredPath(repo, path, entry.Sha) != "" {
+			vanished = append(vanished, path)
+		}
+	}
+	sort.Strings(vanished)
+	return vanished
+}
+
+// mirroredPath returns where the output of a file with the blob sha is, ""
+// when it isn't in the output of repo. Without the blob in the cache the
+// layout of --route-by and --route-language can't be told.
+func mirroredPath(repo, filePath, sha string) string {
+	candidates := []string{localPath(repo, filePath)}
+	if content, ok := readCachedBlob(sha); ok {
+		candidates = append([]string{outputPath(repo, filePath, content)}, candidates...)
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// moveFile moves an output file and its translations.
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), os.ModePerm); err != nil {
+		log.Errorf("Failed to create directory: %s\n", to)
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		log.Errorf("Failed to move file %s: %s\n", from, err)
+		return err
+	}
+	moveTranslations(from, to)
+	return nil
+}
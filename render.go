@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+)
+
+var markdown = newMarkdown("github", "")
+
+// newMarkdown returns a renderer highlighting fenced code blocks with the
+// given chroma style, "none" turns highlighting off.
+func newMarkdown(style, plantUMLServer string) goldmark.Markdown {
+	extensions := []goldmark.Extender{extension.GFM, extension.Footnote, &alerts{}, &anchors{}, &diagrams{plantUMLServer}}
+	if style != "none" {
+		extensions = append(extensions, highlighting.NewHighlighting(highlighting.WithStyle(style)))
+	}
+
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID(), parser.WithAttribute()),
+	)
+}
+
+func checkHighlightStyle(style string) error {
+	if _, ok := styles.Registry[style]; !ok && style != "none" {
+		return fmt.Errorf("unknown highlight style: %s", style)
+	}
+	return nil
+}
+
+// parseRendering sets up the renderer and templates shared by serve and the
+// convert-html step.
+func parseRendering() error {
+	if err := checkHighlightStyle(cfg.HighlightStyle); err != nil {
+		return err
+	}
+	markdown = newMarkdown(cfg.HighlightStyle, cfg.PlantUMLServer)
+	templates = newTemplates()
+	if cfg.Theme != "" {
+		theme, err := loadTheme(cfg.Theme)
+		if err != nil {
+			return fmt.Errorf("failed to load theme: %s", err)
+		}
+		templates = theme
+	}
+	return nil
+}
+
+// renderMarkdown converts a markdown document to HTML. Raw HTML in the
+// document is left out, mirrored repositories aren't trusted.
+func renderMarkdown(source []byte) (template.HTML, error) {
+	var buf bytes.Buffer
+	ctx := parser.NewContext(parser.WithIDs(newHeadingIDs()))
+	if err := markdown.Convert(source, &buf, parser.WithContext(ctx)); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
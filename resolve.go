@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var resolves []string
+
+// parseResolves reads the --resolve host:ip overrides.
+func parseResolves() error {
+	cfg.Resolve = make(map[string]string)
+	for _, r := range resolves {
+		split := strings.SplitN(r, ":", 2)
+		if len(split) < 2 || split[0] == "" || net.ParseIP(split[1]) == nil {
+			return fmt.Errorf("invalid resolve, expected host:ip: %s", r)
+		}
+		cfg.Resolve[strings.ToLower(split[0])] = split[1]
+	}
+	if cfg.DNSServer != "" {
+		if _, _, err := net.SplitHostPort(cfg.DNSServer); err != nil {
+			cfg.DNSServer = net.JoinHostPort(cfg.DNSServer, "53")
+		}
+	}
+	return nil
+}
+
+// dialContext connects to the --resolve address of a host when it has one
+// and otherwise looks the host up with the --dns-server, if set.
+func dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if cfg.DNSServer != "" {
+		server := cfg.DNSServer
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil {
+			if ip, ok := cfg.Resolve[strings.ToLower(host)]; ok {
+				log.Debugf("Resolving %s to %s\n", host, ip)
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newRetryCmd() *cobra.Command {
+	var attempts int
+	var backoff time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "retry",
+		Short: "Download again only the files whose last download failed",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !setup() {
+				os.Exit(exitUsage)
+			}
+			if attempts < 1 {
+				log.Errorf("--attempts must be at least 1\n")
+				os.Exit(exitUsage)
+			}
+			unlock := lockOrExit()
+			defer unlock()
+
+			history := loadHistory()
+			failed := make(map[string]bool)
+			for path, entry := range history.Files {
+				if entry.Status == statusError {
+					failed[path] = true
+				}
+			}
+			if len(failed) == 0 {
+				log.Infof("No failed files in %s\n", cfg.History)
+				return
+			}
+
+			var recovered, failing []string
+			for _, repo := range cfg.Repos {
+				ok, notOK := retryRepo(repo, history, failed, attempts, backoff)
+				recovered = append(recovered, ok...)
+				failing = append(failing, notOK...)
+			}
+			saveHistory(history)
+			finishSync()
+
+			var missing []string
+			for path := range failed {
+				missing = append(missing, path)
+			}
+			printRetryReport(recovered, failing, missing)
+
+			if code := reportErrors(); code != exitOK {
+				os.Exit(code)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&attempts, "attempts", 3, "Attempts per file")
+	cmd.Flags().DurationVar(&backoff, "backoff", 2*time.Second, "Wait before the second attempt, doubled after every further one")
+
+	return cmd
+}
+
+// retryRepo downloads the failed files still present in repo, removing them
+// from failed. It returns the paths that were recovered and the ones that
+// failed every attempt.
+func retryRepo(repo string, history History, failed map[string]bool, attempts int, backoff time.Duration) (recovered, failing []string) {
+	provider, repo, err := newProvider(httpClient(), repo)
+	if err != nil {
+		recordError(err)
+		return nil, nil
+	}
+	commit, err := provider.ResolveRef(repoRef(repo))
+	if err != nil {
+		recordError(err)
+		return nil, nil
+	}
+	tree, err := provider.ListFiles(commit, includePrefix())
+	if err != nil {
+		recordError(err)
+		return nil, nil
+	}
+
+	for _, item := range filterDocFiles(tree) {
+		if !failed[item.Path] || isIgnored(repo, item.Path) {
+			continue
+		}
+		delete(failed, item.Path)
+
+		wait := backoff
+		for attempt := 1; ; attempt++ {
+			counts := snapshotErrors()
+			syncFile(repo, commit, item, history, provider, nil)
+			if history.Files[item.Path].Status == statusOK {
+				recovered = append(recovered, item.Path)
+				break
+			}
+			if attempt == attempts {
+				failing = append(failing, item.Path)
+				break
+			}
+			restoreErrors(counts)
+			log.Warnf("Retrying %s in %s (attempt %d of %d failed)\n", item.Path, wait, attempt, attempts)
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+	return recovered, failing
+}
+
+func printRetryReport(recovered, failing, missing []string) {
+	for _, section := range []struct {
+		title string
+		paths []string
+	}{
+		{"Recovered", recovered},
+		{"Still failing", failing},
+		{"Not found in any repository", missing},
+	} {
+		if len(section.paths) == 0 {
+			continue
+		}
+		sort.Strings(section.paths)
+		fmt.Printf("%s (%d):\n", section.title, len(section.paths))
+		for _, path := range section.paths {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// schemaEnum is the flag annotation listing the values a flag accepts.
+const schemaEnum = "schema_enum"
+
+// configSchema is a JSON Schema of the config file, generated from the flags
+// of every command so it can't drift from them.
+func configSchema(root *cobra.Command) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var add func(c *cobra.Command)
+	add = func(c *cobra.Command) {
+		visit := func(flag *pflag.Flag) {
+			switch flag.Name {
+			case "config", "profile", "help", "version":
+				return
+			}
+			if _, ok := properties[flag.Name]; !ok {
+				properties[flag.Name] = flagSchema(flag)
+			}
+		}
+		c.PersistentFlags().VisitAll(visit)
+		c.LocalFlags().VisitAll(visit)
+		for _, sub := range c.Commands() {
+			add(sub)
+		}
+	}
+	add(root)
+
+	profile := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	all := make(map[string]interface{})
+	for name, property := range properties {
+		all[name] = property
+	}
+	all["profiles"] = map[string]interface{}{
+		"description":          "Named sets of keys selected with --profile, replacing the top level keys",
+		"type":                 "object",
+		"additionalProperties": profile,
+	}
+
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "md-downloader config",
+		"type":                 "object",
+		"properties":           all,
+		"additionalProperties": false,
+	}
+}
+
+func flagSchema(flag *pflag.Flag) map[string]interface{} {
+	schema := map[string]interface{}{"description": flag.Usage}
+	switch flag.Value.Type() {
+	case "bool":
+		schema["type"] = "boolean"
+		schema["default"] = flag.DefValue == "true"
+	case "int":
+		schema["type"] = "integer"
+		if n, err := strconv.Atoi(flag.DefValue); err == nil {
+			schema["default"] = n
+		}
+	case "duration":
+		schema["type"] = "string"
+		schema["pattern"] = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|^0$`
+		schema["default"] = flag.DefValue
+	case "stringSlice", "stringArray":
+		// Mappings are accepted for host=value flags like token.
+		schema["anyOf"] = []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": []string{"string", "number", "boolean", "object", "array"}}},
+		}
+	default:
+		// String defaults like the cache directory depend on the machine,
+		// they are left to the descriptions.
+		schema["type"] = "string"
+	}
+	if values, ok := flag.Annotations[schemaEnum]; ok {
+		schema["enum"] = values
+	}
+	return schema
+}
+
+func newConfigSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print a JSON Schema of the config file for editors and CI",
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := json.MarshalIndent(configSchema(cmd.Root()), "", "    ")
+			if err != nil {
+				log.Errorf("Failed to encode schema: %s\n", err)
+				return
+			}
+			fmt.Println(string(data))
+		},
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestFlagSchemaEnum(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("status", "", "Only files with this status")
+	flags.String("output", "", "Output directory")
+	flags.SetAnnotation("status", schemaEnum, []string{statusOK, statusRejected})
+
+	if got := flagSchema(flags.Lookup("status"))["enum"]; !reflect.DeepEqual(got, []string{"ok", "rejected"}) {
+		t.Errorf("got enum %v", got)
+	}
+	if got, ok := flagSchema(flags.Lookup("output"))["enum"]; ok {
+		t.Errorf("got enum %v for a flag without one", got)
+	}
+}
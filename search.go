@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+const searchLimit = 50
+
+type indexedDoc struct {
+	URL   string
+	Title string
+	Text  string
+}
+
+type searchResult struct {
+	indexedDoc
+	Score   int
+	Snippet string
+}
+
+// searchIndex is a full-text index of the markdown files in the output
+// directory, mapping every word to the documents containing it and how often.
+type searchIndex struct {
+	mu    sync.RWMutex
+	docs  []indexedDoc
+	terms map[string]map[int]int
+}
+
+func newSearchCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search the downloaded documents",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			index := &searchIndex{}
+			index.build(cfg.Output)
+			for _, result := range index.search(strings.Join(args, " ")) {
+				fmt.Printf("%s\t%s\n", filepath.Join(cfg.Output, filepath.FromSlash(result.URL)), result.Snippet)
+			}
+		},
+	}
+}
+
+func (idx *searchIndex) build(root string) {
+	var docs []indexedDoc
+	terms := make(map[string]map[int]int)
+
+	walkMarkdown(root, func(file, rel string, content []byte) {
+		if hiddenPath(filepath.ToSlash(rel)) {
+			return
+		}
+		id := len(docs)
+		docs = append(docs, indexedDoc{
+			URL:   "/" + filepath.ToSlash(rel),
+			Title: documentTitle(content, filepath.Base(file)),
+			Text:  string(content),
+		})
+		for _, term := range tokenize(string(content)) {
+			if terms[term] == nil {
+				terms[term] = make(map[int]int)
+			}
+			terms[term][id]++
+		}
+	})
+
+	idx.mu.Lock()
+	idx.docs, idx.terms = docs, terms
+	idx.mu.Unlock()
+	log.Debugf("Indexed %d documents\n", len(docs))
+}
+
+// walkMarkdown calls fn for every markdown file below root with its path
+// relative to root.
+func walkMarkdown(root string, fn func(file, rel string, content []byte)) {
+	filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !isMarkdown(file) {
+			return nil
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Warnf("Failed to read %s: %s\n", file, err)
+			return nil
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return nil
+		}
+		fn(file, rel, content)
+		return nil
+	})
+}
+
+// search returns the documents containing every word of the query, the ones
+// mentioning them most often first.
+func (idx *searchIndex) search(query string) []searchResult {
+	words := tokenize(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	scores := make(map[int]int)
+	for id, count := range idx.terms[words[0]] {
+		scores[id] = count
+	}
+	for _, word := range words[1:] {
+		matches := idx.terms[word]
+		for id := range scores {
+			if count, ok := matches[id]; ok {
+				scores[id] += count
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	var results []searchResult
+	for id, score := range scores {
+		doc := idx.docs[id]
+		results = append(results, searchResult{doc, score, snippet(doc.Text, words)})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].URL < results[j].URL
+	})
+	if len(results) > searchLimit {
+		results = results[:searchLimit]
+	}
+	return results
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func documentTitle(content []byte, fallback string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(line[2:])
+		}
+	}
+	return fallback
+}
+
+// snippet returns the first line containing one of the words.
+func snippet(text string, words []string) string {
+	for _, line := range strings.Split(text, "\n") {
+		lower := strings.ToLower(line)
+		for _, word := range words {
+			if strings.Contains(lower, word) {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,19 @@
+package main
+
+import "strings"
+
+// resolveSecret reads a token that is given as a reference to a secret
+// store instead of the token itself, other values are returned as they are.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, vaultPrefix):
+		return vaultSecret(value)
+	case strings.HasPrefix(value, awsSecretsPrefix):
+		return awsSecret(value)
+	case strings.HasPrefix(value, ssmPrefix):
+		return ssmParameter(value)
+	case strings.HasPrefix(value, gcpSecretsPrefix):
+		return gcpSecret(value)
+	}
+	return value, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --secret-scan looks for credentials in every file before it is written:
+//
+//	warn        logs them and writes the file as it is
+//	redact      replaces them with [REDACTED:<rule>]
+//	quarantine  doesn't write the file, it is rejected as by --validate and
+//	            copied to --quarantine-dir for review when that is set
+const (
+	secretScanOff        = "off"
+	secretScanWarn       = "warn"
+	secretScanRedact     = "redact"
+	secretScanQuarantine = "quarantine"
+
+	secretScanCheck = "secret-scan"
+)
+
+type secretRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var secretRules = []secretRule{
+	{"private-key", regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----(?:[\s\S]*?-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----)?`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github-token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b|\bgithub_pat_[A-Za-z0-9_]{40,}\b`)},
+	{"gitlab-token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"slack-webhook", regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9/]+`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"stripe-key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+}
+
+var (
+	secretAllow   []string
+	secretAllowed []*regexp.Regexp
+)
+
+type secretFinding struct {
+	rule  string
+	line  int
+	start int
+	end   int
+}
+
+func parseSecretScan() error {
+	switch cfg.SecretScan {
+	case "":
+		cfg.SecretScan = secretScanOff
+	case secretScanOff, secretScanWarn, secretScanRedact, secretScanQuarantine:
+	default:
+		return fmt.Errorf("invalid --secret-scan %s, expected off, warn, redact or quarantine", cfg.SecretScan)
+	}
+	secretAllowed = nil
+	for _, expr := range secretAllow {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid --secret-allow %s: %s", expr, err)
+		}
+		secretAllowed = append(secretAllowed, re)
+	}
+	return nil
+}
+
+// findSecrets returns the matches of the rules that no --secret-allow
+// expression matches, in the order they appear. Overlapping matches are
+// reported once, by the first rule.
+func findSecrets(content []byte) []secretFinding {
+	var findings []secretFinding
+	taken := make([]bool, len(content))
+	for _, rule := range secretRules {
+	matches:
+		for _, m := range rule.re.FindAllIndex(content, -1) {
+			for i := m[0]; i < m[1]; i++ {
+				if taken[i] {
+					continue matches
+				}
+			}
+			for _, allow := range secretAllowed {
+				if allow.Match(content[m[0]:m[1]]) {
+					continue matches
+				}
+			}
+			for i := m[0]; i < m[1]; i++ {
+				taken[i] = true
+			}
+			findings = append(findings, secretFinding{rule: rule.name, line: lineAt(content, m[0]), start: m[0], end: m[1]})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].start < findings[j].start })
+	return findings
+}
+
+func describeSecrets(findings []secretFinding) string {
+	var list []string
+	for _, f := range findings {
+		list = append(list, fmt.Sprintf("%s on line %d", f.rule, f.line))
+	}
+	return strings.Join(list, ", ")
+}
+
+// scanSecrets applies --secret-scan to a file about to be written and
+// returns the content to write, or a validation error when the file is
+// quarantined.
+func scanSecrets(repo, filePath string, content []byte) ([]byte, error) {
+	if cfg.SecretScan == secretScanOff {
+		return content, nil
+	}
+	findings := findSecrets(content)
+	if len(findings) == 0 {
+		return content, nil
+	}
+	summary := describeSecrets(findings)
+	switch cfg.SecretScan {
+	case secretScanWarn:
+		log.Warnf("Possible secrets in %s: %s\n", filePath, summary)
+	case secretScanRedact:
+		log.Warnf("Redacting possible secrets in %s: %s\n", filePath, summary)
+		var redacted bytes.Buffer
+		last := 0
+		for _, f := range findings {
+			redacted.Write(content[last:f.start])
+			redacted.WriteString("[REDACTED:" + f.rule + "]")
+			last = f.end
+		}
+		redacted.Write(content[last:])
+		content = redacted.Bytes()
+	case secretScanQuarantine:
+		if cfg.QuarantineDir != "" {
+			dest := filepath.Join(cfg.QuarantineDir, repoName(repo), filePath)
+			if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+				log.Errorf("Failed to quarantine %s: %s\n", filePath, err)
+			} else if err := ioutil.WriteFile(dest, content, 0600); err != nil {
+				log.Errorf("Failed to quarantine %s: %s\n", filePath, err)
+			}
+		}
+		message := "possible secrets: " + summary
+		rejections.Lock()
+		rejections.list = append(rejections.list, rejection{Repo: repo, Path: filePath, Check: secretScanCheck, Message: message})
+		rejections.Unlock()
+		return nil, &validationError{check: secretScanCheck, message: message}
+	}
+	return content, nil
+}
+
+func isSecretRejection(err error) bool {
+	var rejected *validationError
+	return errors.As(err, &rejected) && rejected.check == secretScanCheck
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type indexEntry struct {
+	Name string
+	URL  string
+}
+
+func newServeCmd() *cobra.Command {
+	var addr string
+	var watch time.Duration
+	var baseURL string
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the output directory over HTTP",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !setup() {
+				return
+			}
+
+			if cfg.Theme != "" {
+				http.Handle("/_theme/", themeHandler(cfg.Theme))
+			}
+
+			runAsDaemon(cmd)
+			if watch > 0 {
+				go watchRepos(watch)
+			}
+
+			index := &searchIndex{}
+			index.build(cfg.Output)
+
+			reload := newReloader()
+			reload.onChange = func() { index.build(cfg.Output) }
+			go reload.watch(cfg.Output, 2*time.Second)
+
+			handleHealth(http.DefaultServeMux, watch > 0)
+			http.Handle(reloadPath, reload)
+			http.Handle("/search", searchHandler(index))
+			http.Handle("/sitemap.xml", sitemapHandler(cfg.Output, baseURL))
+			http.Handle("/", serveHandler(cfg.Output))
+			listener, err := listen("serve", addr)
+			if err != nil {
+				log.Errorf("Failed to start server: %s\n", err)
+				return
+			}
+			log.Infof("Serving %s on %s\n", cfg.Output, listener.Addr())
+			sdReadyAndWatchdog()
+			if err := http.Serve(listener, nil); err != nil {
+				log.Errorf("Failed to start server: %s\n", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", ":8080", "Address to listen on")
+	cmd.Flags().StringVar(&baseURL, "base-url", "", "Public URL of the server used in sitemap.xml, the request's host by default")
+	cmd.Flags().DurationVar(&watch, "watch", 0, "Also sync the repositories at this interval, open pages reload when they change")
+	cmd.Flags().DurationVar(&stuckAfter, "stuck-after", 30*time.Minute, "How long a sync may run before /healthz fails")
+
+	return cmd
+}
+
+// serveHandler serves the files of root as they are and answers directory
+// requests with an index of every document below the directory.
+func serveHandler(root string) http.HandlerFunc {
+	files := http.FileServer(http.Dir(root))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		if hiddenPath(urlPath) {
+			http.NotFound(w, r)
+			return
+		}
+		dir := filepath.Join(root, filepath.FromSlash(urlPath))
+
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() && isMarkdown(urlPath) && !r.URL.Query().Has("raw") {
+			serveDocument(w, dir, urlPath)
+			return
+		}
+		if err != nil || !info.IsDir() {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		entries, err := indexEntries(dir, urlPath)
+		if err != nil {
+			log.Errorf("Failed to list %s: %s\n", dir, err)
+			http.Error(w, "failed to list directory", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := templates.ExecuteTemplate(w, "index", page{
+			Title:   urlPath,
+			Path:    urlPath,
+			Entries: entries,
+		}); err != nil {
+			log.Errorf("Failed to render index of %s: %s\n", dir, err)
+		}
+	}
+}
+
+// hiddenPath reports whether a URL path has a segment starting with a dot,
+// like /.git/config. They aren't served or listed.
+func hiddenPath(urlPath string) bool {
+	for _, segment := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func searchHandler(index *searchIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		results := index.search(query)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := templates.ExecuteTemplate(w, "search", page{
+			Title:   "Search",
+			Path:    "/search",
+			Query:   query,
+			Results: results,
+		}); err != nil {
+			log.Errorf("Failed to render search results: %s\n", err)
+		}
+	}
+}
+
+// serveDocument renders a markdown file to HTML, ?raw serves the markdown
+// itself.
+func serveDocument(w http.ResponseWriter, file, urlPath string) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Errorf("Failed to read %s: %s\n", file, err)
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	body, err := renderMarkdown(content)
+	if err != nil {
+		log.Errorf("Failed to render %s: %s\n", file, err)
+		http.Error(w, "failed to render file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, "document", page{
+		Title:  path.Base(urlPath),
+		Path:   urlPath,
+		Parent: path.Dir(urlPath),
+		Body:   body,
+	}); err != nil {
+		log.Errorf("Failed to render %s: %s\n", file, err)
+	}
+}
+
+func indexEntries(dir, urlPath string) ([]indexEntry, error) {
+	var entries []indexEntry
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && file != dir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entries = append(entries, indexEntry{
+			Name: rel,
+			URL:  path.Join(urlPath, rel),
+		})
+		return nil
+	})
+	return entries, err
+}
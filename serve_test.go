@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeHiddenPaths(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"docs/readme.md":        "# Docs\n",
+		".git/config":           "[core]\n",
+		"docs/.github/issue.md": "# Issue\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := serveHandler(root)
+
+	for url, want := range map[string]int{
+		"/docs/readme.md?raw":      http.StatusOK,
+		"/.git/config":             http.StatusNotFound,
+		"/.git/":                   http.StatusNotFound,
+		"/docs/.github/issue.md":   http.StatusNotFound,
+		"/docs/../.git/config":     http.StatusNotFound,
+		"/docs/%2e%2e/.git/config": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s: got %d, want %d", url, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type sidecar struct {
+	Repo     string    `json:"repo" yaml:"repo"`
+	Path     string    `json:"path" yaml:"path"`
+	Source   string    `json:"source_url,omitempty" yaml:"source_url,omitempty"`
+	Sha      string    `json:"sha" yaml:"sha"`
+	Commit   string    `json:"commit,omitempty" yaml:"commit,omitempty"`
+	SyncedAt time.Time `json:"synced_at" yaml:"synced_at"`
+}
+
+func sidecarPath(dest string) string {
+	return dest + ".meta." + cfg.Sidecar
+}
+
+// writeSidecar writes the provenance of a downloaded file next to it, with
+// --sidecar, so the file itself stays untouched.
+func writeSidecar(repo, commit string, item treeItem, dest string) {
+	if cfg.Sidecar == "" {
+		return
+	}
+
+	meta := sidecar{
+		Repo:     repo,
+		Path:     item.Path,
+		Source:   sourceURL(repo, commit, item.Path),
+		Sha:      item.Sha,
+		Commit:   commit,
+		SyncedAt: time.Now(),
+	}
+
+	var data []byte
+	var err error
+	if cfg.Sidecar == "json" {
+		data, err = json.MarshalIndent(meta, "", "  ")
+	} else {
+		data, err = yaml.Marshal(meta)
+	}
+	if err != nil {
+		log.Errorf("Failed to encode metadata of %s: %s\n", item.Path, err)
+		return
+	}
+	if err := ioutil.WriteFile(sidecarPath(dest), data, 0644); err != nil {
+		log.Errorf("Failed to write metadata of %s: %s\n", item.Path, err)
+	}
+}
+
+func removeSidecar(dest string) {
+	if cfg.Sidecar != "" {
+		os.Remove(sidecarPath(dest))
+	}
+}
+
+// sourceURL links to a file at a commit in the web interface of its host.
+func sourceURL(repo, commit, filePath string) string {
+	if commit == "" {
+		commit = repoRef(repo)
+	}
+	switch {
+	case isLocalRepo(repo):
+		path, _ := parseLocalRepo(repo)
+		return localPrefix + strings.TrimSuffix(path, "/") + "/" + filePath
+	case isGist(repo):
+		return "https://gist.github.com/" + strings.TrimPrefix(repo, gistPrefix)
+	}
+
+	remote, err := parseRemoteRepo(repo)
+	if err != nil {
+		return ""
+	}
+	switch remote.Provider {
+	case providerGitLab:
+		return fmt.Sprintf("https://%s/%s/-/blob/%s/%s", remote.Host, remote.Path, commit, filePath)
+	case providerGitea:
+		return fmt.Sprintf("https://%s/%s/src/commit/%s/%s", remote.Host, remote.Path, commit, filePath)
+	}
+	return fmt.Sprintf("https://%s/%s/blob/%s/%s", remote.Host, remote.Path, commit, filePath)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// parseSince accepts a date (2024-01-01), an RFC 3339 timestamp or a
+// duration relative to now (7d, 2w, 12h).
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(value, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(value, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit != 0 {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(value, "d"), "w"))
+		if err == nil {
+			return time.Now().Add(-time.Duration(n) * unit), nil
+		}
+	} else if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid --since value: %s", value)
+}
+
+// filterSince keeps the items in changed, all of them when changed is nil.
+func filterSince(items []treeItem, changed map[string]bool) []treeItem {
+	if changed == nil {
+		return items
+	}
+	var recent []treeItem
+	for _, item := range items {
+		if changed[item.Path] {
+			recent = append(recent, item)
+		} else {
+			log.Debugf("Skipping file: %s (not changed since %s)\n", item.Path, cfg.Since.Format(time.RFC3339))
+		}
+	}
+	return recent
+}
+
+// ChangedSince compares the last commit before since with commit, so the
+// files come from a single call rather than one per commit. It returns nil,
+// keeping every file, when the history starts after since or the compare API
+// truncates the list.
+func (p *githubProvider) ChangedSince(commit string, since time.Time) (map[string]bool, error) {
+	commitsURL := fmt.Sprintf("%s/repos/%s/commits?sha=%s&until=%s&per_page=1", apiURL, p.repo, commit, url.QueryEscape(since.UTC().Format(time.RFC3339)))
+	var before []struct {
+		Sha string `json:"sha"`
+	}
+	if err := getJSON(p.client, commitsURL, &before); err != nil {
+		return nil, err
+	}
+	if len(before) == 0 {
+		return nil, nil
+	}
+
+	var comparison struct {
+		Files []struct {
+			Filename string `json:"filename"`
+		} `json:"files"`
+	}
+	if err := getJSON(p.client, fmt.Sprintf("%s/repos/%s/compare/%s...%s", apiURL, p.repo, before[0].Sha, commit), &comparison); err != nil {
+		return nil, err
+	}
+	if len(comparison.Files) >= compareFileLimit {
+		log.Infof("Too many changes in %s since %s, syncing every file\n", p.repo, since.Format(time.RFC3339))
+		return nil, nil
+	}
+
+	changed := make(map[string]bool)
+	for _, file := range comparison.Files {
+		changed[file.Filename] = true
+	}
+	return changed, nil
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	_, err := getJSONPage(client, url, v)
+	return err
+}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// getJSONPage is getJSON for paginated endpoints, it also returns the URL of
+// the next page from the Link header, "" on the last one.
+func getJSONPage(client *http.Client, url string, v interface{}) (string, error) {
+	resp, err := client.Do(newAPIRequest(url))
+	if err != nil {
+		log.Errorf("Failed to send request: %s\n", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := httpStatusError(resp)
+		log.Errorf("Failed to fetch %s: %s\n", url, err)
+		return "", err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		log.Errorf("Failed to decode response JSON: %s\n", err)
+		return "", err
+	}
+	next := ""
+	if m := nextLink.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+		next = m[1]
+	}
+	return next, nil
+}
+
+func (p *gitCloneProvider) ChangedSince(commit string, since time.Time) (map[string]bool, error) {
+	// The clone has depth 1, deepen it to cover the requested period first.
+	refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", p.branch, p.branch)
+	if _, err := runGit(p.dir, nil, "fetch", "--quiet", "--filter=blob:none", "--shallow-since="+since.Format(time.RFC3339), "origin", refspec); err != nil {
+		log.Errorf("Failed to deepen clone: %s\n", err)
+		return nil, err
+	}
+	output, err := runGit(p.dir, nil, "log", "-z", "--name-only", "--format=", "--since="+since.Format(time.RFC3339), commit)
+	if err != nil {
+		log.Errorf("Failed to read history: %s\n", err)
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, path := range strings.Split(output, "\x00") {
+		if path = strings.TrimSpace(path); path != "" {
+			changed[path] = true
+		}
+	}
+	return changed, nil
+}
+
+func (p *localProvider) ChangedSince(commit string, since time.Time) (map[string]bool, error) {
+	commits, err := p.r.Log(&git.LogOptions{From: plumbing.NewHash(commit), Since: &since})
+	if err != nil {
+		log.Errorf("Failed to read history of %s: %s\n", commit, err)
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	err = commits.ForEach(func(c *object.Commit) error {
+		tree, err := c.Tree()
+		if err != nil {
+			return err
+		}
+		parentTree := &object.Tree{}
+		if c.NumParents() > 0 {
+			parent, err := c.Parent(0)
+			if err != nil {
+				return err
+			}
+			if parentTree, err = parent.Tree(); err != nil {
+				return err
+			}
+		}
+
+		changes, err := object.DiffTree(parentTree, tree)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			if change.To.Name != "" {
+				changed[change.To.Name] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Failed to read history of %s: %s\n", commit, err)
+		return nil, err
+	}
+
+	return changed, nil
+}
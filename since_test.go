@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGithubChangedSince(t *testing.T) {
+	testConfig(t)
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/repos/octo/docs/commits":
+			if r.URL.Query().Get("until") != "2024-01-01T00:00:00Z" || r.URL.Query().Get("sha") != "head" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode([]map[string]string{{"sha": "base"}})
+		case "/repos/octo/docs/compare/base...head":
+			w.Write([]byte(`{"files": [{"filename": "a.md"}, {"filename": "docs/b.md"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p := &githubProvider{client: &http.Client{Transport: serverTransport{server}}, repo: testRepo}
+	changed, err := p.ChangedSince("head", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 2 || !changed["a.md"] || !changed["docs/b.md"] {
+		t.Errorf("got %v", changed)
+	}
+	if len(requests) != 2 {
+		t.Errorf("got %d requests, want 2: %v", len(requests), requests)
+	}
+}
+
+func TestGithubChangedSinceNewRepo(t *testing.T) {
+	testConfig(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	p := &githubProvider{client: &http.Client{Transport: serverTransport{server}}, repo: testRepo}
+	changed, err := p.ChangedSince("head", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []treeItem{{Path: "a.md"}, {Path: "b.md"}}
+	if got := filterSince(items, changed); len(got) != 2 {
+		t.Errorf("got %v, want every item", got)
+	}
+}
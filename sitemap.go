@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const sitemapFile = "sitemap.xml"
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapHandler lists every rendered document of the output directory. URLs
+// are made absolute with baseURL, or the host of the request when it's empty.
+func sitemapHandler(root, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		base := strings.TrimSuffix(baseURL, "/")
+		if base == "" {
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			base = scheme + "://" + r.Host
+		}
+
+		w.Header().Set("Content-Type", "application/xml")
+		if err := encodeSitemap(w, buildSitemap(root, base, isMarkdown)); err != nil {
+			log.Errorf("Failed to write sitemap: %s\n", err)
+		}
+	}
+}
+
+// buildSitemap lists the files below root that match.
+func buildSitemap(root, base string, match func(string) bool) sitemap {
+	s := sitemap{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if err != nil || info.IsDir() || !match(file) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil || hiddenPath(filepath.ToSlash(rel)) {
+			return nil
+		}
+		u := url.URL{Path: "/" + filepath.ToSlash(rel)}
+		s.URLs = append(s.URLs, sitemapURL{
+			Loc:     base + u.EscapedPath(),
+			LastMod: info.ModTime().UTC().Format(time.RFC3339),
+		})
+		return nil
+	})
+	return s
+}
+
+func encodeSitemap(w io.Writer, s sitemap) error {
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(s)
+}
+
+// writeSitemap writes sitemap.xml to the output directory when documents are
+// converted to HTML, listing the .html pages. URLs start with
+// --sitemap-base-url.
+func writeSitemap() {
+	converting := false
+	for _, repo := range cfg.Repos {
+		converting = converting || hasStep(repo, stepConvertHTML)
+	}
+	if !converting {
+		return
+	}
+	s := buildSitemap(cfg.Output, strings.TrimSuffix(cfg.SitemapBaseURL, "/"), func(file string) bool {
+		return strings.EqualFold(filepath.Ext(file), ".html")
+	})
+	var buf bytes.Buffer
+	if err := encodeSitemap(&buf, s); err != nil {
+		log.Errorf("Failed to write sitemap: %s\n", err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(cfg.Output, sitemapFile), buf.Bytes(), 0644); err != nil {
+		log.Errorf("Failed to write sitemap: %s\n", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSitemap(t *testing.T) {
+	testConfig(t)
+	cfg.Repos = []string{testRepo}
+	cfg.SitemapBaseURL = "https://docs.example.com/"
+	for _, path := range []string{"docs/guide.html", "docs/a b.html", "docs/guide.md", ".git/index.html"} {
+		file := filepath.Join(cfg.Output, path)
+		os.MkdirAll(filepath.Dir(file), os.ModePerm)
+		ioutil.WriteFile(file, []byte("x"), 0644)
+	}
+
+	writeSitemap()
+	if _, err := os.Stat(filepath.Join(cfg.Output, sitemapFile)); err == nil {
+		t.Fatal("sitemap written without HTML conversion")
+	}
+
+	cfg.Transforms = map[string][]string{"*": {stepConvertHTML}}
+	writeSitemap()
+	data, err := ioutil.ReadFile(filepath.Join(cfg.Output, sitemapFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sitemap := string(data)
+	for _, want := range []string{"<loc>https://docs.example.com/docs/guide.html</loc>", "<loc>https://docs.example.com/docs/a%20b.html</loc>"} {
+		if !strings.Contains(sitemap, want) {
+			t.Errorf("missing %s in %s", want, sitemap)
+		}
+	}
+	for _, absent := range []string{"guide.md", ".git"} {
+		if strings.Contains(sitemap, absent) {
+			t.Errorf("unexpected %s in %s", absent, sitemap)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	snapshotExt       = ".tar.gz"
+	snapshotInfoEntry = "snapshot.json"
+	snapshotHistory   = "history"
+	snapshotOutput    = "output/"
+)
+
+type snapshotInfo struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Output    string    `json:"output"`
+	Files     int       `json:"files"`
+}
+
+var snapshotDir string
+
+func newSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save and restore the output directory together with the history",
+	}
+	cmd.PersistentFlags().StringVar(&snapshotDir, "snapshot-dir", "snapshots", "Directory the snapshots are kept in")
+
+	var name string
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Save the output directory and the history",
+		Run: func(cmd *cobra.Command, args []string) {
+			if name == "" {
+				name = time.Now().UTC().Format("20060102-150405")
+			}
+			unlock := lockOrExit()
+			defer unlock()
+			if err := createSnapshot(name); err != nil {
+				unlock()
+				log.Errorf("Failed to create snapshot %s: %s\n", name, err)
+				os.Exit(exitCodes[classifyError(err)])
+			}
+			log.Infof("Created snapshot %s\n", name)
+		},
+	}
+	create.Flags().StringVar(&name, "name", "", "Name of the snapshot, the current time by default")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the snapshots, newest first",
+		Run: func(cmd *cobra.Command, args []string) {
+			infos, err := listSnapshots()
+			if err != nil {
+				log.Errorf("Failed to list snapshots: %s\n", err)
+				return
+			}
+			for _, info := range infos {
+				fmt.Printf("%-25s %s %6d files  %s\n", info.Name, info.CreatedAt.Format(time.RFC3339), info.Files, info.Output)
+			}
+		},
+	}
+
+	restore := &cobra.Command{
+		Use:   "restore <name>",
+		Short: "Replace the output directory and the history with a snapshot",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, err := os.Stat(snapshotPath(args[0])); err != nil {
+				log.Errorf("Failed to restore snapshot %s: %s\n", args[0], err)
+				os.Exit(exitCodes[classifyError(err)])
+			}
+			// No sync may write the output while it is replaced.
+			unlock := lockOrExit()
+			defer unlock()
+			// The current state is saved first so the restore can be undone.
+			backup := "before-restore-" + time.Now().UTC().Format("20060102-150405")
+			if err := createSnapshot(backup); err != nil {
+				unlock()
+				log.Errorf("Failed to save the current state before restoring: %s\n", err)
+				os.Exit(exitCodes[classifyError(err)])
+			}
+			if err := restoreSnapshot(args[0]); err != nil {
+				unlock()
+				log.Errorf("Failed to restore snapshot %s: %s\n", args[0], err)
+				os.Exit(exitCodes[classifyError(err)])
+			}
+			log.Infof("Restored snapshot %s, the previous state is saved as %s\n", args[0], backup)
+		},
+	}
+
+	cmd.AddCommand(create, list, restore)
+	return cmd
+}
+
+func snapshotPath(name string) string {
+	return filepath.Join(snapshotDir, name+snapshotExt)
+}
+
+func createSnapshot(name string) error {
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid snapshot name: %s", name)
+	}
+	if _, err := os.Stat(snapshotPath(name)); err == nil {
+		return fmt.Errorf("snapshot %s already exists", name)
+	}
+	if err := os.MkdirAll(snapshotDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// Written to a temporary file first, a failed snapshot must not look
+	// like a complete one.
+	tmp := snapshotPath(name) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = writeSnapshot(tw, name)
+	for _, c := range []io.Closer{tw, gz, f} {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, snapshotPath(name))
+}
+
+func writeSnapshot(tw *tar.Writer, name string) error {
+	files, err := outputFiles()
+	if err != nil {
+		return err
+	}
+
+	info, _ := json.Marshal(snapshotInfo{Name: name, CreatedAt: time.Now(), Output: cfg.Output, Files: len(files)})
+	if err := writeTarFile(tw, snapshotInfoEntry, info); err != nil {
+		return err
+	}
+	// The history is kept as it is stored, encrypted ones stay encrypted.
+	if history, err := readState(cfg.History); err == nil {
+		if err := writeTarFile(tw, snapshotHistory, history); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return writeOutputFiles(tw, files, false)
+}
+
+func outputFiles() ([]string, error) {
+	var files []string
+	err := filepath.Walk(cfg.Output, func(file string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && file == cfg.Output {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// writeOutputFiles adds files of the output directory below output/. With
+// dereference, symbolic links are stored as the files they point to.
+func writeOutputFiles(tw *tar.Writer, files []string, dereference bool) error {
+	for _, file := range files {
+		rel, err := filepath.Rel(cfg.Output, file)
+		if err != nil {
+			return err
+		}
+		stat := os.Lstat
+		if dereference {
+			stat = os.Stat
+		}
+		info, err := stat(file)
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = snapshotOutput + filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := copyFileTo(tw, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, content []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+func copyFileTo(w io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func listSnapshots() ([]snapshotInfo, error) {
+	entries, err := ioutil.ReadDir(snapshotDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []snapshotInfo
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), snapshotExt) {
+			continue
+		}
+		info, err := readSnapshotInfo(filepath.Join(snapshotDir, entry.Name()))
+		if err != nil {
+			log.Warnf("Failed to read snapshot %s: %s\n", entry.Name(), err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.After(infos[j].CreatedAt) })
+	return infos, nil
+}
+
+func readSnapshotInfo(file string) (snapshotInfo, error) {
+	var info snapshotInfo
+	f, err := os.Open(file)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return info, err
+	}
+
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	if err != nil {
+		return info, err
+	}
+	if header.Name != snapshotInfoEntry {
+		return info, fmt.Errorf("not a snapshot")
+	}
+	err = json.NewDecoder(tr).Decode(&info)
+	return info, err
+}
+
+// restoreSnapshot replaces the output directory and the history file with
+// the ones in the snapshot.
+func restoreSnapshot(name string) error {
+	f, err := os.Open(snapshotPath(name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(cfg.Output); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.Output, os.ModePerm); err != nil {
+		return err
+	}
+
+	restoredHistory := false
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case header.Name == snapshotHistory:
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := writeState(cfg.History, content); err != nil {
+				return err
+			}
+			restoredHistory = true
+		case strings.HasPrefix(header.Name, snapshotOutput):
+			if err := restoreOutputFile(header, tr, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	// A snapshot taken before the first sync has no history, remote ones
+	// can't be removed and are emptied instead.
+	if !restoredHistory && isRemoteState(cfg.History) {
+		empty, _ := json.Marshal(History{Version: historyVersion, Files: map[string]HistoryEntry{}, Commits: map[string]string{}})
+		return writeStateFile(cfg.History, empty)
+	}
+	if !restoredHistory {
+		if err := os.Remove(cfg.History); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreFile(file string, header *tar.Header, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		return os.Symlink(header.Linkname, file)
+	case tar.TypeReg:
+		out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(file, header.ModTime, header.ModTime)
+	}
+	return nil
+}
+
+// restoreOutputFile writes an output/ entry of an archive to the output
+// directory. Symbolic links are only restored when allowed, and only when
+// they point at another file of the output. Entries below a directory that
+// is a link are rejected, they would be written wherever it points.
+func restoreOutputFile(header *tar.Header, r io.Reader, allowLinks bool) error {
+	rel := filepath.FromSlash(strings.TrimPrefix(header.Name, snapshotOutput))
+	if rel == "" || escapesDir(rel) || filepath.IsAbs(rel) {
+		return fmt.Errorf("invalid path in archive: %s", header.Name)
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		if !allowLinks {
+			return fmt.Errorf("invalid symbolic link in archive: %s", header.Name)
+		}
+		target := filepath.FromSlash(header.Linkname)
+		if filepath.IsAbs(target) || escapesDir(filepath.Join(filepath.Dir(rel), target)) {
+			return fmt.Errorf("symbolic link %s points outside of the output: %s", header.Name, header.Linkname)
+		}
+	}
+	dir := cfg.Output
+	for _, segment := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		dir = filepath.Join(dir, segment)
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid path in archive, %s is a symbolic link: %s", dir, header.Name)
+		}
+	}
+	file := filepath.Join(cfg.Output, rel)
+	// An existing file may be a link shared with other paths.
+	os.Remove(file)
+	return restoreFile(file, header, r)
+}
+
+func escapesDir(rel string) bool {
+	rel = filepath.Clean(rel)
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
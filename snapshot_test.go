@@ -0,0 +1,87 @@
+package main
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRestoreOutputFileLinks(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    []tar.Header
+		allowLinks bool
+		wantErr    bool
+	}{
+		{"file", []tar.Header{{Name: snapshotOutput + "a/b.md", Typeflag: tar.TypeReg, Mode: 0644}}, true, false},
+		{"parent path", []tar.Header{{Name: snapshotOutput + "../b.md", Typeflag: tar.TypeReg, Mode: 0644}}, true, true},
+		{"link in output", []tar.Header{{Name: snapshotOutput + "a/c.md", Typeflag: tar.TypeSymlink, Linkname: "../b.md"}}, true, false},
+		{"link with links disallowed", []tar.Header{{Name: snapshotOutput + "a/c.md", Typeflag: tar.TypeSymlink, Linkname: "../b.md"}}, false, true},
+		{"absolute link", []tar.Header{{Name: snapshotOutput + "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}}, true, true},
+		{"link escaping the output", []tar.Header{{Name: snapshotOutput + "a/link", Typeflag: tar.TypeSymlink, Linkname: "../../x"}}, true, true},
+		{"write through a link", []tar.Header{
+			{Name: snapshotOutput + "link", Typeflag: tar.TypeSymlink, Linkname: "a"},
+			{Name: snapshotOutput + "link/x.md", Typeflag: tar.TypeReg, Mode: 0644},
+		}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Output = filepath.Join(t.TempDir(), "docs")
+			os.MkdirAll(filepath.Join(cfg.Output, "a"), 0755)
+			var err error
+			for i := range tt.headers {
+				if err = restoreOutputFile(&tt.headers[i], strings.NewReader(""), tt.allowLinks); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSnapshotRemoteHistory(t *testing.T) {
+	testConfig(t)
+	var mu sync.Mutex
+	state := []byte(`{"version": 1}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			w.Write(state)
+		case http.MethodPut:
+			state, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	cfg.History = server.URL + "/history.json"
+	snapshotDir = t.TempDir()
+	defer func() { snapshotDir = "snapshots" }()
+	if err := os.MkdirAll(cfg.Output, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createSnapshot("first"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	state = []byte(`{"version": 2}`)
+	mu.Unlock()
+	if err := restoreSnapshot("first"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if string(state) != `{"version": 1}` {
+		t.Errorf("got remote history %s, want the one of the snapshot", state)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// buildFiles are extensionless files that are never documentation.
+var buildFiles = []string{"Makefile", "GNUmakefile", "Dockerfile", "Containerfile", "Gemfile", "Rakefile", "Procfile", "Jenkinsfile", "Vagrantfile", "Brewfile", "Podfile", "Justfile", "Earthfile", "BUILD", "WORKSPACE"}
+
+var markdownSyntax = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^#{1,6} \S`),
+	regexp.MustCompile(`(?m)^(=+|-+)[ \t]*$`),
+	regexp.MustCompile(`(?m)^[ \t]*([-*+]|\d+\.) \S`),
+	regexp.MustCompile(`\[[^\]\n]+\]\([^)\n]+\)`),
+	regexp.MustCompile("(?m)^(```|~~~)"),
+}
+
+// isSniffCandidate reports whether a file without an extension may be
+// documentation, its content decides with --sniff.
+func isSniffCandidate(filePath string) bool {
+	if !cfg.Sniff || isGovernanceFile(filePath) {
+		return false
+	}
+	name := path.Base(filePath)
+	if path.Ext(name) != "" || strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, build := range buildFiles {
+		if name == build {
+			return false
+		}
+	}
+	return true
+}
+
+// sniffContent is the content looksLikeMarkdown judges, text in other
+// encodings is judged as UTF-8 whatever --encoding says.
+func sniffContent(content []byte) []byte {
+	converted, _ := toUTF8(content)
+	return converted
+}
+
+// looksLikeMarkdown is a heuristic for text files meant to be read: UTF-8
+// without NUL bytes or a shebang, with markdown syntax or mostly prose.
+func looksLikeMarkdown(content []byte) bool {
+	if len(content) == 0 || !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 || bytes.HasPrefix(content, []byte("#!")) {
+		return false
+	}
+	for _, syntax := range markdownSyntax {
+		if syntax.Match(content) {
+			return true
+		}
+	}
+
+	// Lines ending like code count against the file, lines of a few words
+	// for it. Short lines like titles count for neither.
+	code, prose := 0, 0
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.ContainsAny(line[len(line)-1:], ";{}()=:"):
+			code++
+		case len(strings.Fields(line)) >= 3:
+			prose++
+		}
+	}
+	return prose > 0 && prose*10 >= (prose+code)*6
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+type snippetLanguage struct {
+	Ext     string
+	Comment string
+}
+
+// snippetLanguages maps fence info strings to a file extension and the line
+// comment used for the provenance header. Languages without comments get no
+// header.
+var snippetLanguages = map[string]snippetLanguage{
+	"go":         {".go", "//"},
+	"js":         {".js", "//"},
+	"javascript": {".js", "//"},
+	"ts":         {".ts", "//"},
+	"typescript": {".ts", "//"},
+	"java":       {".java", "//"},
+	"kotlin":     {".kt", "//"},
+	"c":          {".c", "//"},
+	"cpp":        {".cpp", "//"},
+	"csharp":     {".cs", "//"},
+	"rust":       {".rs", "//"},
+	"swift":      {".swift", "//"},
+	"python":     {".py", "#"},
+	"py":         {".py", "#"},
+	"ruby":       {".rb", "#"},
+	"sh":         {".sh", "#"},
+	"bash":       {".sh", "#"},
+	"shell":      {".sh", "#"},
+	"yaml":       {".yaml", "#"},
+	"yml":        {".yaml", "#"},
+	"toml":       {".toml", "#"},
+	"dockerfile": {".dockerfile", "#"},
+	"sql":        {".sql", "--"},
+	"json":       {".json", ""},
+}
+
+// extractSnippets writes the fenced code blocks of a document to
+// snippets/<repo>/<document>/<n>.<ext> in the output directory, replacing the
+// ones of the previous version of the document.
+func extractSnippets(repo, filePath string, content []byte) {
+	dir := filepath.Join(cfg.Output, "snippets", repoName(repo), filepath.FromSlash(filePath))
+	if err := os.RemoveAll(dir); err != nil {
+		log.Errorf("Failed to remove old snippets: %s\n", dir)
+		return
+	}
+
+	doc := markdown.Parser().Parse(text.NewReader(content))
+	n := 0
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		block, ok := node.(*ast.FencedCodeBlock)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		language, ok := snippetLanguages[strings.ToLower(string(block.Language(content)))]
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+
+		var code strings.Builder
+		if language.Comment != "" {
+			fmt.Fprintf(&code, "%s Extracted from %s:%s line %d\n", language.Comment, repo, filePath, lineOf(content, block))
+		}
+		lines := block.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			code.Write(segment.Value(content))
+		}
+
+		n++
+		snippetPath := filepath.Join(dir, fmt.Sprintf("%02d%s", n, language.Ext))
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			log.Errorf("Failed to create directory: %s\n", dir)
+			return ast.WalkStop, err
+		}
+		if err := ioutil.WriteFile(snippetPath, []byte(code.String()), 0644); err != nil {
+			log.Errorf("Failed to write snippet: %s\n", snippetPath)
+			return ast.WalkStop, err
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	if n > 0 {
+		log.Infof("Extracted %d snippets from %s\n", n, filePath)
+	}
+}
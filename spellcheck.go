@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var wordPattern = regexp.MustCompile(`\p{L}+(?:'\p{L}+)*`)
+
+type misspelling struct {
+	File string
+	Line int
+	Word string
+}
+
+func newSpellcheckCmd() *cobra.Command {
+	var dictionaries, projectDictionaries []string
+
+	cmd := &cobra.Command{
+		Use:   "spellcheck",
+		Short: "Report misspelled words in the downloaded files",
+		Run: func(cmd *cobra.Command, args []string) {
+			known := make(map[string]bool)
+			for _, file := range dictionaries {
+				if err := loadDictionary(file, known); err != nil {
+					log.Errorf("Failed to load dictionary: %s\n", err)
+					return
+				}
+			}
+
+			// Project dictionaries only apply to the files of their
+			// repository, i.e. below output/<name>.
+			projects := make(map[string]map[string]bool)
+			for _, d := range projectDictionaries {
+				split := strings.SplitN(d, "=", 2)
+				if len(split) != 2 {
+					log.Errorf("Invalid project dictionary: %s\n", d)
+					return
+				}
+				if projects[split[0]] == nil {
+					projects[split[0]] = make(map[string]bool)
+				}
+				if err := loadDictionary(split[1], projects[split[0]]); err != nil {
+					log.Errorf("Failed to load dictionary: %s\n", err)
+					return
+				}
+			}
+
+			var misspellings []misspelling
+			walkMarkdown(cfg.Output, func(file, rel string, content []byte) {
+				rel = filepath.ToSlash(rel)
+				project := projects[strings.SplitN(rel, "/", 2)[0]]
+				misspellings = append(misspellings, spellcheck(rel, content, func(word string) bool {
+					return known[word] || project[word]
+				})...)
+			})
+			sort.SliceStable(misspellings, func(i, j int) bool {
+				return misspellings[i].File < misspellings[j].File
+			})
+
+			for _, m := range misspellings {
+				fmt.Printf("%s:%d: %s\n", m.File, m.Line, m.Word)
+			}
+			log.Infof("Found %d misspelled words\n", len(misspellings))
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&dictionaries, "dictionary", []string{"/usr/share/dict/words"}, "Word lists with one word per line")
+	cmd.Flags().StringArrayVar(&projectDictionaries, "project-dictionary", []string{}, "Extra word list for one repository (name=FILE), can be repeated")
+
+	return cmd
+}
+
+func loadDictionary(file string, words map[string]bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" && !strings.HasPrefix(word, "#") {
+			words[strings.ToLower(word)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// spellcheck returns the first occurrence in the file of every unknown word
+// in the document's prose. Code, links and HTML are skipped, as are words
+// that look like identifiers or acronyms.
+func spellcheck(file string, content []byte, known func(string) bool) []misspelling {
+	var misspellings []misspelling
+	reported := make(map[string]bool)
+
+	doc := markdown.Parser().Parse(text.NewReader(content))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.(type) {
+		case *ast.CodeSpan, *ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock, *ast.RawHTML, *ast.AutoLink:
+			return ast.WalkSkipChildren, nil
+		}
+		textNode, ok := n.(*ast.Text)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+
+		segment := textNode.Segment
+		for _, loc := range wordPattern.FindAllIndex(segment.Value(content), -1) {
+			word := string(segment.Value(content)[loc[0]:loc[1]])
+			if !checkable(word) {
+				continue
+			}
+			lower := strings.TrimSuffix(strings.ToLower(word), "'s")
+			if known(lower) || reported[lower] {
+				continue
+			}
+			reported[lower] = true
+			misspellings = append(misspellings, misspelling{
+				File: file,
+				Line: lineAt(content, segment.Start+loc[0]),
+				Word: word,
+			})
+		}
+		return ast.WalkContinue, nil
+	})
+	return misspellings
+}
+
+func checkable(word string) bool {
+	if len([]rune(word)) < 3 {
+		return false
+	}
+	for i, r := range word {
+		if i > 0 && unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
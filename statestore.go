@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// State files like the history can live outside the local disk so stateless
+// CI runners share them:
+//
+//	https://state.example.com/history.json  GET and PUT, --token host=TOKEN authenticates
+//	s3://bucket/history.json                 S3 object, AWS credentials from the environment
+//	gist://<id>/history.json                 file of a GitHub gist
+//
+// HTTP and S3 writes are conditional on the ETag of the last read or write,
+// a run that would overwrite the state another run saved in between fails
+// instead. Gists have no conditional writes, the last run wins.
+const (
+	s3Prefix       = "s3://"
+	gistURLPrefix  = "gist://"
+	gistBinaryMark = "base64:"
+)
+
+var stateETags = struct {
+	sync.Mutex
+	tags map[string]string
+}{tags: make(map[string]string)}
+
+func isRemoteState(location string) bool {
+	return strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://") ||
+		strings.HasPrefix(location, s3Prefix) || strings.HasPrefix(location, gistURLPrefix)
+}
+
+func readState(location string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(location, gistURLPrefix):
+		return readGistState(location)
+	case isRemoteState(location):
+		req, err := stateRequest(http.MethodGet, location, nil)
+		if err != nil {
+			return nil, err
+		}
+		return doStateRequest(location, req)
+	}
+	return ioutil.ReadFile(location)
+}
+
+func writeState(location string, data []byte) error {
+	switch {
+	case strings.HasPrefix(location, gistURLPrefix):
+		return writeGistState(location, data)
+	case isRemoteState(location):
+		req, err := stateRequest(http.MethodPut, location, data)
+		if err != nil {
+			return err
+		}
+		_, err = doStateRequest(location, req)
+		return err
+	}
+	return ioutil.WriteFile(location, data, 0600)
+}
+
+// stateRequest builds the request for an HTTP or S3 state location.
+func stateRequest(method, location string, body []byte) (*http.Request, error) {
+	bucket, key, isS3 := strings.Cut(strings.TrimPrefix(location, s3Prefix), "/")
+	target := location
+	if isS3 = isS3 && strings.HasPrefix(location, s3Prefix); isS3 {
+		target = s3ObjectURL(bucket, key)
+	}
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// State changes behind the back of the HTTP cache, it is always fetched.
+	req.Header.Set("Cache-Control", "no-store")
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/octet-stream")
+		// Servers that don't send ETags get unconditional writes.
+		stateETags.Lock()
+		if etag, ok := stateETags.tags[location]; !ok {
+			req.Header.Set("If-None-Match", "*")
+		} else if etag != "" {
+			req.Header.Set("If-Match", etag)
+		}
+		stateETags.Unlock()
+	}
+
+	if !isS3 {
+		if token := tokenFor(req.URL.Host); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req, nil
+	}
+	creds, err := awsEnvCredentials()
+	if err != nil {
+		return nil, err
+	}
+	signAWS(req, body, "s3", awsRegion(), creds)
+	return req, nil
+}
+
+// s3ObjectURL addresses an object virtual-hosted style on AWS and path style
+// on the endpoint of AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, e.g. MinIO.
+func s3ObjectURL(bucket, key string) string {
+	for _, name := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(name); endpoint != "" {
+			return strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + key
+		}
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, awsRegion(), key)
+}
+
+func doStateRequest(location string, req *http.Request) ([]byte, error) {
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && req.Method == http.MethodGet:
+		return nil, fmt.Errorf("%s: %w", location, os.ErrNotExist)
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return nil, fmt.Errorf("%s was changed by another run since it was read", location)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, httpStatusError(resp)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	stateETags.Lock()
+	stateETags.tags[location] = resp.Header.Get("ETag")
+	stateETags.Unlock()
+	return data, nil
+}
+
+func parseGistState(location string) (id, file string, err error) {
+	id, file, ok := strings.Cut(strings.TrimPrefix(location, gistURLPrefix), "/")
+	if !ok || id == "" || file == "" {
+		return "", "", fmt.Errorf("invalid gist state location %s, expected gist://<id>/<file>", location)
+	}
+	return id, file, nil
+}
+
+// readGistState reads a file of a gist. Gists only hold text, binary content
+// like an encrypted history is stored base64 encoded.
+func readGistState(location string) ([]byte, error) {
+	id, name, err := parseGistState(location)
+	if err != nil {
+		return nil, err
+	}
+	req := newAPIRequest(fmt.Sprintf("%s/gists/%s", apiURL, id))
+	req.Header.Set("Cache-Control", "no-store")
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpStatusError(resp)
+	}
+
+	var g gist
+	if err := json.NewDecoder(resp.Body).Decode(&g); err != nil {
+		return nil, err
+	}
+	file, ok := g.Files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", location, os.ErrNotExist)
+	}
+	provider := &gistProvider{client: httpClient(), id: id, gist: &g}
+	content, err := provider.content(file)
+	if err != nil {
+		return nil, err
+	}
+	if encoded := strings.TrimPrefix(string(content), gistBinaryMark); len(encoded) < len(content) {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+	return content, nil
+}
+
+func writeGistState(location string, data []byte) error {
+	id, name, err := parseGistState(location)
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	if !utf8.Valid(data) {
+		content = gistBinaryMark + base64.StdEncoding.EncodeToString(data)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"files": map[string]interface{}{name: map[string]string{"content": content}},
+	})
+
+	req := newAPIRequest(fmt.Sprintf("%s/gists/%s", apiURL, url.PathEscape(id)))
+	req.Method = http.MethodPatch
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return httpStatusError(resp)
+	}
+	return nil
+}
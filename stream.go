@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+)
+
+// fetchBytes collects what a streaming fetch writes, for the files that are
+// processed in memory.
+func fetchBytes(item treeItem, fetch func(treeItem, io.Writer) error) ([]byte, error) {
+	var content bytes.Buffer
+	content.Grow(item.Size)
+	if err := fetch(item, &content); err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
+
+// streamable tells whether a file can be written as it is downloaded: none
+// of the steps it goes through need its whole content. Markdown files are
+// only checked for their encoding, once they are on disk.
+func streamable(repo string, item treeItem, provider Provider, renamed bool) bool {
+	if _, ok := provider.(streamFetcher); !ok || renamed {
+		return false
+	}
+	if filterNeedsContent || placeProgram != nil || len(redactRules) > 0 || cfg.SecretScan != secretScanOff || len(validators) > 0 ||
+		cfg.Link != linkCopy || cfg.Diff || cfg.KeepVersions > 0 || isSniffCandidate(item.Path) {
+		return false
+	}
+	if !isMarkdown(item.Path) {
+		return true
+	}
+	return cfg.EOL == "" && len(wasmPlugins) == 0 && !cfg.Snippets && len(pipeline(repo)) == 0 &&
+		cfg.RouteBy == "" && !cfg.RouteLanguage && len(cfg.Languages) == 0 && len(cfg.Translate) == 0
+}
+
+// syncStreamed is syncFile for streamable files: the file is downloaded, or
+// copied from the blob cache, to a temporary file next to its destination
+// and renamed. It returns the content of markdown files that must be
+// converted to UTF-8 for syncFile to go on with, done once the file is
+// written or failed.
+func syncStreamed(repo, commit string, item treeItem, history History, provider Provider, action, reason string) ([]byte, bool) {
+	dest := outputPath(repo, item.Path, nil)
+	fail := func(err error) ([]byte, bool) {
+		recordError(err)
+		audit(auditError, repo, item.Path, item.Sha, err.Error())
+		history.Files[item.Path] = HistoryEntry{Sha: item.Sha, Status: statusError, DownloadedAt: time.Now()}
+		saveHistory(history)
+		return nil, true
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		log.Errorf("Failed to create directory: %s\n", dest)
+		return fail(err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		log.Errorf("Failed to create file: %s\n", dest)
+		return fail(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	cached := !cfg.NoBlobCache && len(item.Sha) >= 3 && copyFileTo(tmp, blobCachePath(item.Sha)) == nil
+	if cached {
+		log.Infof("Copying file from blob cache: %s\n", item.Path)
+	} else {
+		log.Infof("Downloading file: %s\n", item.Path)
+		// A failed copy from the cache may have written part of the file.
+		if _, err := tmp.Seek(0, io.SeekStart); err == nil {
+			tmp.Truncate(0)
+		}
+		err = provider.(streamFetcher).FetchFileTo(item, tmp)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if !cached {
+		cacheBlobFile(item.Sha, tmp.Name())
+	}
+
+	if isMarkdown(item.Path) && cfg.Encoding != encodingKeep && !plainUTF8File(tmp.Name()) {
+		content, err := ioutil.ReadFile(tmp.Name())
+		if err != nil {
+			return fail(err)
+		}
+		return content, false
+	}
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return fail(err)
+	}
+	os.Chmod(tmp.Name(), 0644)
+	// The old file may be a link shared with other paths.
+	os.Remove(dest)
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		log.Errorf("Failed to save file: %s\n", dest)
+		return fail(err)
+	}
+	log.Infof("File downloaded: %s\n", dest)
+	audit(action, repo, item.Path, item.Sha, reason+", streamed")
+	writeSidecar(repo, commit, item, dest)
+	history.Files[item.Path] = HistoryEntry{Sha: item.Sha, Size: int(info.Size()), Status: statusOK, DownloadedAt: time.Now()}
+	return nil, true
+}
+
+// plainUTF8File tells whether a file is UTF-8 without a BOM, which
+// normalizeEncoding leaves as it is, without reading it into memory.
+func plainUTF8File(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	head := make([]byte, 1024)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	for _, bom := range [][]byte{{0xef, 0xbb, 0xbf}, {0xff, 0xfe}, {0xfe, 0xff}} {
+		if bytes.HasPrefix(head, bom) {
+			return false
+		}
+	}
+	// guessUTF16 only samples the first 1024 bytes.
+	if info.Size()%2 == 0 && guessUTF16(head) != nil {
+		return false
+	}
+	return validUTF8(io.MultiReader(bytes.NewReader(head), f))
+}
+
+// validUTF8 is utf8.Valid for a reader, runes cut at the end of a chunk are
+// checked with the next one.
+func validUTF8(r io.Reader) bool {
+	buf := make([]byte, 32<<10)
+	carry := 0
+	for {
+		n, err := r.Read(buf[carry:])
+		data := buf[:carry+n]
+		keep := 0
+		if err == nil {
+			for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(data[i]) {
+					if !utf8.FullRune(data[i:]) {
+						keep = len(data) - i
+					}
+					break
+				}
+			}
+		}
+		if !utf8.Valid(data[:len(data)-keep]) {
+			return false
+		}
+		carry = copy(buf, data[len(data)-keep:])
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// jsonStringField returns a reader over the value of a top level string field
+// of a JSON object, so a large value like the base64 content of a blob is
+// decoded as it arrives instead of being read into memory first. Escapes
+// other than \n, \r, \/, \\ and \" aren't expected and are rejected.
+func jsonStringField(r io.Reader, field string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	key := []byte(`"` + field + `"`)
+	matched := 0
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("field %s not found in response", field)
+		}
+		if c == key[matched] {
+			matched++
+		} else if c == key[0] {
+			matched = 1
+		} else {
+			matched = 0
+		}
+		if matched < len(key) {
+			continue
+		}
+
+		if err := skipTo(br, ':'); err != nil {
+			return nil, err
+		}
+		if err := skipTo(br, '"'); err != nil {
+			return nil, err
+		}
+		return &jsonStringReader{r: br}, nil
+	}
+}
+
+// skipTo reads up to and including c, only whitespace may come before it.
+func skipTo(r *bufio.Reader, c byte) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == c {
+			return nil
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return fmt.Errorf("unexpected %q in response, expected %q", b, c)
+		}
+	}
+}
+
+type jsonStringReader struct {
+	r    *bufio.Reader
+	done bool
+}
+
+func (s *jsonStringReader) Read(p []byte) (int, error) {
+	if s.done {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) {
+		c, err := s.r.ReadByte()
+		if err == io.EOF {
+			return n, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return n, err
+		}
+		switch c {
+		case '"':
+			s.done = true
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		case '\\':
+			escaped, err := s.r.ReadByte()
+			if err != nil {
+				return n, io.ErrUnexpectedEOF
+			}
+			switch escaped {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case '/', '\\', '"':
+				c = escaped
+			default:
+				return n, fmt.Errorf("unsupported escape \\%c in response", escaped)
+			}
+		}
+		p[n] = c
+		n++
+		if s.r.Buffered() == 0 && n > 0 {
+			return n, nil
+		}
+	}
+	return n, nil
+}
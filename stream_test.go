@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestJSONStringField(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		field   string
+		want    string
+		wantErr bool
+	}{
+		{"plain", `{"sha":"abc","content":"aGVsbG8="}`, "content", "aGVsbG8=", false},
+		{"whitespace", "{\n  \"content\" :\n  \"aGVs\\nbG8=\\n\"\n}", "content", "aGVs\nbG8=\n", false},
+		{"escapes", `{"content":"a\/b\\c\"d\re"}`, "content", "a/b\\c\"d\re", false},
+		{"empty", `{"content":""}`, "content", "", false},
+		{"similar key", `{"ccontent":"x","content":"y"}`, "content", "y", false},
+		{"missing", `{"sha":"abc"}`, "content", "", true},
+		{"not a string", `{"content":42}`, "content", "", true},
+		{"unsupported escape", `{"content":"\u0041"}`, "content", "", true},
+		{"truncated", `{"content":"abc`, "content", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One byte at a time, values span reads.
+			r, err := jsonStringField(iotest.OneByteReader(strings.NewReader(tt.json)), tt.field)
+			var got []byte
+			if err == nil {
+				got, err = ioutil.ReadAll(r)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidUTF8(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"# Café ☕ 日本語\n", true},
+		{"", true},
+		{"caf\xe9\n", false},
+		{"cut \xe2\x98", false},
+	}
+	for _, tt := range tests {
+		// One byte at a time cuts every rune.
+		if got := validUTF8(iotest.OneByteReader(strings.NewReader(tt.content))); got != tt.want {
+			t.Errorf("validUTF8(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestPlainUTF8File(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"plain", strings.Repeat("# Café\n", 500), true},
+		{"bom", "\xef\xbb\xbf# Doc\n", false},
+		{"utf-16", "#\x00 \x00D\x00o\x00c\x00", false},
+		{"latin-1", "caf\xe9\n", false},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(file, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := plainUTF8File(file); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// streamingProvider is a fakeProvider that writes files as they are
+// downloaded.
+type streamingProvider struct {
+	fakeProvider
+	streamed []string
+}
+
+func (p *streamingProvider) FetchFileTo(item treeItem, w io.Writer) error {
+	p.streamed = append(p.streamed, item.Path)
+	_, err := io.WriteString(w, p.files[item.Path])
+	return err
+}
+
+func TestSyncFileStreamed(t *testing.T) {
+	testConfig(t)
+	cfg.NoBlobCache = false
+	provider := &streamingProvider{fakeProvider: fakeProvider{files: map[string]string{
+		"guide.md": "# Guide\n",
+		"latin.md": "caf\xe9\n",
+	}}}
+	history := History{Version: historyVersion, Files: make(map[string]HistoryEntry)}
+	for _, path := range []string{"guide.md", "latin.md"} {
+		syncFile(testRepo, "commit", provider.item(path, provider.files[path]), history, provider, nil)
+	}
+
+	if len(provider.fetched) != 0 || len(provider.streamed) != 2 {
+		t.Errorf("got fetched %v and streamed %v, want both streamed", provider.fetched, provider.streamed)
+	}
+	if got := readOutput(t, "guide.md"); got != "# Guide\n" {
+		t.Errorf("got guide.md %q", got)
+	}
+	// Files that aren't UTF-8 are converted in memory.
+	if got := readOutput(t, "latin.md"); got != "café\n" {
+		t.Errorf("got latin.md %q", got)
+	}
+	for path, content := range provider.files {
+		if history.Files[path].Status != statusOK || history.Files[path].Size == 0 {
+			t.Errorf("got history %+v for %s", history.Files[path], path)
+		}
+		cached, err := ioutil.ReadFile(blobCachePath(gitBlobSha([]byte(content))))
+		if err != nil || !bytes.Equal(cached, []byte(content)) {
+			t.Errorf("%s isn't in the blob cache: %v", path, err)
+		}
+	}
+	entries, _ := ioutil.ReadDir(localPath(testRepo, ""))
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temporary file left: %s", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeProvider serves files from memory and counts the downloads.
+type fakeProvider struct {
+	files   map[string]string
+	failing map[string]bool
+	fetched []string
+}
+
+func (p *fakeProvider) ResolveRef(ref string) (string, error) {
+	return "commit", nil
+}
+
+func (p *fakeProvider) ListFiles(commit, dir string) ([]treeItem, error) {
+	var items []treeItem
+	for path, content := range p.files {
+		items = append(items, p.item(path, content))
+	}
+	return items, nil
+}
+
+func (p *fakeProvider) FetchFile(item treeItem) ([]byte, error) {
+	p.fetched = append(p.fetched, item.Path)
+	if p.failing[item.Path] {
+		return nil, errors.New("connection reset")
+	}
+	return []byte(p.files[item.Path]), nil
+}
+
+func (p *fakeProvider) item(path, content string) treeItem {
+	return treeItem{Path: path, Type: "blob", Sha: gitBlobSha([]byte(content)), Size: len(content)}
+}
+
+// testConfig points the output and state files at a temporary directory and
+// restores the configuration after the test.
+func testConfig(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	dir := t.TempDir()
+	cfg.Output = filepath.Join(dir, "docs")
+	cfg.History = filepath.Join(dir, "history.json")
+	cfg.Progress = filepath.Join(dir, "progress.json")
+	cfg.CacheDir = filepath.Join(dir, "cache")
+	cfg.Extensions = []string{".md"}
+	cfg.NoBlobCache = true
+	cfg.NoCache = true
+	cfg.Link = linkCopy
+	cfg.SecretScan = secretScanOff
+}
+
+const testRepo = "octo/docs"
+
+func readOutput(t *testing.T, path string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(localPath(testRepo, path))
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+func TestSyncFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     map[string]HistoryEntry
+		existing    map[string]string
+		files       map[string]string
+		failing     map[string]bool
+		renamed     map[string]string
+		wantFetched []string
+		wantOutput  map[string]string
+		wantStatus  map[string]string
+	}{
+		{
+			name:        "new file",
+			files:       map[string]string{"guide.md": "# Guide\n"},
+			wantFetched: []string{"guide.md"},
+			wantOutput:  map[string]string{"guide.md": "# Guide\n"},
+			wantStatus:  map[string]string{"guide.md": statusOK},
+		},
+		{
+			name:        "unchanged file is skipped",
+			history:     map[string]HistoryEntry{"guide.md": {Sha: gitBlobSha([]byte("# Guide\n")), Status: statusOK}},
+			existing:    map[string]string{"guide.md": "# Guide\n"},
+			files:       map[string]string{"guide.md": "# Guide\n"},
+			wantOutput:  map[string]string{"guide.md": "# Guide\n"},
+			wantStatus:  map[string]string{"guide.md": statusOK},
+			wantFetched: nil,
+		},
+		{
+			name:        "changed file is updated",
+			history:     map[string]HistoryEntry{"guide.md": {Sha: gitBlobSha([]byte("# Old\n")), Status: statusOK}},
+			existing:    map[string]string{"guide.md": "# Old\n"},
+			files:       map[string]string{"guide.md": "# New\n"},
+			wantFetched: []string{"guide.md"},
+			wantOutput:  map[string]string{"guide.md": "# New\n"},
+			wantStatus:  map[string]string{"guide.md": statusOK},
+		},
+		{
+			name:        "failed download is recorded and retried",
+			history:     map[string]HistoryEntry{"guide.md": {Sha: gitBlobSha([]byte("# Guide\n")), Status: statusError}},
+			files:       map[string]string{"guide.md": "# Guide\n"},
+			failing:     map[string]bool{"guide.md": true},
+			wantFetched: []string{"guide.md"},
+			wantOutput:  map[string]string{"guide.md": ""},
+			wantStatus:  map[string]string{"guide.md": statusError},
+		},
+		{
+			name:       "renamed file is moved",
+			history:    map[string]HistoryEntry{"old.md": {Sha: gitBlobSha([]byte("# Guide\n")), Status: statusOK}},
+			existing:   map[string]string{"old.md": "# Guide\n"},
+			files:      map[string]string{"guide.md": "# Guide\n"},
+			renamed:    map[string]string{"guide.md": "old.md"},
+			wantOutput: map[string]string{"guide.md": "# Guide\n", "old.md": ""},
+			wantStatus: map[string]string{"guide.md": statusOK},
+			// Without the blob cache the content is needed to place the
+			// file.
+			wantFetched: []string{"guide.md"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConfig(t)
+			restoreErrors(make(map[errorKind]int))
+			for path, content := range tt.existing {
+				if err := saveFile(outputPath(testRepo, path, []byte(content)), []byte(content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			history := History{Version: historyVersion, Files: make(map[string]HistoryEntry)}
+			for path, entry := range tt.history {
+				entry.DownloadedAt = time.Now()
+				history.Files[path] = entry
+			}
+			provider := &fakeProvider{files: tt.files, failing: tt.failing}
+			items, _ := provider.ListFiles("commit", "")
+			current := make(map[string]bool)
+			for _, item := range items {
+				current[item.Path] = true
+			}
+			renames := detectRenames(testRepo, items, current, history)
+			for path, oldPath := range tt.renamed {
+				if renames[path] != oldPath {
+					t.Fatalf("detected renames %v, want %s -> %s", renames, oldPath, path)
+				}
+			}
+
+			for _, item := range items {
+				syncFile(testRepo, "commit", item, history, provider, renames)
+			}
+
+			if len(provider.fetched) != len(tt.wantFetched) || (len(tt.wantFetched) > 0 && provider.fetched[0] != tt.wantFetched[0]) {
+				t.Errorf("fetched %v, want %v", provider.fetched, tt.wantFetched)
+			}
+			for path, want := range tt.wantOutput {
+				if got := readOutput(t, path); got != want {
+					t.Errorf("%s is %q, want %q", path, got, want)
+				}
+			}
+			for path, want := range tt.wantStatus {
+				if got := history.Files[path].Status; got != want {
+					t.Errorf("%s has status %q, want %q", path, got, want)
+				}
+			}
+			if _, ok := history.Files["old.md"]; ok && len(tt.renamed) > 0 {
+				t.Errorf("the history still has the old path of a renamed file")
+			}
+		})
+	}
+}
+
+func TestSyncFileRenameRouted(t *testing.T) {
+	testConfig(t)
+	restoreErrors(make(map[errorKind]int))
+	cfg.RouteBy = "category"
+	content := "---\ncategory: guides\n---\n# Guide\n"
+	if err := saveFile(outputPath(testRepo, "old.md", []byte(content)), []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	// The rename is only found through the blob cache, the layout depends
+	// on the content.
+	cfg.NoBlobCache = false
+	cacheBlob(gitBlobSha([]byte(content)), []byte(content))
+	routed := filepath.Join(cfg.Output, "guides", "docs")
+	history := History{Files: map[string]HistoryEntry{"old.md": {Sha: gitBlobSha([]byte(content)), Status: statusOK}}}
+	provider := &fakeProvider{files: map[string]string{"new.md": content}}
+	item := provider.item("new.md", content)
+
+	renames := detectRenames(testRepo, []treeItem{item}, map[string]bool{"new.md": true}, history)
+	if renames["new.md"] != "old.md" {
+		t.Fatalf("detected renames %v, want old.md -> new.md", renames)
+	}
+	syncFile(testRepo, "commit", item, history, provider, renames)
+
+	if _, err := os.Stat(filepath.Join(routed, "old.md")); !os.IsNotExist(err) {
+		t.Errorf("old.md is still in the output: %v", err)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(routed, "new.md")); string(got) != content {
+		t.Errorf("new.md is %q, want %q", got, content)
+	}
+	if _, ok := history.Files["old.md"]; ok {
+		t.Errorf("the history still has the old path")
+	}
+}
+
+func TestVanishedFiles(t *testing.T) {
+	testConfig(t)
+	for _, path := range []string{"kept.md", "gone.md", "failed.md"} {
+		if err := saveFile(localPath(testRepo, path), []byte("# "+path+"\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := History{Files: map[string]HistoryEntry{
+		"kept.md":   {Sha: "a", Status: statusOK},
+		"gone.md":   {Sha: "b", Status: statusOK},
+		"failed.md": {Sha: "c", Status: statusError},
+		// Mirrored from another repository, not in this one's output.
+		"other.md": {Sha: "d", Status: statusOK},
+	}}
+	got := vanishedFiles(testRepo, map[string]bool{"kept.md": true}, history)
+	if len(got) != 1 || got[0] != "gone.md" {
+		t.Errorf("got %v, want [gone.md]", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Under systemd, watch, serve and webhook report their state for
+// Type=notify units and take their listener from a socket unit:
+//
+//	[Service]
+//	Type=notify
+//	ExecStart=/usr/local/bin/md-downloader serve --config /etc/md-downloader.yaml
+//	ExecReload=/bin/kill -HUP $MAINPID
+//	WatchdogSec=30
+//
+// Outside of systemd NOTIFY_SOCKET and LISTEN_FDS aren't set and nothing
+// changes.
+const (
+	sdReady     = "READY=1"
+	sdReloading = "RELOADING=1"
+	sdStopping  = "STOPPING=1"
+	sdWatchdog  = "WATCHDOG=1"
+
+	// sdListenFDsStart is the first file descriptor systemd passes.
+	sdListenFDsStart = 3
+)
+
+// sdNotify sends a state change to the service manager, see sd_notify(3).
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Warnf("Failed to notify systemd: %s\n", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Warnf("Failed to notify systemd: %s\n", err)
+	}
+}
+
+// sdReadyAndWatchdog reports the service as started and keeps the watchdog
+// of units with WatchdogSec fed.
+func sdReadyAndWatchdog() {
+	sdNotify(sdReady)
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	go func() {
+		for range time.Tick(time.Duration(usec) * time.Microsecond / 2) {
+			sdNotify(sdWatchdog)
+		}
+	}()
+}
+
+// listen returns the socket systemd passed for socket activation, or listens
+// on addr itself when there is none. A unit with several sockets names them
+// with FileDescriptorName=, the one named after the command is used.
+func listen(name, addr string) (net.Listener, error) {
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 || os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return net.Listen("tcp", addr)
+	}
+	// The variables are meant for this process only, not for git or plugins.
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for _, v := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(v)
+	}
+
+	fd := 0
+	if fds > 1 {
+		fd = -1
+		for i, n := range names {
+			if n == name {
+				fd = i
+			}
+		}
+		if fd < 0 || fd >= fds {
+			return nil, fmt.Errorf("systemd passed %d sockets but none is named %s", fds, name)
+		}
+	}
+	f := os.NewFile(uintptr(sdListenFDsStart+fd), name)
+	defer f.Close()
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use the socket systemd passed: %s", err)
+	}
+	log.Infof("Using the socket passed by systemd at %s\n", listener.Addr())
+	return listener, nil
+}
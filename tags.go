@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const tagsDir = "tags"
+
+type taggedDoc struct {
+	Title string
+	Path  string
+}
+
+// writeTagIndex writes tags/<tag>.md listing every downloaded document with
+// that tag in the --tag-index front matter field, and tags/README.md listing
+// the tags. The directory is rebuilt from scratch so removed tags disappear.
+func writeTagIndex() {
+	tags := make(map[string][]taggedDoc)
+	walkMarkdown(cfg.Output, func(file, rel string, content []byte) {
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(rel, tagsDir+"/") {
+			return
+		}
+		for _, tag := range frontMatterStrings(parseFrontMatter(content), cfg.TagIndex) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags[tag] = append(tags[tag], taggedDoc{documentTitle(content, path.Base(rel)), rel})
+			}
+		}
+	})
+
+	dir := filepath.Join(cfg.Output, tagsDir)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Errorf("Failed to remove old tag index: %s\n", err)
+		return
+	}
+	if len(tags) == 0 {
+		return
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Errorf("Failed to create directory: %s\n", dir)
+		return
+	}
+
+	var names []string
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+
+	var index strings.Builder
+	index.WriteString("# Tags\n\n")
+	for _, tag := range names {
+		docs := tags[tag]
+		sort.Slice(docs, func(i, j int) bool { return docs[i].Path < docs[j].Path })
+
+		var page strings.Builder
+		fmt.Fprintf(&page, "# %s\n\n", tag)
+		for _, doc := range docs {
+			fmt.Fprintf(&page, "- [%s](../%s)\n", doc.Title, doc.Path)
+		}
+		file := tagFileName(tag)
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(page.String()), 0644); err != nil {
+			log.Errorf("Failed to write tag page %s: %s\n", file, err)
+			continue
+		}
+		fmt.Fprintf(&index, "- [%s](%s) (%d)\n", tag, file, len(docs))
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte(index.String()), 0644); err != nil {
+		log.Errorf("Failed to write tag index: %s\n", err)
+		return
+	}
+	log.Infof("Wrote index of %d tags\n", len(names))
+}
+
+func tagFileName(tag string) string {
+	name := headingSlug(tag)
+	if name == "" {
+		name = "tag"
+	}
+	return name + ".md"
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The --report of a sync is a JSON file with the errors of the sync and,
+// for every HTTP request, how often it was retried, how long it took and
+// why it failed, summarized per host. Failures are categorized finer than
+// the error kinds of the exit code, so a slow API and a flaky proxy look
+// different.
+type requestRecord struct {
+	Method    string  `json:"method"`
+	URL       string  `json:"url"`
+	Host      string  `json:"host"`
+	Proxy     string  `json:"proxy,omitempty"`
+	Status    int     `json:"status,omitempty"`
+	Attempts  int     `json:"attempts"`
+	LatencyMS float64 `json:"latency_ms"`
+	WaitedMS  float64 `json:"waited_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	Detail    string  `json:"detail,omitempty"`
+}
+
+type latencySummary struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	Max float64 `json:"max"`
+}
+
+type hostReport struct {
+	Requests  int            `json:"requests"`
+	Retries   int            `json:"retries"`
+	Failed    int            `json:"failed"`
+	Errors    map[string]int `json:"errors,omitempty"`
+	LatencyMS latencySummary `json:"latency_ms"`
+}
+
+type syncReport struct {
+	Started      time.Time              `json:"started"`
+	Finished     time.Time              `json:"finished"`
+	DurationMS   float64                `json:"duration_ms"`
+	Repositories []string               `json:"repositories"`
+	Errors       map[string]int         `json:"errors"`
+	Hosts        map[string]*hostReport `json:"hosts"`
+	Requests     []requestRecord        `json:"requests"`
+	Rejected     []rejection            `json:"rejected"`
+}
+
+var requestLog = struct {
+	sync.Mutex
+	started time.Time
+	records []requestRecord
+}{}
+
+func resetRequestLog() {
+	requestLog.Lock()
+	defer requestLog.Unlock()
+	requestLog.started = time.Now()
+	requestLog.records = nil
+}
+
+// recordRequest adds the outcome of a request after its last attempt.
+func recordRequest(req *http.Request, resp *http.Response, err error, attempts int, latency, waited time.Duration) {
+	if cfg.Report == "" {
+		return
+	}
+	target := *req.URL
+	target.RawQuery = ""
+	record := requestRecord{
+		Method:    req.Method,
+		URL:       target.String(),
+		Host:      req.URL.Host,
+		Attempts:  attempts,
+		LatencyMS: milliseconds(latency),
+		WaitedMS:  milliseconds(waited),
+	}
+	if proxy, _ := proxyFunc()(req); proxy != nil {
+		record.Proxy = proxy.Host
+	}
+	if err != nil {
+		record.Error, record.Detail = transportErrorCategory(err), err.Error()
+	} else {
+		record.Status = resp.StatusCode
+		record.Error = statusCategory(resp)
+	}
+
+	requestLog.Lock()
+	defer requestLog.Unlock()
+	requestLog.records = append(requestLog.records, record)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// transportErrorCategory tells apart the ways a request fails before there
+// is a response.
+func transportErrorCategory(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCert x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "proxyconnect") || strings.Contains(message, "socks connect"):
+		return "proxy"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalidCert), errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		return "tls"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection reset"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "network"
+}
+
+func statusCategory(resp *http.Response) string {
+	switch {
+	case resp.StatusCode < 400:
+		return ""
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return "proxy auth"
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout:
+		// Proxies answer with these when they can't reach the server.
+		return "gateway"
+	case resp.StatusCode >= 500:
+		return "server error"
+	}
+	return string(classifyError(httpStatusError(resp)))
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+// writeReport writes the --report of the sync that just finished, with the
+// errors it recorded.
+func writeReport(errorCounts map[errorKind]int) {
+	requestLog.Lock()
+	report := syncReport{
+		Started:      requestLog.started,
+		Finished:     time.Now(),
+		Repositories: cfg.Repos,
+		Errors:       make(map[string]int),
+		Hosts:        make(map[string]*hostReport),
+		Requests:     requestLog.records,
+	}
+	requestLog.Unlock()
+	rejections.Lock()
+	report.Rejected = append([]rejection{}, rejections.list...)
+	rejections.Unlock()
+	report.DurationMS = milliseconds(report.Finished.Sub(report.Started))
+	for kind, count := range errorCounts {
+		report.Errors[string(kind)] = count
+	}
+
+	latencies := make(map[string][]float64)
+	for _, r := range report.Requests {
+		host := report.Hosts[r.Host]
+		if host == nil {
+			host = &hostReport{Errors: make(map[string]int)}
+			report.Hosts[r.Host] = host
+		}
+		host.Requests++
+		host.Retries += r.Attempts - 1
+		if r.Error != "" {
+			host.Failed++
+			host.Errors[r.Error]++
+		}
+		latencies[r.Host] = append(latencies[r.Host], r.LatencyMS)
+	}
+	for name, values := range latencies {
+		sort.Float64s(values)
+		report.Hosts[name].LatencyMS = latencySummary{P50: percentile(values, 0.5), P95: percentile(values, 0.95), Max: values[len(values)-1]}
+	}
+	if report.Requests == nil {
+		report.Requests = []requestRecord{}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Errorf("Failed to encode report: %s\n", err)
+		return
+	}
+	if err := ioutil.WriteFile(cfg.Report, data, 0644); err != nil {
+		log.Errorf("Failed to write report: %s\n", err)
+	}
+}
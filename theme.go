@@ -0,0 +1,146 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+)
+
+// page is passed to every template, fields that don't apply to the rendered
+// page are left empty.
+type page struct {
+	Title   string
+	Path    string
+	Parent  string
+	Query   string
+	Body    template.HTML
+	Entries []indexEntry
+	Results []searchResult
+}
+
+// A theme can redefine "style", "nav" and "footer" (or any other template)
+// in *.html files, files next to them are served under /_theme/.
+const defaultTemplates = `
+{{define "style"}}<style>
+body { box-sizing: border-box; max-width: 980px; margin: 0 auto; padding: 45px; font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; font-size: 16px; line-height: 1.5; color: #1f2328; }
+a { color: #0969da; text-decoration: none; }
+a:hover { text-decoration: underline; }
+h1, h2 { padding-bottom: .3em; border-bottom: 1px solid #d1d9e0; }
+code, pre { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: 85%; background: #f6f8fa; border-radius: 6px; }
+code { padding: .2em .4em; }
+pre { padding: 16px; overflow: auto; }
+pre code { padding: 0; background: none; font-size: 100%; }
+blockquote { margin: 0; padding: 0 1em; color: #59636e; border-left: .25em solid #d1d9e0; }
+table { border-collapse: collapse; }
+th, td { padding: 6px 13px; border: 1px solid #d1d9e0; }
+img { max-width: 100%; }
+.markdown-alert { margin-bottom: 16px; padding: .5em 1em; border-left: .25em solid #d1d9e0; }
+.markdown-alert > :last-child { margin-bottom: 0; }
+.markdown-alert-title { margin-top: 0; font-weight: 500; }
+.markdown-alert-note { border-left-color: #0969da; } .markdown-alert-note .markdown-alert-title { color: #0969da; }
+.markdown-alert-tip { border-left-color: #1a7f37; } .markdown-alert-tip .markdown-alert-title { color: #1a7f37; }
+.markdown-alert-important { border-left-color: #8250df; } .markdown-alert-important .markdown-alert-title { color: #8250df; }
+.markdown-alert-warning { border-left-color: #9a6700; } .markdown-alert-warning .markdown-alert-title { color: #9a6700; }
+.markdown-alert-caution { border-left-color: #d1242f; } .markdown-alert-caution .markdown-alert-title { color: #d1242f; }
+.footnotes { font-size: 85%; color: #59636e; border-top: 1px solid #d1d9e0; }
+</style>
+{{end}}
+{{define "nav"}}<nav><a href="/">Home</a>{{if .Parent}} · <a href="{{.Parent}}">{{.Parent}}</a>{{end}}
+<form action="/search" style="display: inline"><input type="search" name="q" value="{{.Query}}" placeholder="Search"></form></nav>
+{{end}}
+{{define "footer"}}{{end}}
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{template "style" .}}</head>
+<body>
+{{template "nav" .}}{{end}}
+{{define "scripts"}}{{with mermaidScript}}<script type="module">
+if (document.querySelector("pre.mermaid")) {
+  const { default: mermaid } = await import({{.}});
+  mermaid.initialize({ startOnLoad: false });
+  await mermaid.run();
+}
+</script>{{end}}{{end}}
+{{define "end"}}{{template "footer" .}}{{template "scripts" .}}
+<script>
+new EventSource("/_reload").onmessage = function (e) {
+  var page = decodeURIComponent(location.pathname).replace(/\/$/, "");
+  if (e.data === page || e.data.indexOf(page + "/") === 0) {
+    location.reload();
+  }
+};
+</script>
+</body>
+</html>
+{{end}}
+{{define "index"}}{{template "header" .}}<h1>{{.Title}}</h1>
+<ul>
+{{- range .Entries}}
+<li><a href="{{.URL}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{template "end" .}}{{end}}
+{{define "search"}}{{template "header" .}}<h1>{{len .Results}} results for “{{.Query}}”</h1>
+{{- range .Results}}
+<p><a href="{{.URL}}">{{.Title}}</a> <small>{{.URL}}</small><br>{{.Snippet}}</p>
+{{- end}}
+{{template "end" .}}{{end}}
+{{define "static"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{template "style" .}}</head>
+<body>
+<article>
+{{.Body}}
+</article>
+{{template "footer" .}}{{template "scripts" .}}
+</body>
+</html>
+{{end}}
+{{define "document"}}{{template "header" .}}<p><a href="?raw">raw</a></p>
+<article>
+{{.Body}}
+</article>
+{{template "end" .}}{{end}}
+`
+
+const defaultMermaidScript = "https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.esm.min.mjs"
+
+// mermaidScript is the module loaded by pages with mermaid diagrams, set by
+// serve --mermaid-script.
+var mermaidScript = defaultMermaidScript
+
+// newTemplates parses the default templates. They are parsed again rather
+// than cloned, html/template can't clone templates that were executed.
+func newTemplates() *template.Template {
+	return template.Must(template.New("").Funcs(template.FuncMap{
+		"mermaidScript": func() string { return mermaidScript },
+	}).Parse(defaultTemplates))
+}
+
+var templates = newTemplates()
+
+// loadTheme parses the templates of a theme directory on top of the default
+// ones.
+func loadTheme(dir string) (*template.Template, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	theme := newTemplates()
+	if len(files) == 0 {
+		return theme, nil
+	}
+	return theme.ParseFiles(files...)
+}
+
+func themeHandler(dir string) http.Handler {
+	return http.StripPrefix("/_theme/", http.FileServer(http.Dir(dir)))
+}
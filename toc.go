@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	tocMarker    = "<!-- toc -->"
+	tocEndMarker = "<!-- tocstop -->"
+	tocMaxDepth  = 3
+)
+
+func tocEnabled(repo string) bool {
+	for _, r := range cfg.TOC {
+		if r == "*" || r == repo {
+			return true
+		}
+	}
+	return false
+}
+
+// injectTOC adds a table of contents of the document's headings below the
+// <!-- toc --> marker, replacing an old one up to <!-- tocstop -->. Without a
+// marker it goes to the top, after the front matter if there is one.
+func injectTOC(content []byte) []byte {
+	toc := generateTOC(content)
+	if toc == "" {
+		return content
+	}
+	block := tocMarker + "\n" + toc + tocEndMarker + "\n"
+
+	if start := bytes.Index(content, []byte(tocMarker)); start >= 0 {
+		end := start + len(tocMarker)
+		if stop := bytes.Index(content[end:], []byte(tocEndMarker)); stop >= 0 {
+			end += stop + len(tocEndMarker)
+		}
+		if end < len(content) && content[end] == '\n' {
+			end++
+		}
+		return concat(content[:start], []byte(block), content[end:])
+	}
+
+	offset := frontMatterEnd(content)
+	return concat(content[:offset], []byte(block+"\n"), content[offset:])
+}
+
+func generateTOC(content []byte) string {
+	content = content[frontMatterEnd(content):]
+	ctx := parser.NewContext(parser.WithIDs(newHeadingIDs()))
+	doc := markdown.Parser().Parse(text.NewReader(content), parser.WithContext(ctx))
+
+	var toc strings.Builder
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		title := nodeText(heading, content)
+		id, _ := heading.AttributeString("id")
+		slug, _ := id.([]byte)
+		// The document title isn't part of its own table of contents.
+		if heading.Level > 1 && heading.Level <= tocMaxDepth+1 {
+			fmt.Fprintf(&toc, "%s- [%s](#%s)\n", strings.Repeat("  ", heading.Level-2), title, slug)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return toc.String()
+}
+
+// headingSlug turns a heading into an anchor the way GitHub does: lower case,
+// punctuation removed and spaces replaced by hyphens.
+func headingSlug(title string) string {
+	var slug strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(title)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			slug.WriteRune(r)
+		case r == ' ':
+			slug.WriteRune('-')
+		}
+	}
+	return slug.String()
+}
+
+// uniqueSlug appends -1, -2, ... to slugs that were already used.
+func uniqueSlug(slug string, used map[string]int) string {
+	count, ok := used[slug]
+	used[slug] = count + 1
+	if !ok {
+		return slug
+	}
+	return fmt.Sprintf("%s-%d", slug, count)
+}
+
+func nodeText(n ast.Node, source []byte) string {
+	var buf bytes.Buffer
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			switch child := child.(type) {
+			case *ast.Text:
+				buf.Write(child.Segment.Value(source))
+				if child.SoftLineBreak() {
+					buf.WriteByte(' ')
+				}
+			case *ast.String:
+				buf.Write(child.Value)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
+
+// frontMatterEnd returns the offset right after a leading YAML front matter
+// block, or 0.
+func frontMatterEnd(content []byte) int {
+	if !bytes.HasPrefix(content, []byte("---\n")) {
+		return 0
+	}
+	end := bytes.Index(content[4:], []byte("\n---\n"))
+	if end < 0 {
+		return 0
+	}
+	return 4 + end + len("\n---\n")
+}
+
+func concat(parts ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, part := range parts {
+		buf.Write(part)
+	}
+	return buf.Bytes()
+}
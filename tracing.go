@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syncs are traced with OpenTelemetry when --otlp-endpoint or
+// OTEL_EXPORTER_OTLP_ENDPOINT is set: a span for every sync with one for
+// each repository below it, which has the spans of its files and of its
+// HTTP requests. The spans are exported as OTLP/HTTP JSON at the end of every
+// sync, or earlier once otlpBatchSize spans are waiting.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	spanStatusError = 2
+
+	otlpBatchSize = 512
+)
+
+type span struct {
+	traceID, spanID, parentID string
+	name                      string
+	kind                      int
+	start, end                time.Time
+	attributes                map[string]interface{}
+	err                       string
+	errorsBefore              map[errorKind]int
+}
+
+var tracer = struct {
+	sync.Mutex
+	endpoint string
+	headers  http.Header
+	client   *http.Client
+	once     sync.Once
+	sync     *span
+	repo     *span
+	file     *span
+	pending  []*span
+}{}
+
+func tracingEnabled() bool {
+	tracer.once.Do(func() {
+		tracer.endpoint = cfg.OTLPEndpoint
+		if tracer.endpoint == "" {
+			tracer.endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		}
+		if tracer.endpoint != "" {
+			tracer.endpoint = strings.TrimSuffix(tracer.endpoint, "/") + "/v1/traces"
+		}
+		if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" && cfg.OTLPEndpoint == "" {
+			tracer.endpoint = endpoint
+		}
+		tracer.headers = make(http.Header)
+		for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+			if split := strings.SplitN(pair, "=", 2); len(split) == 2 {
+				tracer.headers.Set(strings.TrimSpace(split[0]), strings.TrimSpace(split[1]))
+			}
+		}
+		// The exports themselves aren't traced.
+		tracer.client = &http.Client{Transport: newTransport(), Timeout: 30 * time.Second}
+	})
+	return tracer.endpoint != ""
+}
+
+func randomID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// startSpan starts a span below parent, or a new trace without one.
+func startSpan(name string, kind int, parent *span, attributes map[string]interface{}) *span {
+	s := &span{spanID: randomID(8), name: name, kind: kind, start: time.Now(), attributes: attributes}
+	// Request spans fail with their response, syncs and repositories with
+	// the errors recorded while they ran.
+	if kind == spanKindInternal {
+		s.errorsBefore = snapshotErrors()
+	}
+	if parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		s.traceID = randomID(16)
+	}
+	return s
+}
+
+// finish ends the span, marking it as failed when errors were recorded
+// while it ran.
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	if s.err == "" && s.errorsBefore != nil {
+		after := snapshotErrors()
+		failed := make(map[errorKind]int)
+		for kind, count := range after {
+			if count > s.errorsBefore[kind] {
+				failed[kind] = count - s.errorsBefore[kind]
+			}
+		}
+		if len(failed) > 0 {
+			s.err = errorSummary(failed)
+		}
+	}
+
+	tracer.Lock()
+	tracer.pending = append(tracer.pending, s)
+	flush := len(tracer.pending) >= otlpBatchSize
+	tracer.Unlock()
+	if flush {
+		exportSpans()
+	}
+}
+
+func traceSyncStart() {
+	if !tracingEnabled() {
+		return
+	}
+	s := startSpan("sync", spanKindInternal, nil, map[string]interface{}{"md.repositories": len(cfg.Repos), "md.output": cfg.Output})
+	tracer.Lock()
+	tracer.sync = s
+	tracer.Unlock()
+}
+
+func traceSyncEnd() {
+	if !tracingEnabled() {
+		return
+	}
+	tracer.Lock()
+	s := tracer.sync
+	tracer.sync = nil
+	tracer.Unlock()
+	s.finish()
+	exportSpans()
+}
+
+// traceRepo starts the span of a repository's sync, finish it when done.
+func traceRepo(repo string) *span {
+	if !tracingEnabled() {
+		return nil
+	}
+	tracer.Lock()
+	defer tracer.Unlock()
+	tracer.repo = startSpan("sync "+repo, spanKindInternal, tracer.sync, map[string]interface{}{"md.repo": repo})
+	return tracer.repo
+}
+
+func traceFile(item treeItem) *span {
+	if !tracingEnabled() {
+		return nil
+	}
+	tracer.Lock()
+	defer tracer.Unlock()
+	tracer.file = startSpan("file "+item.Path, spanKindInternal, tracer.repo, map[string]interface{}{"md.path": item.Path, "md.sha": item.Sha, "md.size": item.Size})
+	return tracer.file
+}
+
+// endTraceFile finishes the file span and makes HTTP requests children of
+// the repository again.
+func endTraceFile(s *span) {
+	if s == nil {
+		return
+	}
+	tracer.Lock()
+	tracer.file = nil
+	tracer.Unlock()
+	s.finish()
+}
+
+func endTraceRepo(s *span) {
+	if s == nil {
+		return
+	}
+	tracer.Lock()
+	tracer.repo = nil
+	tracer.Unlock()
+	s.finish()
+}
+
+// tracingTransport adds a span for every request, which lasts until the
+// body is closed.
+type tracingTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !tracingEnabled() {
+		return t.transport.RoundTrip(req)
+	}
+	tracer.Lock()
+	parent := tracer.file
+	if parent == nil {
+		parent = tracer.repo
+	}
+	if parent == nil {
+		parent = tracer.sync
+	}
+	tracer.Unlock()
+	// Requests outside of syncs, like those of search, aren't traced.
+	if parent == nil {
+		return t.transport.RoundTrip(req)
+	}
+
+	target := *req.URL
+	target.RawQuery = ""
+	s := startSpan(req.Method+" "+req.URL.Host, spanKindClient, parent, map[string]interface{}{
+		"http.request.method": req.Method,
+		"url.full":            target.String(),
+		"server.address":      req.URL.Host,
+	})
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		s.err = err.Error()
+		s.finish()
+		return nil, err
+	}
+	s.attributes["http.response.status_code"] = resp.StatusCode
+	if resp.StatusCode >= 400 {
+		s.err = resp.Status
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: s}
+	return resp, nil
+}
+
+type spanBody struct {
+	io.ReadCloser
+	span *span
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.span.finish)
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	b.once.Do(b.span.finish)
+	return b.ReadCloser.Close()
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	var list []otlpAttribute
+	for key, value := range attributes {
+		switch v := value.(type) {
+		case int:
+			list = append(list, otlpAttribute{key, map[string]interface{}{"intValue": strconv.Itoa(v)}})
+		case int64:
+			list = append(list, otlpAttribute{key, map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}})
+		case bool:
+			list = append(list, otlpAttribute{key, map[string]interface{}{"boolValue": v}})
+		default:
+			list = append(list, otlpAttribute{key, map[string]interface{}{"stringValue": fmt.Sprint(v)}})
+		}
+	}
+	return list
+}
+
+// exportSpans sends the finished spans to the collector. A failed export
+// drops them, tracing never fails a sync.
+func exportSpans() {
+	tracer.Lock()
+	spans := tracer.pending
+	tracer.pending = nil
+	tracer.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	var encoded []map[string]interface{}
+	for _, s := range spans {
+		e := map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes),
+		}
+		if s.parentID != "" {
+			e["parentSpanId"] = s.parentID
+		}
+		if s.err != "" {
+			e["status"] = map[string]interface{}{"code": spanStatusError, "message": s.err}
+		}
+		encoded = append(encoded, e)
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "md-downloader"
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpAttributes(map[string]interface{}{
+				"service.name":    serviceName,
+				"service.version": version,
+			})},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "md-downloader", "version": version},
+				"spans": encoded,
+			}},
+		}},
+	})
+
+	req, err := http.NewRequest(http.MethodPost, tracer.endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Warnf("Failed to export traces: %s\n", err)
+		return
+	}
+	req.Header = tracer.headers.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tracer.client.Do(req)
+	if err != nil {
+		log.Warnf("Failed to export traces: %s\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Warnf("Failed to export traces: %s\n", resp.Status)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+// transformContent applies the enabled transforms to a downloaded file before
+// it is written to the output directory.
+func transformContent(repo, filePath string, content []byte) []byte {
+	if isSniffCandidate(filePath) {
+		return redactContent(normalizeEOL(normalizeEncoding(filePath, content)))
+	}
+	if !isMarkdown(filePath) {
+		return redactText(content)
+	}
+	content = normalizeEOL(normalizeEncoding(filePath, content))
+	content = redactContent(runWasmPlugins(repo, filePath, content))
+	if cfg.Snippets {
+		extractSnippets(repo, filePath, content)
+	}
+	return runPipeline(repo, filePath, content)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Markdown files are translated with --translate into each language, by
+// DeepL, Google Cloud Translation or a LibreTranslate compatible endpoint,
+// and written to <output>/<lang>/ in the layout of the output. Only text is
+// sent: front matter, code blocks, HTML blocks, reference definitions and,
+// within lines, code spans, URLs and tags are kept as they are, the
+// translators are asked to keep the placeholders that stand in for them.
+const (
+	translatorDeepL  = "deepl"
+	translatorGoogle = "google"
+
+	translateBatchSize = 50
+)
+
+var (
+	deepLURL     = "https://api.deepl.com/v2/translate"
+	deepLFreeURL = "https://api-free.deepl.com/v2/translate"
+	googleURL    = "https://translation.googleapis.com/language/translate/v2"
+
+	linePrefix    = regexp.MustCompile(`^[ \t]*(?:>[ \t]?)*(?:#{1,6}[ \t]+|[-*+][ \t]+(?:\[[ xX]\][ \t]+)?|\d+[.)][ \t]+)?`)
+	tableRule     = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	referenceLine = regexp.MustCompile(`^[ \t]*\[[^\]]+\]:[ \t]`)
+	inlineKeep    = regexp.MustCompile("`+[^`]*`+|\\]\\([^)]*\\)|<[^>\n]+>|https?://[^\\s)>\\]]+")
+	placeholder   = regexp.MustCompile(`<x\s+id="?(\d+)"?\s*/?>(?:\s*</x>)?`)
+)
+
+func parseTranslator() error {
+	if len(cfg.Translate) == 0 {
+		return nil
+	}
+	switch {
+	case cfg.Translator == translatorDeepL, cfg.Translator == translatorGoogle:
+	case strings.HasPrefix(cfg.Translator, "http://"), strings.HasPrefix(cfg.Translator, "https://"):
+	default:
+		return fmt.Errorf("invalid --translator %s, expected deepl, google or the URL of a LibreTranslate compatible endpoint", cfg.Translator)
+	}
+	if cfg.TranslatorKey == "" && cfg.Translator == translatorDeepL {
+		cfg.TranslatorKey = os.Getenv("DEEPL_AUTH_KEY")
+	}
+	if cfg.TranslatorKey == "" && cfg.Translator == translatorDeepL {
+		return fmt.Errorf("--translator deepl needs --translator-key or DEEPL_AUTH_KEY")
+	}
+	key, err := resolveSecret(cfg.TranslatorKey)
+	if err != nil {
+		return err
+	}
+	cfg.TranslatorKey = key
+	return nil
+}
+
+// translationPath returns where the translation of an output file goes.
+// With --route-language the translation replaces the directory of the
+// source's language.
+func translationPath(lang, source, dest string) string {
+	rel, err := filepath.Rel(cfg.Output, dest)
+	if err != nil {
+		rel = filepath.Base(dest)
+	}
+	if sourceDir := routeDir(source); cfg.RouteLanguage && sourceDir != "" {
+		rel = strings.TrimPrefix(rel, sourceDir+string(filepath.Separator))
+	}
+	return filepath.Join(cfg.Output, routeDir(lang), rel)
+}
+
+// translateFile writes the translations of a markdown file written to dest.
+func translateFile(filePath, dest string, content []byte) error {
+	if len(cfg.Translate) == 0 || !isMarkdown(filePath) {
+		return nil
+	}
+	source := cfg.SourceLang
+	if source == "" {
+		source = detectLanguage(content)
+	}
+	for _, lang := range cfg.Translate {
+		if source != "" && languageMatches(source, []string{lang}) {
+			continue
+		}
+		translated, err := translateMarkdown(content, lang)
+		if err != nil {
+			return fmt.Errorf("%s: %w", lang, err)
+		}
+		target := translationPath(lang, source, dest)
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, translated, 0644); err != nil {
+			return err
+		}
+		log.Infof("File translated: %s\n", target)
+	}
+	return nil
+}
+
+// moveTranslations follows a renamed file with its translations.
+func moveTranslations(from, to string) {
+	for _, lang := range cfg.Translate {
+		oldPath, newPath := translationPath(lang, "", from), translationPath(lang, "", to)
+		if _, err := os.Stat(oldPath); err != nil {
+			continue
+		}
+		os.MkdirAll(filepath.Dir(newPath), os.ModePerm)
+		if err := os.Rename(oldPath, newPath); err != nil {
+			log.Warnf("Failed to move translation %s: %s\n", oldPath, err)
+		}
+	}
+}
+
+// translatedPart is a piece of a markdown file, translated when text is
+// set, kept as prefix otherwise. The text is HTML with placeholders for the
+// kept spans.
+type translatedPart struct {
+	prefix string
+	text   string
+	kept   []string
+}
+
+func translateMarkdown(content []byte, lang string) ([]byte, error) {
+	end := frontMatterEnd(content)
+	parts := []translatedPart{{prefix: string(content[:end])}}
+	fence, paragraph := "", -1
+	for _, line := range strings.SplitAfter(string(content[end:]), "\n") {
+		body := strings.TrimRight(line, "\r\n")
+		eol := line[len(body):]
+		trimmed := strings.TrimSpace(body)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case trimmed == "", strings.HasPrefix(trimmed, "<"), tableRule.MatchString(body), referenceLine.MatchString(body):
+		default:
+			prefix := linePrefix.FindString(body)
+			// Lines continuing a paragraph are joined and translated with
+			// it, the line ending before them is dropped.
+			if paragraph >= 0 && strings.TrimSpace(prefix) == "" {
+				parts = parts[:len(parts)-1]
+				parts[paragraph].text += protectInline(" "+trimmed, &parts[paragraph].kept)
+			} else {
+				part := translatedPart{prefix: prefix}
+				part.text = protectInline(body[len(prefix):], &part.kept)
+				parts = append(parts, part)
+				paragraph = len(parts) - 1
+			}
+			parts = append(parts, translatedPart{prefix: eol})
+			continue
+		}
+		parts = append(parts, translatedPart{prefix: line})
+		paragraph = -1
+	}
+
+	var texts []string
+	var indexes []int
+	for i, part := range parts {
+		if strings.TrimSpace(part.text) != "" {
+			texts = append(texts, part.text)
+			indexes = append(indexes, i)
+		}
+	}
+	for start := 0; start < len(texts); start += translateBatchSize {
+		stop := start + translateBatchSize
+		if stop > len(texts) {
+			stop = len(texts)
+		}
+		translated, err := translateTexts(texts[start:stop], lang)
+		if err != nil {
+			return nil, err
+		}
+		if len(translated) != stop-start {
+			return nil, fmt.Errorf("got %d translations for %d texts", len(translated), stop-start)
+		}
+		for j, text := range translated {
+			parts[indexes[start+j]].text = text
+		}
+	}
+
+	var out strings.Builder
+	for _, part := range parts {
+		out.WriteString(part.prefix)
+		if part.text != "" {
+			out.WriteString(restoreInline(part.text, part.kept))
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// protectInline escapes text for translation as HTML, replacing the spans
+// that must not change with placeholders.
+func protectInline(text string, kept *[]string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range inlineKeep.FindAllStringIndex(text, -1) {
+		out.WriteString(html.EscapeString(text[last:m[0]]))
+		span := text[m[0]:m[1]]
+		// The text of links is translated, only their target is kept.
+		if strings.HasPrefix(span, "](") {
+			out.WriteString("]")
+			span = span[1:]
+		}
+		out.WriteString(`<x id="` + strconv.Itoa(len(*kept)) + `"/>`)
+		*kept = append(*kept, span)
+		last = m[1]
+	}
+	out.WriteString(html.EscapeString(text[last:]))
+	return out.String()
+}
+
+func restoreInline(text string, kept []string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range placeholder.FindAllStringSubmatchIndex(text, -1) {
+		out.WriteString(html.UnescapeString(text[last:m[0]]))
+		if n, err := strconv.Atoi(text[m[2]:m[3]]); err == nil && n < len(kept) {
+			out.WriteString(kept[n])
+		}
+		last = m[1]
+	}
+	out.WriteString(html.UnescapeString(text[last:]))
+	return out.String()
+}
+
+// translateTexts sends a batch of HTML texts to the --translator.
+func translateTexts(texts []string, lang string) ([]string, error) {
+	var endpoint string
+	var body interface{}
+	header := make(http.Header)
+	switch cfg.Translator {
+	case translatorDeepL:
+		endpoint = deepLURL
+		if strings.HasSuffix(cfg.TranslatorKey, ":fx") {
+			endpoint = deepLFreeURL
+		}
+		request := map[string]interface{}{"text": texts, "target_lang": strings.ToUpper(lang), "tag_handling": "html"}
+		if cfg.SourceLang != "" {
+			request["source_lang"] = strings.ToUpper(cfg.SourceLang)
+		}
+		body = request
+		header.Set("Authorization", "DeepL-Auth-Key "+cfg.TranslatorKey)
+	case translatorGoogle:
+		endpoint = googleURL
+		request := map[string]interface{}{"q": texts, "target": lang, "format": "html"}
+		if cfg.SourceLang != "" {
+			request["source"] = cfg.SourceLang
+		}
+		body = request
+		// Without an API key, the credentials of GCP Secret Manager are used.
+		if cfg.TranslatorKey != "" {
+			endpoint += "?key=" + cfg.TranslatorKey
+		} else {
+			token, err := gcpAccessToken()
+			if err != nil {
+				return nil, fmt.Errorf("no --translator-key and failed to authenticate to GCP: %s", err)
+			}
+			header.Set("Authorization", "Bearer "+token)
+		}
+	default:
+		endpoint = cfg.Translator
+		source := cfg.SourceLang
+		if source == "" {
+			source = "auto"
+		}
+		request := map[string]interface{}{"q": texts, "source": source, "target": lang, "format": "html"}
+		if cfg.TranslatorKey != "" {
+			request["api_key"] = cfg.TranslatorKey
+		}
+		body = request
+	}
+
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpStatusError(resp)
+	}
+
+	var result struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+		Data struct {
+			Translations []struct {
+				TranslatedText string `json:"translatedText"`
+			} `json:"translations"`
+		} `json:"data"`
+		TranslatedText []string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	var translated []string
+	switch cfg.Translator {
+	case translatorDeepL:
+		for _, t := range result.Translations {
+			translated = append(translated, t.Text)
+		}
+	case translatorGoogle:
+		for _, t := range result.Data.Translations {
+			translated = append(translated, t.TranslatedText)
+		}
+	default:
+		translated = result.TranslatedText
+	}
+	return translated, nil
+}
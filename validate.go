@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// validations checks every file before it is written to the output:
+//
+//	marker:TEXT     rejects files containing TEXT, e.g. marker:DO NOT PUBLISH
+//	regex:EXPR      rejects files matching the regular expression
+//	max-size:BYTES  rejects files larger than BYTES
+//	command:CMD     runs CMD with sh -c, the content on stdin and the file's
+//	                repository and path in MD_REPO and MD_PATH, and rejects
+//	                the file when it exits with another code than 0
+//
+// A rejected file isn't written, an older version in the output stays.
+var validations []string
+
+type validation struct {
+	name  string
+	check func(repo, filePath string, content []byte) (ok bool, message string)
+}
+
+type rejection struct {
+	Repo    string `json:"repo"`
+	Path    string `json:"path"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+var (
+	validators []validation
+	rejections = struct {
+		sync.Mutex
+		list []rejection
+	}{}
+)
+
+func parseValidations() error {
+	validators = nil
+	for _, v := range validations {
+		kind, arg := v, ""
+		if split := strings.SplitN(v, ":", 2); len(split) == 2 {
+			kind, arg = split[0], split[1]
+		}
+		if arg == "" {
+			return fmt.Errorf("invalid validation %s, expected check:argument", v)
+		}
+		switch kind {
+		case "marker":
+			marker := []byte(arg)
+			validators = append(validators, validation{v, func(repo, filePath string, content []byte) (bool, string) {
+				if i := bytes.Index(content, marker); i >= 0 {
+					return false, fmt.Sprintf("contains %q on line %d", arg, lineAt(content, i))
+				}
+				return true, ""
+			}})
+		case "regex":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return fmt.Errorf("invalid validation %s: %s", v, err)
+			}
+			validators = append(validators, validation{v, func(repo, filePath string, content []byte) (bool, string) {
+				if match := re.FindIndex(content); match != nil {
+					return false, fmt.Sprintf("matches on line %d", lineAt(content, match[0]))
+				}
+				return true, ""
+			}})
+		case "max-size":
+			limit, err := strconv.Atoi(arg)
+			if err != nil || limit <= 0 {
+				return fmt.Errorf("invalid validation %s, expected a size in bytes", v)
+			}
+			validators = append(validators, validation{v, func(repo, filePath string, content []byte) (bool, string) {
+				if len(content) > limit {
+					return false, fmt.Sprintf("%d bytes is over the limit of %d", len(content), limit)
+				}
+				return true, ""
+			}})
+		case "command":
+			validators = append(validators, validation{v, func(repo, filePath string, content []byte) (bool, string) {
+				return runValidationCommand(arg, repo, filePath, content)
+			}})
+		default:
+			return fmt.Errorf("unknown validation %s, expected marker, regex, max-size or command", kind)
+		}
+	}
+	return nil
+}
+
+func runValidationCommand(command, repo, filePath string, content []byte) (bool, string) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Env = append(os.Environ(), "MD_REPO="+repo, "MD_PATH="+filePath)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return true, ""
+	}
+	message := strings.TrimSpace(string(output))
+	if message == "" {
+		message = err.Error()
+	}
+	return false, message
+}
+
+// validateFile runs the checks in order and stops at the first one that
+// rejects the file.
+func validateFile(repo, filePath string, content []byte) error {
+	for _, v := range validators {
+		ok, message := v.check(repo, filePath, content)
+		if ok {
+			continue
+		}
+		rejections.Lock()
+		rejections.list = append(rejections.list, rejection{Repo: repo, Path: filePath, Check: v.name, Message: message})
+		rejections.Unlock()
+		return &validationError{check: v.name, message: message}
+	}
+	return nil
+}
+
+type validationError struct {
+	check, message string
+}
+
+func (e *validationError) Error() string {
+	return fmt.Sprintf("rejected by %s: %s", e.check, e.message)
+}
+
+func resetRejections() {
+	rejections.Lock()
+	defer rejections.Unlock()
+	rejections.list = nil
+}
+
+// checkFile runs --secret-scan and --validate on a file about to be written
+// and returns the content to write.
+func checkFile(repo, filePath string, content []byte) ([]byte, error) {
+	content, err := scanSecrets(repo, filePath, content)
+	if err != nil {
+		return nil, err
+	}
+	return content, validateFile(repo, filePath, content)
+}
+
+// rejectFile records a file checkFile rejected, it keeps its older version
+// in the output.
+func rejectFile(repo, filePath, sha string, size int, history History, err error) {
+	log.Errorf("Not writing %s: %s\n", filePath, err)
+	recordError(err)
+	audit(auditError, repo, filePath, sha, err.Error())
+	history.Files[filePath] = HistoryEntry{Sha: sha, Size: size, Status: statusRejected, DownloadedAt: time.Now()}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const vaultPrefix = "vault:"
+
+// vaultSecret reads a field of a secret from Vault, referenced as
+// vault:<path>#<field> with the field defaulting to token. Paths of KV
+// version 2 engines include data/, e.g. vault:secret/data/ci/github#token.
+//
+// The server is VAULT_ADDR. The client token is VAULT_TOKEN or the one vault
+// login stored in ~/.vault-token, otherwise md-downloader logs in with
+// VAULT_ROLE: through AppRole when VAULT_SECRET_ID is set, with the pod's
+// service account token through Kubernetes auth otherwise. VAULT_AUTH_PATH
+// changes where the auth method is mounted, VAULT_NAMESPACE selects a
+// namespace of Vault Enterprise.
+func vaultSecret(ref string) (string, error) {
+	path, field := strings.TrimPrefix(ref, vaultPrefix), "token"
+	if split := strings.SplitN(path, "#", 2); len(split) == 2 {
+		path, field = split[0], split[1]
+	}
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("set VAULT_ADDR to read %s", ref)
+	}
+	token, err := vaultToken(addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to log in to Vault: %s", err)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := vaultRequest(http.MethodGet, addr+"/v1/"+strings.TrimPrefix(path, "/"), token, nil, &secret); err != nil {
+		return "", fmt.Errorf("failed to read %s from Vault: %s", path, err)
+	}
+	// KV version 2 nests the fields below data.data.
+	fields := secret.Data
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := fields["metadata"]; hasMetadata {
+			fields = nested
+		}
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", path, field)
+	}
+	return value, nil
+}
+
+func vaultToken(addr string) (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	role := os.Getenv("VAULT_ROLE")
+	if role == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				return strings.TrimSpace(string(token)), nil
+			}
+		}
+		return "", fmt.Errorf("set VAULT_TOKEN, or VAULT_ROLE to log in")
+	}
+
+	method, body := "kubernetes", map[string]string{"role": role}
+	if secretID := os.Getenv("VAULT_SECRET_ID"); secretID != "" {
+		method, body = "approle", map[string]string{"role_id": role, "secret_id": secretID}
+	} else {
+		jwt, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+		if err != nil {
+			return "", fmt.Errorf("no service account token for Kubernetes auth, set VAULT_SECRET_ID for AppRole")
+		}
+		body["jwt"] = strings.TrimSpace(string(jwt))
+	}
+	if path := os.Getenv("VAULT_AUTH_PATH"); path != "" {
+		method = strings.Trim(path, "/")
+	}
+
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := vaultRequest(http.MethodPost, addr+"/v1/auth/"+method+"/login", "", body, &login); err != nil {
+		return "", err
+	}
+	return login.Auth.ClientToken, nil
+}
+
+func vaultRequest(method, url, token string, body, result interface{}) error {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Cache-Control", "no-store")
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return httpStatusError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
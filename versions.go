@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// keepVersion moves the file about to be overwritten to file.~1~, shifting
+// older versions up to --keep-versions. The content is copied rather than
+// renamed so links shared with other paths stay intact.
+func keepVersion(path string, content []byte) {
+	if cfg.KeepVersions <= 0 {
+		return
+	}
+	old, err := ioutil.ReadFile(path)
+	if err != nil || (content != nil && bytes.Equal(old, content)) {
+		return
+	}
+
+	os.Remove(versionPath(path, cfg.KeepVersions))
+	for n := cfg.KeepVersions - 1; n >= 1; n-- {
+		os.Rename(versionPath(path, n), versionPath(path, n+1))
+	}
+	if err := ioutil.WriteFile(versionPath(path, 1), old, 0644); err != nil {
+		log.Warnf("Failed to keep previous version of %s: %s\n", path, err)
+	}
+}
+
+func versionPath(path string, n int) string {
+	return fmt.Sprintf("%s.~%d~", path, n)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// wasmTimeout bounds how long a plugin may run on one file.
+const wasmTimeout = 30 * time.Second
+
+// wasmPlugin is a WASI command module transforming markdown: it reads the
+// file from stdin, gets its repository and path in the MD_REPO and MD_PATH
+// environment variables and writes the new content to stdout.
+type wasmPlugin struct {
+	name   string
+	module wazero.CompiledModule
+}
+
+var (
+	wasmRuntime wazero.Runtime
+	wasmPlugins []wasmPlugin
+)
+
+func loadWasmPlugins() error {
+	ctx := context.Background()
+	// A reloading daemon compiles the plugins again.
+	if wasmRuntime != nil {
+		wasmRuntime.Close(ctx)
+		wasmRuntime, wasmPlugins = nil, nil
+	}
+	if len(cfg.WasmPlugins) == 0 {
+		return nil
+	}
+	wasmRuntime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, wasmRuntime); err != nil {
+		return fmt.Errorf("failed to set up WASI: %s", err)
+	}
+
+	for _, file := range cfg.WasmPlugins {
+		code, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read plugin: %s", err)
+		}
+		module, err := wasmRuntime.CompileModule(ctx, code)
+		if err != nil {
+			return fmt.Errorf("failed to compile plugin %s: %s", file, err)
+		}
+		wasmPlugins = append(wasmPlugins, wasmPlugin{name: filepath.Base(file), module: module})
+	}
+	return nil
+}
+
+// runWasmPlugins passes the content through every plugin in order. A plugin
+// that fails leaves the content as it was.
+func runWasmPlugins(repo, filePath string, content []byte) []byte {
+	for _, plugin := range wasmPlugins {
+		output, err := plugin.run(repo, filePath, content)
+		if err != nil {
+			log.Warnf("Plugin %s failed on %s: %s\n", plugin.name, filePath, err)
+			continue
+		}
+		content = output
+	}
+	return content
+}
+
+func (p wasmPlugin) run(repo, filePath string, content []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wasmTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(p.name).
+		WithStdin(bytes.NewReader(content)).
+		WithStdout(&stdout).
+		WithStderr(&stderr).
+		WithEnv("MD_REPO", repo).
+		WithEnv("MD_PATH", filePath)
+
+	module, err := wasmRuntime.InstantiateModule(ctx, p.module, config)
+	if module != nil {
+		module.Close(ctx)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
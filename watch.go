@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newWatchCmd() *cobra.Command {
+	var interval time.Duration
+	var healthAddr string
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Sync the repositories again and again at a fixed interval",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !setup() {
+				return
+			}
+			runAsDaemon(cmd)
+			if healthAddr != "" {
+				mux := http.NewServeMux()
+				handleHealth(mux, true)
+				log.Infof("Serving health checks on %s\n", healthAddr)
+				go func() {
+					if err := http.ListenAndServe(healthAddr, mux); err != nil {
+						log.Errorf("Failed to serve health checks: %s\n", err)
+					}
+				}()
+			}
+			sdReadyAndWatchdog()
+			watchRepos(interval)
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", 5*time.Minute, "Time between syncs")
+	cmd.Flags().StringVar(&healthAddr, "health-addr", "", "Serve /healthz and /readyz on this address")
+	cmd.Flags().DurationVar(&stuckAfter, "stuck-after", 30*time.Minute, "How long a sync may run before /healthz fails")
+
+	return cmd
+}
+
+func watchRepos(interval time.Duration) {
+	atomic.AddInt32(&syncLoops, 1)
+	for {
+		// The lock is only held while syncing, one-off runs can get in
+		// between.
+		if unlock, err := lockOutput(); err != nil {
+			log.Warnf("Skipping sync: %s\n", err)
+		} else {
+			beginSync()
+			for _, repo := range cfg.Repos {
+				if stopping() {
+					break
+				}
+				listMdFiles(repo)
+			}
+			finishSync()
+			endSync()
+			unlock()
+		}
+		if stopping() {
+			log.Infof("Sync stopped, exiting\n")
+			exitDaemon()
+		}
+		log.Debugf("Next sync in %s\n", interval)
+		select {
+		case <-time.After(interval):
+		case <-reloadRequests:
+			reloadConfig()
+		case <-stopRequests:
+			exitDaemon()
+		}
+	}
+}
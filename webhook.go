@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// maxWebhookBody is the largest payload GitHub sends.
+const maxWebhookBody = 25 << 20
+
+type pushEvent struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName      string `json:"full_name"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+}
+
+// syncQueue runs syncs one at a time, a repository that is already waiting
+// isn't queued twice.
+type syncQueue struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	repos   chan string
+}
+
+func newWebhookCmd() *cobra.Command {
+	var addr, secret string
+
+	cmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Listen for GitHub push webhooks and sync the pushed repositories",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !setup() {
+				return
+			}
+			if secret == "" {
+				log.Warnf("No --webhook-secret, anyone who can reach %s can trigger syncs\n", addr)
+			}
+
+			queue := &syncQueue{
+				pending: make(map[string]bool),
+				repos:   make(chan string, len(cfg.Repos)),
+			}
+			go queue.run()
+
+			handleHealth(http.DefaultServeMux, false)
+			http.Handle("/", webhookHandler(secret, queue))
+			listener, err := listen("webhook", addr)
+			if err != nil {
+				log.Errorf("Failed to start webhook listener: %s\n", err)
+				return
+			}
+			log.Infof("Listening for webhooks on %s\n", listener.Addr())
+			sdReadyAndWatchdog()
+			if err := http.Serve(listener, nil); err != nil {
+				log.Errorf("Failed to start webhook listener: %s\n", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", ":9000", "Address to listen on")
+	cmd.Flags().StringVar(&secret, "webhook-secret", "", "Secret used to verify webhook signatures")
+	cmd.Flags().DurationVar(&stuckAfter, "stuck-after", 30*time.Minute, "How long a sync may run before /healthz fails")
+
+	return cmd
+}
+
+func webhookHandler(secret string, queue *syncQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if secret != "" && !validSignature(secret, r.Header.Get("X-Hub-Signature-256"), body) {
+			log.Warnf("Rejected webhook with invalid signature\n")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Header.Get("X-GitHub-Event") != "push" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var event pushEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		repo, ok := configuredRepo(event.Repository.FullName)
+		if !ok || !syncedBranch(repo, event) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !touchesDocs(repo, event) {
+			log.Infof("Ignoring push to %s (no matching paths changed)\n", event.Repository.FullName)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		queue.add(repo)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func validSignature(secret, signature string, body []byte) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func configuredRepo(fullName string) (string, bool) {
+	for _, repo := range cfg.Repos {
+		if strings.EqualFold(strings.TrimPrefix(repo, "https://github.com/"), fullName) {
+			return repo, true
+		}
+	}
+	return "", false
+}
+
+// syncedBranch reports whether a push went to the branch that is synced of
+// repo or to its default branch.
+func syncedBranch(repo string, event pushEvent) bool {
+	branch := strings.TrimPrefix(event.Ref, "refs/heads/")
+	if branch == event.Ref {
+		return false
+	}
+	return branch == repoRef(repo) || branch == event.Repository.DefaultBranch
+}
+
+// touchesDocs reports whether a push changed any path that would be synced.
+// Pushes without a commit list (e.g. force pushes) are always synced.
+func touchesDocs(repo string, event pushEvent) bool {
+	if len(event.Commits) == 0 {
+		return true
+	}
+	for _, commit := range event.Commits {
+		for _, paths := range [][]string{commit.Added, commit.Removed, commit.Modified} {
+			for _, path := range paths {
+				if isDocFile(path) && !isIgnored(repo, path) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (q *syncQueue) add(repo string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending[repo] {
+		return
+	}
+	q.pending[repo] = true
+	q.repos <- repo
+}
+
+func (q *syncQueue) run() {
+	for repo := range q.repos {
+		q.mu.Lock()
+		delete(q.pending, repo)
+		q.mu.Unlock()
+
+		log.Infof("Syncing %s after push\n", repo)
+		unlock, err := lockOutput()
+		if err != nil {
+			log.Warnf("Skipping sync of %s: %s\n", repo, err)
+			continue
+		}
+		beginSync()
+		listMdFiles(repo)
+		finishSync()
+		endSync()
+		unlock()
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	testConfig(t)
+	cfg.Repos = []string{"octo/docs"}
+	cfg.Ignore = map[string][]ignoreRule{}
+	rule, _ := parseIgnoreRule("drafts/**")
+	cfg.Ignore["octo/docs"] = []ignoreRule{rule}
+
+	push := func(ref, path string) string {
+		return `{"ref": "` + ref + `", "repository": {"full_name": "octo/docs", "default_branch": "main"}, "commits": [{"modified": ["` + path + `"]}]}`
+	}
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		signature string
+		want      int
+	}{
+		{"synced branch", http.MethodPost, push("refs/heads/master", "guide.md"), "", http.StatusAccepted},
+		{"default branch", http.MethodPost, push("refs/heads/main", "guide.md"), "", http.StatusAccepted},
+		{"other branch", http.MethodPost, push("refs/heads/feature", "guide.md"), "", http.StatusNoContent},
+		{"tag", http.MethodPost, push("refs/tags/master", "guide.md"), "", http.StatusNoContent},
+		{"source code only", http.MethodPost, push("refs/heads/master", "main.go"), "", http.StatusNoContent},
+		{"ignored path", http.MethodPost, push("refs/heads/master", "drafts/guide.md"), "", http.StatusNoContent},
+		{"wrong method", http.MethodGet, "", "", http.StatusMethodNotAllowed},
+		{"bad signature", http.MethodPost, push("refs/heads/master", "guide.md"), "sha256=00", http.StatusUnauthorized},
+		{"too large", http.MethodPost, strings.Repeat(" ", maxWebhookBody+1), "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &syncQueue{pending: make(map[string]bool), repos: make(chan string, 1)}
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			req.Header.Set("X-GitHub-Event", "push")
+			signature := tt.signature
+			if signature == "" {
+				signature = sign(tt.body)
+			}
+			req.Header.Set("X-Hub-Signature-256", signature)
+			rec := httptest.NewRecorder()
+
+			webhookHandler("secret", queue).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+			if queued := len(queue.repos) == 1; queued != (tt.want == http.StatusAccepted) {
+				t.Errorf("queued: %v", queued)
+			}
+		})
+	}
+}